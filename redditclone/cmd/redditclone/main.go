@@ -1,15 +1,31 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/category"
+	"redditclone/pkg/clock"
 	"redditclone/pkg/comment"
 	"redditclone/pkg/handlers"
+	"redditclone/pkg/httpcache"
+	"redditclone/pkg/kv"
+	"redditclone/pkg/message"
 	"redditclone/pkg/middleware"
+	"redditclone/pkg/oauth"
 	"redditclone/pkg/post"
 	"redditclone/pkg/session"
+	"redditclone/pkg/spam"
+	"redditclone/pkg/token"
+	"redditclone/pkg/twofactor"
 	"redditclone/pkg/user"
+	"redditclone/pkg/views"
 
 	"fmt"
 
@@ -18,12 +34,53 @@ import (
 )
 
 func main() {
+	admins := flag.String("admins", "", "comma separated logins of site admins")
+	spamConfig := flag.String("spam-config", "", "json file with anti-spam rules, built-in defaults are used if empty")
+	oauthConfig := flag.String("oauth-config", "", "json file with the list of oauth2 login providers")
+	responseCache := flag.Int("response-cache", 0, "number of rendered post listings and posts kept in memory, 0 disables the cache")
+	legacyVotes := flag.Bool("legacy-votes", true, "serve GET upvote/downvote/unvote routes used by the bundled frontend")
+	kvAddr := flag.String("kv-addr", "", "address of a redis server shared by all instances of the site, everything is kept in memory if empty")
+	siteURL := flag.String("site-url", "http://localhost:8020", "public address of the site used in absolute links of feeds")
+	corsOrigins := flag.String("cors-origins", "", "comma separated origins of third-party frontends allowed to call the API, * allows any")
+	flag.Parse()
 
-	sm := session.NewSessionsManager()
+	var store kv.Store = kv.NewMemoryStore()
+	if *kvAddr != "" {
+		redisStore := kv.NewRedisStore(*kvAddr, 16)
+		errPing := redisStore.Ping()
+		if errPing != nil {
+			fmt.Println("kv store error:", errPing)
+			return
+		}
+		defer redisStore.Close()
+		store = redisStore
+	}
+	sm := session.NewSessionsManager(store)
 
-	userRepo := user.NewMemoryRepo()
-	postRepo := post.NewMemoryRepo()
-	commentRepo := comment.NewMemoryRepo()
+	// with a kv store the repositories keep their content there,
+	// so several instances behind one address serve the same site
+	var (
+		userRepo      user.UserRepo           = user.NewMemoryRepo(splitList(*admins)...)
+		postRepo      post.PostRepo           = post.NewMemoryRepo()
+		commentRepo   comment.CommentRepo     = comment.NewMemoryRepo()
+		categoryRepo  category.CategoryRepo   = category.NewMemoryRepo()
+		messageRepo   message.MessageRepo     = message.NewMemoryRepo()
+		auditRepo     audit.AuditRepo         = audit.NewMemoryRepo()
+		tokenRepo     token.TokenRepo         = token.NewMemoryRepo()
+		twoFactorBase twofactor.TwoFactorRepo = twofactor.NewMemoryRepo()
+	)
+	if *kvAddr != "" {
+		userRepo = user.NewSharedRepo(store, splitList(*admins)...)
+		postRepo = post.NewSharedRepo(store)
+		commentRepo = comment.NewSharedRepo(store)
+		categoryRepo = category.NewSharedRepo(store)
+		messageRepo = message.NewSharedRepo(store)
+		auditRepo = audit.NewSharedRepo(store)
+		tokenRepo = token.NewSharedRepo(store)
+		twoFactorBase = twofactor.NewSharedRepo(store)
+	}
+	// five wrong codes lock the second factor of the account for a quarter of an hour
+	twoFactorRepo := twofactor.NewLockout(twoFactorBase, store, 5, 15*time.Minute)
 
 	zapLogger, err := zap.NewProduction()
 	if err != nil {
@@ -38,37 +95,217 @@ func main() {
 	}()
 	logger := zapLogger.Sugar()
 
+	spamRules := spam.DefaultConfig()
+	if *spamConfig != "" {
+		spamRules, err = spam.LoadConfig(*spamConfig)
+		if err != nil {
+			fmt.Println("spam config error:", err)
+			return
+		}
+	}
+	spamPipeline, err := spamRules.Pipeline(store)
+	if err != nil {
+		fmt.Println("spam config error:", err)
+		return
+	}
+
+	providers := make(map[string]*oauth.Provider)
+	if *oauthConfig != "" {
+		providers, err = oauth.LoadProviders(*oauthConfig)
+		if err != nil {
+			fmt.Println("oauth config error:", err)
+			return
+		}
+	}
+
+	go func() {
+		for {
+			errListen := sm.Listen(context.Background())
+			logger.Infow("Session revocations are not synced", "err", errListen)
+			time.Sleep(time.Second)
+		}
+	}()
+	viewCounter := views.NewCounter(postRepo, 30*time.Minute)
+	if *kvAddr != "" {
+		viewCounter = views.NewSharedCounter(postRepo, store, 30*time.Minute)
+	}
+	go viewCounter.Run(context.Background(), 10*time.Second, func(err error) {
+		logger.Infow("Error in flushing views", "err", err)
+	})
+	scheduler := post.NewScheduler(postRepo, clock.Real{})
+	go scheduler.Run(context.Background(), 30*time.Second, func(err error) {
+		logger.Infow("Error in publishing scheduled posts", "err", err)
+	})
+
 	userHandler := &handlers.UserHandler{
+		UserRepo:      userRepo,
+		AuditRepo:     auditRepo,
+		TwoFactorRepo: twoFactorRepo,
+		Logger:        logger,
+		Sessions:      sm,
+	}
+	postHandler := &handlers.PostHandler{
+		PostRepo:     postRepo,
+		CommentRepo:  commentRepo,
+		CategoryRepo: categoryRepo,
+		UserRepo:     userRepo,
+		AuditRepo:    auditRepo,
+		Logger:       logger,
+		Sessions:     sm,
+		Spam:         spamPipeline,
+		Cache:        httpcache.New(*responseCache),
+		Views:        viewCounter,
+
+		VoteBurstWindow: time.Minute,
+		VoteBurstLimit:  30,
+	}
+	categoryHandler := &handlers.CategoryHandler{
+		CategoryRepo: categoryRepo,
+		UserRepo:     userRepo,
+		AuditRepo:    auditRepo,
+		Logger:       logger,
+	}
+	messageHandler := &handlers.MessageHandler{
+		MessageRepo: messageRepo,
+		UserRepo:    userRepo,
+		AuditRepo:   auditRepo,
+		Logger:      logger,
+	}
+	auditHandler := &handlers.AuditHandler{
+		AuditRepo: auditRepo,
+		UserRepo:  userRepo,
+		Logger:    logger,
+	}
+	tokenHandler := &handlers.TokenHandler{
+		TokenRepo: tokenRepo,
+		AuditRepo: auditRepo,
+		Logger:    logger,
+	}
+	oauthHandler := &handlers.OAuthHandler{
+		Providers: providers,
+		States:    oauth.NewStateStore(store, 10*time.Minute),
+		UserRepo:  userRepo,
+		AuditRepo: auditRepo,
+		Sessions:  sm,
+		Logger:    logger,
+
+		TwoFactorRepo: twoFactorRepo,
+	}
+	accountHandler := &handlers.AccountHandler{
+		UserRepo:      userRepo,
+		PostRepo:      postRepo,
+		CommentRepo:   commentRepo,
+		MessageRepo:   messageRepo,
+		CategoryRepo:  categoryRepo,
+		TokenRepo:     tokenRepo,
+		TwoFactorRepo: twoFactorRepo,
+		AuditRepo:     auditRepo,
+		Sessions:      sm,
+		Logger:        logger,
+	}
+	feedHandler := &handlers.FeedHandler{
+		PostRepo: postRepo,
 		UserRepo: userRepo,
 		Logger:   logger,
-		Sessions: sm,
+		SiteURL:  strings.TrimSuffix(*siteURL, "/"),
 	}
-	postHandler := &handlers.PostHandler{
+	twoFactorHandler := &handlers.TwoFactorHandler{
+		TwoFactorRepo: twoFactorRepo,
+		UserRepo:      userRepo,
+		AuditRepo:     auditRepo,
+		Sessions:      sm,
+		Logger:        logger,
+		Issuer:        "redditclone",
+	}
+	graphqlHandler, err := handlers.NewGraphQLHandler(logger, postHandler)
+	if err != nil {
+		fmt.Println("graphql schema error:", err)
+		return
+	}
+	adminHandler := &handlers.AdminHandler{
 		PostRepo:    postRepo,
 		CommentRepo: commentRepo,
+		UserRepo:    userRepo,
 		Logger:      logger,
-		Sessions:    sm,
+	}
+
+	// handlers return their errors, the response for them is written in one place
+	errs := func(handler apierr.HandlerFunc) http.Handler {
+		return middleware.Errors(logger, handler)
+	}
+	scoped := func(scope string, handler apierr.HandlerFunc) http.Handler {
+		return middleware.Scope(scope, errs(handler))
 	}
 
 	r := mux.NewRouter()
 	// =============================== POST ===============================
-	r.HandleFunc("/api/login", userHandler.Login).Methods("POST")
-	r.HandleFunc("/api/register", userHandler.Register).Methods("POST")
-	r.HandleFunc("/api/posts", postHandler.AddPost).Methods("POST")
-	r.HandleFunc("/api/post/{POST_ID}", postHandler.AddComment).Methods("POST")
+	r.Handle("/api/login", errs(userHandler.Login)).Methods("POST")
+	r.Handle("/api/login/2fa", errs(twoFactorHandler.Login)).Methods("POST")
+	r.Handle("/api/register", errs(userHandler.Register)).Methods("POST")
+	r.Handle("/api/logout", errs(userHandler.Logout)).Methods("POST")
+	r.Handle("/api/posts", scoped(token.ScopePost, postHandler.AddPost)).Methods("POST")
+	r.Handle("/api/post/{POST_ID}", scoped(token.ScopeComment, postHandler.AddComment)).Methods("POST")
+	r.Handle("/api/post/{POST_ID}/crosspost", scoped(token.ScopePost, postHandler.Crosspost)).Methods("POST")
+	r.Handle("/api/post/{POST_ID}/poll", scoped(token.ScopeVote, postHandler.VotePoll)).Methods("POST")
+	r.Handle("/api/post/{POST_ID}/state", scoped(token.ScopeManage, postHandler.SetState)).Methods("POST")
+	r.Handle("/api/post/{POST_ID}/vote", scoped(token.ScopeVote, postHandler.Vote)).Methods("POST", "PUT")
+	r.Handle("/api/post/{POST_ID}/unhide", scoped(token.ScopeManage, postHandler.UnhidePost)).Methods("POST")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}/unhide", scoped(token.ScopeManage, postHandler.UnhideComment)).Methods("POST")
+	r.Handle("/api/category/{CATEGORY_NAME}/moderators", scoped(token.ScopeManage, categoryHandler.AddModerator)).Methods("POST")
+	r.Handle("/api/messages/{USER_LOGIN}", scoped(token.ScopeMessage, messageHandler.Send)).Methods("POST")
+	r.Handle("/api/messages/{USER_LOGIN}/read", scoped(token.ScopeMessage, messageHandler.MarkRead)).Methods("POST")
+	r.Handle("/api/blocks/{USER_LOGIN}", scoped(token.ScopeMessage, messageHandler.Block)).Methods("POST")
+	r.Handle("/api/admin/consistency", scoped(token.ScopeManage, adminHandler.FixConsistency)).Methods("POST")
+	r.Handle("/api/tokens", errs(tokenHandler.CreateToken)).Methods("POST")
+	r.Handle("/api/2fa/enroll", errs(twoFactorHandler.Enroll)).Methods("POST")
+	r.Handle("/api/2fa/enable", errs(twoFactorHandler.Enable)).Methods("POST")
+	r.Handle("/api/2fa/disable", errs(twoFactorHandler.Disable)).Methods("POST")
+	r.Handle("/graphql", errs(graphqlHandler.Serve)).Methods("POST")
 
 	// ================================ GET ===============================
-	r.HandleFunc("/api/posts/", postHandler.GetPosts).Methods("GET")
-	r.HandleFunc("/api/posts/{CATEGORY_NAME}", postHandler.GetCategoryPosts).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}", postHandler.GetPostAndComment).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}/upvote", postHandler.Rating).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}/downvote", postHandler.Rating).Methods("GET")
-	r.HandleFunc("/api/post/{POST_ID}/unvote", postHandler.Rating).Methods("GET")
-	r.HandleFunc("/api/user/{USER_LOGIN}", postHandler.UserPosts).Methods("GET")
+	r.Handle("/api/posts/", errs(postHandler.GetPosts)).Methods("GET")
+	r.Handle("/api/posts/{CATEGORY_NAME}", errs(postHandler.GetCategoryPosts)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}", errs(postHandler.GetPostAndComment)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/discussions", errs(postHandler.OtherDiscussions)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/poll", errs(postHandler.GetPoll)).Methods("GET")
+	r.Handle("/api/post/{POST_ID}/stats", scoped(token.ScopeRead, postHandler.Stats)).Methods("GET")
+	if *legacyVotes {
+		r.Handle("/api/post/{POST_ID}/upvote", scoped(token.ScopeVote, postHandler.Rating)).Methods("GET")
+		r.Handle("/api/post/{POST_ID}/downvote", scoped(token.ScopeVote, postHandler.Rating)).Methods("GET")
+		r.Handle("/api/post/{POST_ID}/unvote", scoped(token.ScopeVote, postHandler.Rating)).Methods("GET")
+	}
+	r.Handle("/api/user/{USER_LOGIN}", errs(postHandler.UserPosts)).Methods("GET")
+	r.Handle("/api/category/{CATEGORY_NAME}", errs(categoryHandler.GetCategory)).Methods("GET")
+	r.Handle("/api/category/{CATEGORY_NAME}/hidden", scoped(token.ScopeManage, postHandler.GetHidden)).Methods("GET")
+	r.Handle("/api/profile/settings", scoped(token.ScopeRead, userHandler.GetSettings)).Methods("GET")
+	r.Handle("/api/inbox", scoped(token.ScopeMessage, messageHandler.GetConversations)).Methods("GET")
+	r.Handle("/api/inbox/unread", scoped(token.ScopeMessage, messageHandler.UnreadCount)).Methods("GET")
+	r.Handle("/api/messages/{USER_LOGIN}", scoped(token.ScopeMessage, messageHandler.GetConversation)).Methods("GET")
+	r.Handle("/api/blocks", scoped(token.ScopeMessage, messageHandler.GetBlocked)).Methods("GET")
+	r.Handle("/api/admin/audit", scoped(token.ScopeManage, auditHandler.Query)).Methods("GET")
+	r.Handle("/api/admin/consistency", scoped(token.ScopeManage, adminHandler.CheckConsistency)).Methods("GET")
+	r.Handle("/api/admin/stats", scoped(token.ScopeManage, adminHandler.Stats)).Methods("GET")
+	r.Handle("/api/tokens", errs(tokenHandler.GetTokens)).Methods("GET")
+	r.Handle("/api/2fa", errs(twoFactorHandler.GetStatus)).Methods("GET")
+	r.Handle("/api/profile/export", errs(accountHandler.Export)).Methods("GET")
+	r.Handle("/feeds/all.atom", errs(feedHandler.All)).Methods("GET")
+	r.Handle("/feeds/r/{CATEGORY}.atom", errs(feedHandler.Category)).Methods("GET")
+	r.Handle("/feeds/u/{LOGIN}.atom", errs(feedHandler.User)).Methods("GET")
+	r.Handle("/api/oauth/{PROVIDER}/login", errs(oauthHandler.Login)).Methods("GET")
+	r.Handle("/api/oauth/{PROVIDER}/callback", errs(oauthHandler.Callback)).Methods("GET")
+	// mutations are refused over GET, the schema is printed without a query
+	r.Handle("/graphql", errs(graphqlHandler.Serve)).Methods("GET")
+
+	// ================================ PUT ===============================
+	r.Handle("/api/category/{CATEGORY_NAME}/flairs", scoped(token.ScopeManage, categoryHandler.SetFlairs)).Methods("PUT")
+	r.Handle("/api/profile/settings", errs(userHandler.UpdateSettings)).Methods("PUT")
 
 	// ============================== DELETE ==============================
-	r.HandleFunc("/api/post/{POST_ID}", postHandler.DelPost).Methods("DELETE")
-	r.HandleFunc("/api/post/{POST_ID}/{COMMENT_ID}", postHandler.DelComment).Methods("DELETE")
+	r.Handle("/api/post/{POST_ID}", scoped(token.ScopePost, postHandler.DelPost)).Methods("DELETE")
+	r.Handle("/api/post/{POST_ID}/{COMMENT_ID}", scoped(token.ScopeComment, postHandler.DelComment)).Methods("DELETE")
+	r.Handle("/api/blocks/{USER_LOGIN}", scoped(token.ScopeMessage, messageHandler.Unblock)).Methods("DELETE")
+	r.Handle("/api/tokens/{TOKEN_ID}", errs(tokenHandler.RevokeToken)).Methods("DELETE")
+	r.Handle("/api/profile", errs(accountHandler.Delete)).Methods("DELETE")
 
 	// ============================== STATIC ==============================
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))))
@@ -88,7 +325,16 @@ func main() {
 		}
 	})
 
-	mux := middleware.Auth(sm, r)
+	page, errPage := ioutil.ReadFile("./static/html/index.html")
+	if errPage != nil {
+		logger.Infow("Error in Read, inline scripts of the page are blocked", errPage)
+	}
+
+	mux := middleware.Auth(sm, tokenRepo, r)
+	mux = middleware.BodyLimit(middleware.DefaultMaxBody, mux)
+	mux = middleware.CSRF(middleware.DefaultCSRFConfig(session.CookieName), mux)
+	mux = middleware.CORS(middleware.DefaultCORSConfig(splitList(*corsOrigins)...), mux)
+	mux = middleware.SecurityHeaders(middleware.DefaultSecurityConfig(page), mux)
 	mux = middleware.AccessLog(logger, mux)
 	mux = middleware.Panic(mux)
 
@@ -104,3 +350,14 @@ func main() {
 	}
 
 }
+
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
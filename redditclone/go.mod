@@ -6,6 +6,7 @@ require (
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/google/uuid v1.3.0
 	github.com/gorilla/mux v1.7.3
+	github.com/graph-gophers/graphql-go v1.5.0
 	go.uber.org/zap v1.12.0
 )
 
@@ -0,0 +1,98 @@
+// Package apierr holds the errors handlers return instead of writing them,
+// middleware.Errors turns them into one JSON body
+package apierr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// HandlerFunc writes only successful responses, failures are returned
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// Field points at a bad part of the request, the frontend shows "param msg"
+type Field struct {
+	Location string `json:"location"`
+	Param    string `json:"param"`
+	Msg      string `json:"msg"`
+	Value    string `json:"value,omitempty"`
+}
+
+type Error struct {
+	Status  int
+	Message string
+	Fields  []Field
+	// Cause is logged, clients never see it
+	Cause error
+}
+
+// Envelope is the body of every error response
+type Envelope struct {
+	Status  int     `json:"status"`
+	Message string  `json:"message"`
+	Errors  []Field `json:"errors,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+func New(status int, message string) *Error {
+	return &Error{Status: status, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, message)
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, message)
+}
+
+func Validation(fields ...Field) *Error {
+	return &Error{Status: http.StatusUnprocessableEntity, Message: "validation failed", Fields: fields}
+}
+
+func Internal(message string, cause error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Message: message, Cause: cause}
+}
+
+// From gives the typed error behind err, anything else is an internal error without details
+func From(err error) *Error {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed
+	}
+	return Internal("internal server error", err)
+}
+
+func Write(w http.ResponseWriter, err error) error {
+	typed := From(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(typed.Status)
+	return json.NewEncoder(w).Encode(Envelope{
+		Status:  typed.Status,
+		Message: typed.Message,
+		Errors:  typed.Fields,
+	})
+}
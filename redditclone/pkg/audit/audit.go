@@ -0,0 +1,63 @@
+package audit
+
+import "time"
+
+const (
+	ActionRegister         = "register"
+	ActionLogin            = "login"
+	ActionLoginFailed      = "login_failed"
+	ActionPostDelete       = "post_delete"
+	ActionCommentDelete    = "comment_delete"
+	ActionSettingsEdit     = "settings_edit"
+	ActionFlairsEdit       = "flairs_edit"
+	ActionModeratorAdd     = "moderator_add"
+	ActionUserBlock        = "user_block"
+	ActionTokenCreate      = "token_create"
+	ActionTokenRevoke      = "token_revoke"
+	ActionOAuthLogin       = "oauth_login"
+	ActionTwoFactorEnable  = "2fa_enable"
+	ActionTwoFactorDisable = "2fa_disable"
+	ActionAccountDelete    = "account_delete"
+	ActionPostState        = "post_state"
+	ActionUnhide           = "unhide"
+)
+
+type Entry struct {
+	ID       string    `json:"id"`
+	Actor    string    `json:"actor"`
+	Action   string    `json:"action"`
+	TargetID string    `json:"targetId"`
+	Time     time.Time `json:"time"`
+	IP       string    `json:"ip"`
+}
+
+// Filter matches entries by every non-zero field, From is inclusive and To is exclusive
+type Filter struct {
+	Actor    string
+	Action   string
+	TargetID string
+	From     time.Time
+	To       time.Time
+}
+
+func (f Filter) Match(entry Entry) bool {
+	switch {
+	case f.Actor != "" && entry.Actor != f.Actor:
+		return false
+	case f.Action != "" && entry.Action != f.Action:
+		return false
+	case f.TargetID != "" && entry.TargetID != f.TargetID:
+		return false
+	case !f.From.IsZero() && entry.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !entry.Time.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// AuditRepo is append-only: recorded entries can never be changed or removed
+type AuditRepo interface {
+	Append(entry Entry) (Entry, error)
+	Query(filter Filter) ([]Entry, error)
+}
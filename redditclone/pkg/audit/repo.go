@@ -0,0 +1,48 @@
+package audit
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrNoAction = errors.New("audit entry without action")
+
+type AuditMemoryRepository struct {
+	data  []Entry
+	mutex sync.RWMutex
+}
+
+func NewMemoryRepo() *AuditMemoryRepository {
+	return &AuditMemoryRepository{
+		data:  make([]Entry, 0, 100),
+		mutex: sync.RWMutex{},
+	}
+}
+
+func (repo *AuditMemoryRepository) Append(entry Entry) (Entry, error) {
+	if entry.Action == "" {
+		return Entry{}, ErrNoAction
+	}
+	entry.ID = uuid.New().String()
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	// time is taken under the lock so the log stays ordered
+	entry.Time = time.Now()
+	repo.data = append(repo.data, entry)
+	return entry, nil
+}
+
+func (repo *AuditMemoryRepository) Query(filter Filter) ([]Entry, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	entries := make([]Entry, 0)
+	for _, entry := range repo.data {
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryKeepsOrderAndFilters(t *testing.T) {
+	repo := NewMemoryRepo()
+	if _, err := repo.Append(Entry{Actor: "alice"}); err != ErrNoAction {
+		t.Errorf("entry without action got %v", err)
+	}
+	repo.Append(Entry{Actor: "alice", Action: ActionLogin, TargetID: "a"})
+	middle, _ := repo.Append(Entry{Actor: "bob", Action: ActionPostDelete, TargetID: "p1"})
+	repo.Append(Entry{Actor: "alice", Action: ActionPostDelete, TargetID: "p2"})
+
+	all, _ := repo.Query(Filter{})
+	if len(all) != 3 {
+		t.Fatalf("got %d entries, expected 3", len(all))
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].Time.Before(all[i-1].Time) {
+			t.Errorf("entry %d is older than the one before it", i)
+		}
+	}
+	if all[1].ID != middle.ID {
+		t.Errorf("entries are not in the order they were appended")
+	}
+
+	cases := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"actor", Filter{Actor: "alice"}, []string{"a", "p2"}},
+		{"action", Filter{Action: ActionPostDelete}, []string{"p1", "p2"}},
+		{"actor and action", Filter{Actor: "alice", Action: ActionPostDelete}, []string{"p2"}},
+		{"target", Filter{TargetID: "p1"}, []string{"p1"}},
+		{"from is inclusive", Filter{From: middle.Time}, []string{"p1", "p2"}},
+		{"to is exclusive", Filter{To: middle.Time}, []string{"a"}},
+		{"future", Filter{From: time.Now().Add(time.Hour)}, []string{}},
+	}
+	for _, item := range cases {
+		entries, _ := repo.Query(item.filter)
+		got := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			got = append(got, entry.TargetID)
+		}
+		if len(got) != len(item.want) {
+			t.Errorf("%s: got %v, expected %v", item.name, got, item.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != item.want[i] {
+				t.Errorf("%s: got %v, expected %v", item.name, got, item.want)
+				break
+			}
+		}
+	}
+}
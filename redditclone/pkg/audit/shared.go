@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"redditclone/pkg/kv"
+)
+
+// auditState is a snapshot of the repository
+type auditState struct {
+	Data []Entry
+}
+
+func (repo *AuditMemoryRepository) Snapshot() ([]byte, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	buf := &bytes.Buffer{}
+	errEncode := gob.NewEncoder(buf).Encode(auditState{Data: repo.data})
+	return buf.Bytes(), errEncode
+}
+
+func (repo *AuditMemoryRepository) Restore(data []byte) error {
+	state := auditState{}
+	if len(data) > 0 {
+		if errDecode := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); errDecode != nil {
+			return errDecode
+		}
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.data = append(make([]Entry, 0, len(state.Data)+100), state.Data...)
+	return nil
+}
+
+// SharedRepository keeps one log for all instances, entries are appended
+// under the lock of the store so the log stays ordered across instances
+type SharedRepository struct {
+	local  *AuditMemoryRepository
+	shared *kv.Shared
+}
+
+func NewSharedRepo(store kv.Store) *SharedRepository {
+	local := NewMemoryRepo()
+	return &SharedRepository{
+		local:  local,
+		shared: kv.NewShared(store, "audit", local),
+	}
+}
+
+func (repo *SharedRepository) Append(entry Entry) (appended Entry, errWrite error) {
+	errWrite = repo.shared.Write(func() (errAppend error) {
+		appended, errAppend = repo.local.Append(entry)
+		return errAppend
+	})
+	return appended, errWrite
+}
+
+func (repo *SharedRepository) Query(filter Filter) ([]Entry, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.Query(filter)
+}
@@ -0,0 +1,27 @@
+package audit
+
+import (
+	"testing"
+
+	"redditclone/pkg/kv"
+)
+
+func TestSharedLogKeepsOrder(t *testing.T) {
+	store := kv.NewMemoryStore()
+	var first, second AuditRepo = NewSharedRepo(store), NewSharedRepo(store)
+	for idx, repo := range []AuditRepo{first, second, first} {
+		if _, err := repo.Append(Entry{Actor: "admin", Action: ActionPostDelete, TargetID: string(rune('a' + idx))}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	entries, err := second.Query(Filter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 3 || entries[0].TargetID != "a" || entries[2].TargetID != "c" {
+		t.Fatalf("got entries %+v", entries)
+	}
+	if entries[1].Time.Before(entries[0].Time) || entries[2].Time.Before(entries[1].Time) {
+		t.Errorf("entries are out of order")
+	}
+}
@@ -0,0 +1,17 @@
+package category
+
+type Category struct {
+	Name       string   `json:"name"`
+	Flairs     []string `json:"flairs"`
+	Moderators []string `json:"moderators"`
+}
+
+type CategoryRepo interface {
+	Get(name string) (Category, error)
+	SetFlairs(name string, flairs []string) (Category, error)
+	AddModerator(name string, login string) (Category, error)
+	// RemoveModerator takes the user off the moderators of every category
+	RemoveModerator(login string) (int, error)
+	IsModerator(name string, login string) bool
+	IsAllowedFlair(name string, flair string) bool
+}
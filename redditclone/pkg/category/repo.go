@@ -0,0 +1,129 @@
+package category
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+const MaxFlairs = 20
+
+var (
+	ErrBadFlair     = errors.New("bad flair")
+	ErrTooManyFlair = errors.New("too many flairs")
+)
+
+type CategoryMemoryRepository struct {
+	data  map[string]Category
+	mutex sync.RWMutex
+}
+
+func NewMemoryRepo() *CategoryMemoryRepository {
+	return &CategoryMemoryRepository{
+		data:  make(map[string]Category),
+		mutex: sync.RWMutex{},
+	}
+}
+
+// Get never fails: a category nobody has configured yet simply has no flairs and no moderators
+func (repo *CategoryMemoryRepository) Get(name string) (Category, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	return repo.copyOf(name), nil
+}
+
+func (repo *CategoryMemoryRepository) SetFlairs(name string, flairs []string) (Category, error) {
+	if len(flairs) > MaxFlairs {
+		return Category{}, ErrTooManyFlair
+	}
+	unique := make([]string, 0, len(flairs))
+	seen := make(map[string]bool, len(flairs))
+	for _, flair := range flairs {
+		flair = strings.TrimSpace(flair)
+		if flair == "" {
+			return Category{}, ErrBadFlair
+		}
+		if !seen[flair] {
+			seen[flair] = true
+			unique = append(unique, flair)
+		}
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	cat := repo.copyOf(name)
+	cat.Flairs = unique
+	repo.data[name] = cat
+	return cat, nil
+}
+
+func (repo *CategoryMemoryRepository) AddModerator(name string, login string) (Category, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	cat := repo.copyOf(name)
+	for _, moderator := range cat.Moderators {
+		if moderator == login {
+			return cat, nil
+		}
+	}
+	cat.Moderators = append(cat.Moderators, login)
+	repo.data[name] = cat
+	return cat, nil
+}
+
+func (repo *CategoryMemoryRepository) RemoveModerator(login string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	removed := 0
+	for name := range repo.data {
+		cat := repo.copyOf(name)
+		moderators := make([]string, 0, len(cat.Moderators))
+		for _, moderator := range cat.Moderators {
+			if moderator != login {
+				moderators = append(moderators, moderator)
+			}
+		}
+		if len(moderators) != len(cat.Moderators) {
+			removed++
+			cat.Moderators = moderators
+			repo.data[name] = cat
+		}
+	}
+	return removed, nil
+}
+
+func (repo *CategoryMemoryRepository) IsModerator(name string, login string) bool {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	for _, moderator := range repo.data[name].Moderators {
+		if moderator == login {
+			return true
+		}
+	}
+	return false
+}
+
+func (repo *CategoryMemoryRepository) IsAllowedFlair(name string, flair string) bool {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	for _, item := range repo.data[name].Flairs {
+		if item == flair {
+			return true
+		}
+	}
+	return false
+}
+
+// copyOf must be called with the mutex held
+func (repo *CategoryMemoryRepository) copyOf(name string) Category {
+	cat, ok := repo.data[name]
+	if !ok {
+		return Category{
+			Name:       name,
+			Flairs:     make([]string, 0),
+			Moderators: make([]string, 0),
+		}
+	}
+	cat.Flairs = append(make([]string, 0, len(cat.Flairs)), cat.Flairs...)
+	cat.Moderators = append(make([]string, 0, len(cat.Moderators)), cat.Moderators...)
+	return cat
+}
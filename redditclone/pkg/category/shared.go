@@ -0,0 +1,99 @@
+package category
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"redditclone/pkg/kv"
+)
+
+// categoryState is a snapshot of the repository
+type categoryState struct {
+	Data map[string]Category
+}
+
+func (repo *CategoryMemoryRepository) Snapshot() ([]byte, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	buf := &bytes.Buffer{}
+	errEncode := gob.NewEncoder(buf).Encode(categoryState{Data: repo.data})
+	return buf.Bytes(), errEncode
+}
+
+// Restore may leave empty lists nil, copyOf hands out empty ones anyway
+func (repo *CategoryMemoryRepository) Restore(data []byte) error {
+	state := categoryState{}
+	if len(data) > 0 {
+		if errDecode := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); errDecode != nil {
+			return errDecode
+		}
+	}
+	if state.Data == nil {
+		state.Data = make(map[string]Category)
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.data = state.Data
+	return nil
+}
+
+// SharedRepository serves the flairs and moderators every instance sets through the store
+type SharedRepository struct {
+	local  *CategoryMemoryRepository
+	shared *kv.Shared
+}
+
+func NewSharedRepo(store kv.Store) *SharedRepository {
+	local := NewMemoryRepo()
+	return &SharedRepository{
+		local:  local,
+		shared: kv.NewShared(store, "categories", local),
+	}
+}
+
+// ================================ GET ===============================
+func (repo *SharedRepository) Get(name string) (Category, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return Category{}, errSync
+	}
+	return repo.local.Get(name)
+}
+
+// IsModerator refuses when the store fails, rights taken away elsewhere may not be loaded yet
+func (repo *SharedRepository) IsModerator(name string, login string) bool {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return false
+	}
+	return repo.local.IsModerator(name, login)
+}
+
+func (repo *SharedRepository) IsAllowedFlair(name string, flair string) bool {
+	repo.shared.Sync()
+	return repo.local.IsAllowedFlair(name, flair)
+}
+
+// =============================== POST ===============================
+func (repo *SharedRepository) SetFlairs(name string, flairs []string) (updated Category, errWrite error) {
+	errWrite = repo.shared.Write(func() (errSet error) {
+		updated, errSet = repo.local.SetFlairs(name, flairs)
+		return errSet
+	})
+	return updated, errWrite
+}
+
+func (repo *SharedRepository) AddModerator(name string, login string) (updated Category, errWrite error) {
+	errWrite = repo.shared.Write(func() (errAdd error) {
+		updated, errAdd = repo.local.AddModerator(name, login)
+		return errAdd
+	})
+	return updated, errWrite
+}
+
+// ============================== DELETE ==============================
+func (repo *SharedRepository) RemoveModerator(login string) (removed int, errWrite error) {
+	errWrite = repo.shared.Write(func() (errRemove error) {
+		removed, errRemove = repo.local.RemoveModerator(login)
+		return errRemove
+	})
+	return removed, errWrite
+}
@@ -0,0 +1,28 @@
+package category
+
+import (
+	"testing"
+
+	"redditclone/pkg/kv"
+)
+
+func TestSharedRepoAcrossInstances(t *testing.T) {
+	store := kv.NewMemoryStore()
+	var first, second CategoryRepo = NewSharedRepo(store), NewSharedRepo(store)
+	if _, err := first.AddModerator("music", "bob"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := second.SetFlairs("music", []string{"live"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !first.IsModerator("music", "bob") || !first.IsAllowedFlair("music", "live") {
+		t.Errorf("changes of the other instance are missing")
+	}
+	if removed, _ := second.RemoveModerator("bob"); removed != 1 {
+		t.Errorf("removed %d, expected 1", removed)
+	}
+	cat, _ := first.Get("music")
+	if first.IsModerator("music", "bob") || cat.Moderators == nil || len(cat.Moderators) != 0 {
+		t.Errorf("got category %+v", cat)
+	}
+}
@@ -0,0 +1,82 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock lets background jobs be driven by a fake time in tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+func (Real) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type waiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// Fake only moves when Advance is called
+type Fake struct {
+	now     time.Time
+	waiters []waiter
+	mutex   sync.Mutex
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now:   now,
+		mutex: sync.Mutex{},
+	}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, waiter{deadline: f.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the time forward and fires every After whose deadline has passed
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+	pending := f.waiters[:0]
+	for _, item := range f.waiters {
+		if item.deadline.After(f.now) {
+			pending = append(pending, item)
+			continue
+		}
+		item.ch <- f.now
+	}
+	f.waiters = pending
+}
+
+// Waiters tells tests how many After calls are blocked, so they can wait for a goroutine to park
+func (f *Fake) Waiters() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.waiters)
+}
@@ -1,17 +1,37 @@
 package comment
 
-import "redditclone/pkg/user"
+import (
+	"time"
+
+	"redditclone/pkg/user"
+)
 
 type Comment struct {
-	Author  user.User `json:"author"`
-	Body    string    `json:"body"`
-	Created string    `json:"created"`
-	ID      string    `json:"id"`
+	Author   user.User `json:"author"`
+	Body     string    `json:"body"`
+	BodyHTML string    `json:"bodyHtml"`
+	Created  string    `json:"created"`
+	ID       string    `json:"id"`
+	Hidden   bool      `json:"-"`
 }
 
+// CommentRepo is the only place comments are stored, posts get them at read time.
+// Returned comments must not be modified.
 type CommentRepo interface {
 	Get(commentID string, postID string) (*Comment, error)
-	Create(text string, author *user.User, postID string) (*Comment, error)
-	Delete(comments []*Comment, commentID string, postID string) (int, error)
+	GetAll(postID string) ([]*Comment, error)
+	// GetByPosts groups the comments of several posts by post id in one call
+	GetByPosts(postIDs []string) (map[string][]*Comment, error)
+	GetPostIDs() ([]string, error)
+	// GetUserComments groups the comments of the user by post id
+	GetUserComments(userLogin string) (map[string][]*Comment, error)
+	Create(text string, author *user.User, postID string, hidden bool) (*Comment, error)
+	// SetHidden shows or shadow hides the comment, moderators use it to undo spam verdicts
+	SetHidden(commentID string, postID string, hidden bool) (*Comment, error)
+	Delete(commentID string, postID string) error
 	DeleteAll(postID string)
+	// Anonymize hands the comments of the user over to the deleted placeholder and wipes their bodies
+	Anonymize(userLogin string) (int, error)
+	// Revision grows with every change of the stored comments, modified is the time of the last change
+	Revision() (revision uint64, modified time.Time)
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 
+	"redditclone/pkg/markdown"
 	"redditclone/pkg/user"
 )
 
@@ -17,20 +18,22 @@ var (
 )
 
 type CommentMemoryRepository struct {
-	data  map[string][]*Comment
-	mutex sync.Mutex
+	data     map[string][]*Comment
+	revision uint64
+	modified time.Time
+	mutex    sync.RWMutex
 }
 
 func NewMemoryRepo() *CommentMemoryRepository {
 	return &CommentMemoryRepository{
 		data:  make(map[string][]*Comment),
-		mutex: sync.Mutex{},
+		mutex: sync.RWMutex{},
 	}
 }
 
 func (commentRepo *CommentMemoryRepository) Get(commentID string, postID string) (*Comment, error) {
-	commentRepo.mutex.Lock()
-	defer commentRepo.mutex.Unlock()
+	commentRepo.mutex.RLock()
+	defer commentRepo.mutex.RUnlock()
 	for _, comment := range commentRepo.data[postID] {
 		if comment.ID == commentID {
 			return comment, nil
@@ -39,45 +42,152 @@ func (commentRepo *CommentMemoryRepository) Get(commentID string, postID string)
 	return nil, ErrNoComment
 }
 
+func (commentRepo *CommentMemoryRepository) GetAll(postID string) ([]*Comment, error) {
+	commentRepo.mutex.RLock()
+	defer commentRepo.mutex.RUnlock()
+	comments := commentRepo.data[postID]
+	return append(make([]*Comment, 0, len(comments)), comments...), nil
+}
+
+func (commentRepo *CommentMemoryRepository) GetByPosts(postIDs []string) (map[string][]*Comment, error) {
+	commentRepo.mutex.RLock()
+	defer commentRepo.mutex.RUnlock()
+	postComments := make(map[string][]*Comment, len(postIDs))
+	for _, postID := range postIDs {
+		comments := commentRepo.data[postID]
+		postComments[postID] = append(make([]*Comment, 0, len(comments)), comments...)
+	}
+	return postComments, nil
+}
+
+func (commentRepo *CommentMemoryRepository) GetPostIDs() ([]string, error) {
+	commentRepo.mutex.RLock()
+	defer commentRepo.mutex.RUnlock()
+	postIDs := make([]string, 0, len(commentRepo.data))
+	for postID := range commentRepo.data {
+		postIDs = append(postIDs, postID)
+	}
+	return postIDs, nil
+}
+
+func (commentRepo *CommentMemoryRepository) GetUserComments(userLogin string) (map[string][]*Comment, error) {
+	commentRepo.mutex.RLock()
+	defer commentRepo.mutex.RUnlock()
+	userComments := make(map[string][]*Comment)
+	for postID, comments := range commentRepo.data {
+		for _, comment := range comments {
+			if comment.Author.Login == userLogin {
+				userComments[postID] = append(userComments[postID], comment)
+			}
+		}
+	}
+	return userComments, nil
+}
+
 func (commentRepo *CommentMemoryRepository) Create(
 	text string,
 	author *user.User,
 	postID string,
+	hidden bool,
 ) (*Comment, error) {
-	commentRepo.mutex.Lock()
-	defer commentRepo.mutex.Unlock()
+	return commentRepo.insert(postID, newComment(text, author, hidden)), nil
+}
+
+// newComment fills the fields the repository owns, rendering is the slow part and takes no lock
+func newComment(text string, author *user.User, hidden bool) *Comment {
 	comment := new(Comment)
 	comment.ID = uuid.New().String()
 	comment.Author = *author
 	comment.Created = time.Now().Format(time.RFC3339)
 	comment.Body = text
+	comment.BodyHTML = markdown.Render(text)
+	comment.Hidden = hidden
+	return comment
+}
+
+func (commentRepo *CommentMemoryRepository) insert(postID string, comment *Comment) *Comment {
+	commentRepo.mutex.Lock()
+	defer commentRepo.mutex.Unlock()
 	if _, ok := commentRepo.data[postID]; ok {
 		commentRepo.data[postID] = append(commentRepo.data[postID], comment)
 	} else {
 		commentRepo.data[postID] = make([]*Comment, 1, 10)
 		commentRepo.data[postID][0] = comment
 	}
-	return comment, nil
+	commentRepo.touch()
+	return comment
 }
 
-func (commentRepo *CommentMemoryRepository) Delete(
-	comments []*Comment,
-	commentID string,
-	postID string,
-) (int, error) {
+func (commentRepo *CommentMemoryRepository) Anonymize(userLogin string) (int, error) {
+	placeholder := markdown.Render(user.DeletedLogin)
+	commentRepo.mutex.Lock()
+	defer commentRepo.mutex.Unlock()
+	anonymized := 0
+	for _, comments := range commentRepo.data {
+		for idx, comment := range comments {
+			if comment.Author.Login != userLogin {
+				continue
+			}
+			// returned comments are shared, so the stored one is replaced instead of modified
+			replacement := *comment
+			replacement.Author = user.Deleted()
+			replacement.Body = user.DeletedLogin
+			replacement.BodyHTML = placeholder
+			comments[idx] = &replacement
+			anonymized++
+		}
+	}
+	if anonymized > 0 {
+		commentRepo.touch()
+	}
+	return anonymized, nil
+}
+
+func (commentRepo *CommentMemoryRepository) SetHidden(commentID string, postID string, hidden bool) (*Comment, error) {
+	commentRepo.mutex.Lock()
+	defer commentRepo.mutex.Unlock()
+	for idx, comment := range commentRepo.data[postID] {
+		if comment.ID != commentID {
+			continue
+		}
+		// returned comments are shared, so the stored one is replaced instead of modified
+		replacement := *comment
+		replacement.Hidden = hidden
+		commentRepo.data[postID][idx] = &replacement
+		commentRepo.touch()
+		return &replacement, nil
+	}
+	return nil, ErrNoComment
+}
+
+func (commentRepo *CommentMemoryRepository) Delete(commentID string, postID string) error {
 	commentRepo.mutex.Lock()
 	defer commentRepo.mutex.Unlock()
-	for i, comment := range comments {
+	for i, comment := range commentRepo.data[postID] {
 		if comment.ID == commentID {
 			commentRepo.data[postID] = append(commentRepo.data[postID][:i], commentRepo.data[postID][i+1:]...)
-			return i, nil
+			commentRepo.touch()
+			return nil
 		}
 	}
-	return -1, ErrNoDel
+	return ErrNoDel
 }
 
 func (commentRepo *CommentMemoryRepository) DeleteAll(postID string) {
 	commentRepo.mutex.Lock()
 	defer commentRepo.mutex.Unlock()
 	delete(commentRepo.data, postID)
+	commentRepo.touch()
+}
+
+func (commentRepo *CommentMemoryRepository) Revision() (uint64, time.Time) {
+	commentRepo.mutex.RLock()
+	defer commentRepo.mutex.RUnlock()
+	return commentRepo.revision, commentRepo.modified
+}
+
+// touch must be called with the mutex held after every change
+func (commentRepo *CommentMemoryRepository) touch() {
+	commentRepo.revision++
+	commentRepo.modified = time.Now()
 }
@@ -0,0 +1,145 @@
+package comment
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"redditclone/pkg/kv"
+	"redditclone/pkg/user"
+)
+
+// commentState is a snapshot of the repository
+type commentState struct {
+	Data     map[string][]*Comment
+	Revision uint64
+	Modified time.Time
+}
+
+func (commentRepo *CommentMemoryRepository) Snapshot() ([]byte, error) {
+	commentRepo.mutex.RLock()
+	defer commentRepo.mutex.RUnlock()
+	buf := &bytes.Buffer{}
+	errEncode := gob.NewEncoder(buf).Encode(commentState{
+		Data:     commentRepo.data,
+		Revision: commentRepo.revision,
+		Modified: commentRepo.modified,
+	})
+	return buf.Bytes(), errEncode
+}
+
+func (commentRepo *CommentMemoryRepository) Restore(data []byte) error {
+	state := commentState{Data: make(map[string][]*Comment)}
+	if len(data) > 0 {
+		if errDecode := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); errDecode != nil {
+			return errDecode
+		}
+	}
+	commentRepo.mutex.Lock()
+	defer commentRepo.mutex.Unlock()
+	commentRepo.data = state.Data
+	commentRepo.revision = state.Revision
+	commentRepo.modified = state.Modified
+	return nil
+}
+
+// SharedRepository serves the comments every instance writes through the store,
+// the revision is part of the saved state like the one of posts
+type SharedRepository struct {
+	local  *CommentMemoryRepository
+	shared *kv.Shared
+}
+
+func NewSharedRepo(store kv.Store) *SharedRepository {
+	local := NewMemoryRepo()
+	return &SharedRepository{
+		local:  local,
+		shared: kv.NewShared(store, "comments", local),
+	}
+}
+
+// ================================ GET ===============================
+func (commentRepo *SharedRepository) Get(commentID string, postID string) (*Comment, error) {
+	if errSync := commentRepo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return commentRepo.local.Get(commentID, postID)
+}
+
+func (commentRepo *SharedRepository) GetAll(postID string) ([]*Comment, error) {
+	if errSync := commentRepo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return commentRepo.local.GetAll(postID)
+}
+
+func (commentRepo *SharedRepository) GetByPosts(postIDs []string) (map[string][]*Comment, error) {
+	if errSync := commentRepo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return commentRepo.local.GetByPosts(postIDs)
+}
+
+func (commentRepo *SharedRepository) GetPostIDs() ([]string, error) {
+	if errSync := commentRepo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return commentRepo.local.GetPostIDs()
+}
+
+func (commentRepo *SharedRepository) GetUserComments(userLogin string) (map[string][]*Comment, error) {
+	if errSync := commentRepo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return commentRepo.local.GetUserComments(userLogin)
+}
+
+// Revision of an unreachable store is the last one seen, the cache may serve it a little longer
+func (commentRepo *SharedRepository) Revision() (uint64, time.Time) {
+	commentRepo.shared.Sync()
+	return commentRepo.local.Revision()
+}
+
+// =============================== POST ===============================
+func (commentRepo *SharedRepository) Create(text string, author *user.User, postID string, hidden bool) (*Comment, error) {
+	comment := newComment(text, author, hidden)
+	errWrite := commentRepo.shared.Write(func() error {
+		commentRepo.local.insert(postID, comment)
+		return nil
+	})
+	if errWrite != nil {
+		return nil, errWrite
+	}
+	return comment, nil
+}
+
+func (commentRepo *SharedRepository) SetHidden(commentID string, postID string, hidden bool) (updated *Comment, errWrite error) {
+	errWrite = commentRepo.shared.Write(func() (errHide error) {
+		updated, errHide = commentRepo.local.SetHidden(commentID, postID, hidden)
+		return errHide
+	})
+	return updated, errWrite
+}
+
+func (commentRepo *SharedRepository) Anonymize(userLogin string) (anonymized int, errWrite error) {
+	errWrite = commentRepo.shared.Write(func() (errAnonymize error) {
+		anonymized, errAnonymize = commentRepo.local.Anonymize(userLogin)
+		return errAnonymize
+	})
+	return anonymized, errWrite
+}
+
+// ============================== DELETE ==============================
+func (commentRepo *SharedRepository) Delete(commentID string, postID string) error {
+	return commentRepo.shared.Write(func() error {
+		return commentRepo.local.Delete(commentID, postID)
+	})
+}
+
+// DeleteAll leaves the comments in place when the store fails, they belong to a deleted post nobody sees
+func (commentRepo *SharedRepository) DeleteAll(postID string) {
+	commentRepo.shared.Write(func() error {
+		commentRepo.local.DeleteAll(postID)
+		return nil
+	})
+}
@@ -0,0 +1,42 @@
+package comment
+
+import (
+	"testing"
+
+	"redditclone/pkg/kv"
+	"redditclone/pkg/user"
+)
+
+func TestSharedRepoAcrossInstances(t *testing.T) {
+	store := kv.NewMemoryStore()
+	var first, second CommentRepo = NewSharedRepo(store), NewSharedRepo(store)
+	author := &user.User{ID: "author", Login: "author"}
+
+	created, err := first.Create("**hi**", author, "post", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = second.SetHidden(created.ID, "post", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := first.Get(created.ID, "post")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Hidden || got.BodyHTML != "<p><strong>hi</strong></p>\n" {
+		t.Errorf("got comment %+v", got)
+	}
+	firstRevision, _ := first.Revision()
+	secondRevision, _ := second.Revision()
+	if firstRevision != 2 || secondRevision != 2 {
+		t.Errorf("got revisions %d and %d, expected 2", firstRevision, secondRevision)
+	}
+
+	if err = second.Delete("unknown", "post"); err != ErrNoDel {
+		t.Errorf("deleting an unknown comment got %v", err)
+	}
+	second.DeleteAll("post")
+	if comments, _ := first.GetAll("post"); len(comments) != 0 {
+		t.Errorf("comments of a deleted post survived: %+v", comments)
+	}
+}
@@ -0,0 +1,127 @@
+package feed
+
+import (
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"redditclone/pkg/post"
+	"redditclone/pkg/user"
+)
+
+const (
+	atomNS = "http://www.w3.org/2005/Atom"
+	// MaxEntries keeps feeds small, readers only need the newest posts
+	MaxEntries = 50
+)
+
+type Link struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type Person struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type Content struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type Category struct {
+	Term string `xml:"term,attr"`
+}
+
+type Entry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Links     []Link     `xml:"link"`
+	Author    Person     `xml:"author"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Category  []Category `xml:"category"`
+	Content   *Content   `xml:"content,omitempty"`
+}
+
+type Feed struct {
+	XMLName xml.Name `xml:"feed"`
+	NS      string   `xml:"xmlns,attr"`
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Links   []Link   `xml:"link"`
+	Updated string   `xml:"updated"`
+	Entries []Entry  `xml:"entry"`
+}
+
+// Build turns posts given in creation order into a feed of the newest ones,
+// siteURL is the address of the frontend without a trailing slash
+func Build(title, siteURL, selfURL string, posts []post.Post) Feed {
+	feed := Feed{
+		NS:    atomNS,
+		ID:    selfURL,
+		Title: title,
+		Links: []Link{
+			{Href: selfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: siteURL + "/", Rel: "alternate", Type: "text/html"},
+		},
+		Updated: LastModified(posts).Format(time.RFC3339),
+		Entries: make([]Entry, 0, MaxEntries),
+	}
+	for idx := len(posts) - 1; idx >= 0 && len(feed.Entries) < MaxEntries; idx-- {
+		feed.Entries = append(feed.Entries, entry(siteURL, posts[idx]))
+	}
+	return feed
+}
+
+// ETag changes whenever a post is added, removed or edited
+func ETag(posts []post.Post) string {
+	hash := sha1.New()
+	for _, item := range posts {
+		fmt.Fprintf(hash, "%s:%d;", item.ID, item.Version)
+	}
+	return fmt.Sprintf(`"%x"`, hash.Sum(nil))
+}
+
+// LastModified is the creation time of the newest post, the zero time for an empty feed
+func LastModified(posts []post.Post) time.Time {
+	modified := time.Time{}
+	for _, item := range posts {
+		created, errParse := time.Parse(time.RFC3339, item.Created)
+		if errParse == nil && created.After(modified) {
+			modified = created
+		}
+	}
+	return modified
+}
+
+func entry(siteURL string, item post.Post) Entry {
+	postURL := fmt.Sprintf("%s/a/%s/%s", siteURL, item.Category, item.ID)
+	result := Entry{
+		ID:    postURL,
+		Title: item.Title,
+		Links: []Link{
+			{Href: postURL, Rel: "alternate", Type: "text/html"},
+		},
+		Author: Person{
+			Name: item.Author.Login,
+		},
+		Published: item.Created,
+		Updated:   item.Created,
+		Category:  []Category{{Term: item.Category}},
+	}
+	if item.Author.Login != user.DeletedLogin {
+		result.Author.URI = siteURL + "/u/" + item.Author.Login
+	}
+	switch {
+	case item.URL != "":
+		result.Links = append(result.Links, Link{Href: item.URL, Rel: "related"})
+		result.Content = &Content{Type: "text", Body: item.URL}
+	case item.Text != "":
+		result.Content = &Content{Type: "text", Body: item.Text}
+	}
+	return result
+}
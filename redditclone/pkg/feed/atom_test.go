@@ -0,0 +1,74 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"redditclone/pkg/post"
+	"redditclone/pkg/user"
+)
+
+func testPosts() []post.Post {
+	return []post.Post{
+		{ID: "1", Category: "music", Title: "first", Text: "body <b>one</b>", Type: "text",
+			Author: user.User{Login: "alice"}, Created: "2024-01-01T10:00:00Z", Version: 1},
+		{ID: "2", Category: "news", Title: "second", URL: "https://example.com/a?b=1&c=2", Type: "link",
+			Author: user.User{Login: user.DeletedLogin}, Created: "2024-01-02T10:00:00Z", Version: 1},
+	}
+}
+
+func TestBuild(t *testing.T) {
+	result := Build("all", "http://site", "http://site/feeds/all.atom", testPosts())
+	if len(result.Entries) != 2 || result.Entries[0].Title != "second" {
+		t.Fatalf("entries must be newest first: %+v", result.Entries)
+	}
+	if result.Updated != "2024-01-02T10:00:00Z" {
+		t.Errorf("bad updated %q", result.Updated)
+	}
+	link := result.Entries[0]
+	if link.Content == nil || link.Content.Body != "https://example.com/a?b=1&c=2" || link.Links[1].Href != link.Content.Body {
+		t.Errorf("link post must carry its url: %+v", link)
+	}
+	if link.Author.URI != "" {
+		t.Errorf("deleted author must not link to a profile: %q", link.Author.URI)
+	}
+	text := result.Entries[1]
+	if text.ID != "http://site/a/music/1" || text.Author.URI != "http://site/u/alice" {
+		t.Errorf("bad links: %+v", text)
+	}
+
+	out, err := xml.Marshal(result)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(out), "body &lt;b&gt;one&lt;/b&gt;") {
+		t.Errorf("text body must be escaped: %s", out)
+	}
+	parsed := Feed{}
+	if err = xml.Unmarshal(out, &parsed); err != nil || len(parsed.Entries) != 2 {
+		t.Errorf("feed does not round trip: %v", err)
+	}
+}
+
+func TestBuildLimit(t *testing.T) {
+	posts := make([]post.Post, MaxEntries+10)
+	for idx := range posts {
+		posts[idx] = post.Post{ID: string(rune('a' + idx%26)), Created: "2024-01-01T10:00:00Z"}
+	}
+	if entries := Build("all", "", "", posts).Entries; len(entries) != MaxEntries {
+		t.Errorf("got %d entries, expected %d", len(entries), MaxEntries)
+	}
+}
+
+func TestETag(t *testing.T) {
+	posts := testPosts()
+	before := ETag(posts)
+	posts[0].Version++
+	if ETag(posts) == before {
+		t.Errorf("etag must change when a post is edited")
+	}
+	if ETag(posts[:1]) == ETag(posts) {
+		t.Errorf("etag must change when a post is removed")
+	}
+}
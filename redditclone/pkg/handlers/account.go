@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/category"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/message"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/token"
+	"redditclone/pkg/twofactor"
+	"redditclone/pkg/user"
+)
+
+type AccountHandler struct {
+	Logger        *zap.SugaredLogger
+	UserRepo      user.UserRepo
+	PostRepo      post.PostRepo
+	CommentRepo   comment.CommentRepo
+	MessageRepo   message.MessageRepo
+	CategoryRepo  category.CategoryRepo
+	TokenRepo     token.TokenRepo
+	TwoFactorRepo twofactor.TwoFactorRepo
+	AuditRepo     audit.AuditRepo
+	Sessions      session.SessRepo
+}
+
+type DeleteAccountForm struct {
+	Password string `json:"password"`
+	// Code is required when two-factor authentication is enabled
+	Code string `json:"code"`
+}
+
+type ExportProfile struct {
+	ID       string        `json:"id"`
+	Login    string        `json:"username"`
+	Created  string        `json:"created"`
+	Settings user.Settings `json:"settings"`
+}
+
+type ExportComment struct {
+	PostID string `json:"postId"`
+	comment.Comment
+}
+
+type ExportVote struct {
+	PostID  string `json:"postId"`
+	Vote    int    `json:"vote"`
+	Created string `json:"created,omitempty"`
+}
+
+type AccountExport struct {
+	Exported string          `json:"exported"`
+	Profile  ExportProfile   `json:"profile"`
+	Posts    []post.Post     `json:"posts"`
+	Comments []ExportComment `json:"comments"`
+	Votes    []ExportVote    `json:"votes"`
+}
+
+// ================================ GET ===============================
+func (h *AccountHandler) Export(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := fullSession(h.Logger, r)
+	if errSession != nil {
+		return errSession
+	}
+	currUser, errUser := h.UserRepo.GetUser(currSession.UserLogin)
+	if errUser != nil {
+		return apierr.NotFound("user not found")
+	}
+	settings, errSettings := h.UserRepo.GetSettings(currUser.Login)
+	if errSettings != nil {
+		return apierr.Internal("error in getting settings", errSettings)
+	}
+	posts, errPosts := h.PostRepo.GetUserPosts(currUser.Login)
+	if errPosts != nil {
+		return apierr.Internal("error in getting posts", errPosts)
+	}
+	userComments, errComments := h.CommentRepo.GetUserComments(currUser.Login)
+	if errComments != nil {
+		return apierr.Internal("error in getting comments", errComments)
+	}
+	allPosts, errAll := h.PostRepo.GetAllPosts()
+	if errAll != nil {
+		return apierr.Internal("error in getting votes", errAll)
+	}
+
+	export := AccountExport{
+		Exported: time.Now().Format(time.RFC3339),
+		Profile: ExportProfile{
+			ID:       currUser.ID,
+			Login:    currUser.Login,
+			Created:  currUser.Created.Format(time.RFC3339),
+			Settings: settings,
+		},
+		Posts:    posts,
+		Comments: make([]ExportComment, 0),
+		Votes:    make([]ExportVote, 0),
+	}
+	for postID, comments := range userComments {
+		for _, item := range comments {
+			export.Comments = append(export.Comments, ExportComment{PostID: postID, Comment: *item})
+		}
+	}
+	sort.Slice(export.Comments, func(i, j int) bool {
+		return export.Comments[i].Created < export.Comments[j].Created
+	})
+	for _, item := range allPosts {
+		for _, vote := range item.Votes {
+			if vote.User == currUser.ID {
+				export.Votes = append(export.Votes, ExportVote{PostID: item.ID, Vote: vote.Vote, Created: vote.Created})
+			}
+		}
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-export.json"`, currUser.Login))
+	return jsonResp(h.Logger, w, export)
+}
+
+// ============================== DELETE ==============================
+// Delete keeps threads readable: posts and comments stay under the deleted placeholder,
+// votes, tokens, sessions and the account itself are removed. The login may be registered
+// again, so nothing keyed by it survives: messages, blocks and moderator rights go too.
+func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := fullSession(h.Logger, r)
+	if errSession != nil {
+		return errSession
+	}
+	form := &DeleteAccountForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
+	}
+	currUser, errAuth := h.UserRepo.Authorize(currSession.UserLogin, form.Password)
+	if errAuth != nil {
+		recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionLoginFailed, currSession.UserID)
+		return apierr.Unauthorized("bad password")
+	}
+	// admins are listed by login in the server flags, a new account of the login would inherit the rights
+	if h.UserRepo.IsAdmin(currUser.Login) {
+		return apierr.Conflict("site admins cant delete their account")
+	}
+	if h.TwoFactorRepo.IsEnabled(currUser.Login) {
+		errVerify := h.TwoFactorRepo.Verify(currUser.Login, form.Code)
+		switch errVerify {
+		case nil:
+		case twofactor.ErrLocked:
+			return apierr.New(http.StatusTooManyRequests, errVerify.Error())
+		default:
+			return apierr.Validation(ErrForm{Location: "body", Param: "code", Msg: twofactor.ErrBadCode.Error()})
+		}
+	}
+
+	// access goes first so nothing new is written while the content is anonymized
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"deleting tokens", func() error { _, err := h.TokenRepo.DeleteAll(currUser.Login); return err }},
+		{"destroying sessions", func() error { return h.Sessions.DestroyAll(currUser.ID) }},
+		{"removing votes", func() error { _, err := h.PostRepo.RemoveVotes(currUser.ID); return err }},
+		{"anonymizing comments", func() error { _, err := h.CommentRepo.Anonymize(currUser.Login); return err }},
+		{"anonymizing posts", func() error { _, err := h.PostRepo.Anonymize(currUser.Login); return err }},
+		{"purging messages", func() error { _, err := h.MessageRepo.Purge(currUser.Login); return err }},
+		{"removing moderator rights", func() error { _, err := h.CategoryRepo.RemoveModerator(currUser.Login); return err }},
+		{"disabling 2fa", func() error {
+			err := h.TwoFactorRepo.Disable(currUser.Login)
+			if err == twofactor.ErrNotEnrolled {
+				return nil
+			}
+			return err
+		}},
+		{"deleting user", func() error { return h.UserRepo.DeleteUser(currUser.Login) }},
+	}
+	for _, step := range steps {
+		errStep := step.run()
+		if errStep != nil {
+			return apierr.Internal("error in "+step.name, errStep)
+		}
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currUser.Login, audit.ActionAccountDelete, currUser.ID)
+	h.Sessions.DestroyCookie(w)
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"message": "success",
+	})
+}
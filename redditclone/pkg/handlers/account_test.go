@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/audit"
+	"redditclone/pkg/category"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/kv"
+	"redditclone/pkg/message"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/token"
+	"redditclone/pkg/twofactor"
+	"redditclone/pkg/user"
+)
+
+func TestDeletedLoginStartsClean(t *testing.T) {
+	userRepo := user.NewMemoryRepo()
+	messageRepo := message.NewMemoryRepo()
+	categoryRepo := category.NewMemoryRepo()
+	h := &AccountHandler{
+		Logger:        zap.NewNop().Sugar(),
+		UserRepo:      userRepo,
+		PostRepo:      post.NewMemoryRepo(),
+		CommentRepo:   comment.NewMemoryRepo(),
+		MessageRepo:   messageRepo,
+		CategoryRepo:  categoryRepo,
+		TokenRepo:     token.NewMemoryRepo(),
+		TwoFactorRepo: twofactor.NewMemoryRepo(),
+		AuditRepo:     audit.NewMemoryRepo(),
+		Sessions:      session.NewSessionsManager(kv.NewMemoryStore()),
+	}
+	alice, _ := userRepo.AddUser("alice", "password1")
+	userRepo.AddUser("bob", "password2")
+	messageRepo.Send("bob", "alice", "hi alice")
+	messageRepo.Block("alice", "bob")
+	messageRepo.Block("bob", "alice")
+	categoryRepo.AddModerator("music", "alice")
+
+	r := httptest.NewRequest("DELETE", "/api/profile", strings.NewReader(`{"password":"password1"}`))
+	r = r.WithContext(session.ContextWithSession(r.Context(), &session.Session{UserID: alice.ID, UserLogin: alice.Login}))
+	w := httptest.NewRecorder()
+	if err := h.Delete(w, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := userRepo.AddUser("alice", "password3"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conversations, _ := messageRepo.GetConversations("alice"); len(conversations) != 0 {
+		t.Errorf("new account got %d conversations of the deleted one", len(conversations))
+	}
+	if unread, _ := messageRepo.UnreadCount("alice"); unread != 0 {
+		t.Errorf("new account got %d unread messages", unread)
+	}
+	if blocked, _ := messageRepo.GetBlocked("alice"); len(blocked) != 0 {
+		t.Errorf("new account got the block list %v", blocked)
+	}
+	if messageRepo.IsBlocked("alice", "bob") {
+		t.Errorf("new account is blocked by a block against the deleted one")
+	}
+	if categoryRepo.IsModerator("music", "alice") {
+		t.Errorf("new account got moderator rights")
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/stats"
+	"redditclone/pkg/user"
+)
+
+type AdminHandler struct {
+	Logger      *zap.SugaredLogger
+	PostRepo    post.PostRepo
+	CommentRepo comment.CommentRepo
+	UserRepo    user.UserRepo
+}
+
+// ================================ GET ===============================
+func (h *AdminHandler) CheckConsistency(w http.ResponseWriter, r *http.Request) error {
+	return h.consistency(w, r, false)
+}
+
+// Stats aggregates site activity, by default the last 30 days
+func (h *AdminHandler) Stats(w http.ResponseWriter, r *http.Request) error {
+	if _, errAdmin := requireAdmin(h.Logger, h.UserRepo, r); errAdmin != nil {
+		return errAdmin
+	}
+	params := r.URL.Query()
+	query := stats.Query{
+		To:       time.Now(),
+		Interval: stats.IntervalDay,
+		Top:      stats.DefaultTop,
+	}
+	if interval := params.Get("interval"); interval != "" {
+		query.Interval = interval
+	}
+	for param, dst := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		value := params.Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, errParse := time.Parse(time.RFC3339, value)
+		if errParse != nil {
+			return apierr.Validation(ErrForm{Location: "query", Param: param, Msg: "must be RFC3339 time", Value: value})
+		}
+		*dst = parsed
+	}
+	if query.From.IsZero() {
+		query.From = query.To.AddDate(0, 0, -30)
+	}
+	if value := params.Get("top"); value != "" {
+		top, errTop := strconv.Atoi(value)
+		if errTop != nil || top < 1 || top > 100 {
+			return apierr.Validation(ErrForm{Location: "query", Param: "top", Msg: "must be from 1 to 100", Value: value})
+		}
+		query.Top = top
+	}
+
+	report, errStats := stats.Compute(h.UserRepo, h.PostRepo, h.CommentRepo, query)
+	switch errStats {
+	case nil:
+		return jsonResp(h.Logger, w, report)
+	case stats.ErrBadInterval, stats.ErrTooManyBuckets:
+		return apierr.Validation(ErrForm{Location: "query", Param: "interval", Msg: errStats.Error(), Value: query.Interval})
+	case stats.ErrBadRange:
+		return apierr.Validation(ErrForm{Location: "query", Param: "from", Msg: errStats.Error()})
+	default:
+		return apierr.Internal("error in computing stats", errStats)
+	}
+}
+
+// =============================== POST ===============================
+func (h *AdminHandler) FixConsistency(w http.ResponseWriter, r *http.Request) error {
+	return h.consistency(w, r, true)
+}
+
+// ============================== HELP FUNC ==============================
+func (h *AdminHandler) consistency(w http.ResponseWriter, r *http.Request, fix bool) error {
+	currSession, errAdmin := requireAdmin(h.Logger, h.UserRepo, r)
+	if errAdmin != nil {
+		return errAdmin
+	}
+	found, errCheck := post.CheckComments(h.PostRepo, h.CommentRepo, fix)
+	if errCheck != nil {
+		return apierr.Internal("error in consistency check", errCheck)
+	}
+	if len(found) > 0 {
+		h.Logger.Warnw("Comment inconsistencies found",
+			"count", len(found),
+			"fix", fix,
+			"admin", currSession.UserLogin,
+		)
+	}
+	return jsonResp(h.Logger, w, found)
+}
+
+func requireAdmin(logger *zap.SugaredLogger, userRepo user.UserRepo, r *http.Request) (*session.Session, error) {
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		logger.Infow("Unauthorized", errSession)
+		return nil, apierr.Unauthorized("bad token")
+	}
+	if !userRepo.IsAdmin(currSession.UserLogin) {
+		logger.Infow("Forbidden", "user", currSession.UserLogin)
+		return nil, apierr.Forbidden("admins only")
+	}
+	return currSession, nil
+}
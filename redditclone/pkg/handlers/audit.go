@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/user"
+)
+
+const maxAuditEntries = 1000
+
+type AuditHandler struct {
+	Logger    *zap.SugaredLogger
+	AuditRepo audit.AuditRepo
+	UserRepo  user.UserRepo
+}
+
+// ================================ GET ===============================
+func (h *AuditHandler) Query(w http.ResponseWriter, r *http.Request) error {
+	if _, errAdmin := requireAdmin(h.Logger, h.UserRepo, r); errAdmin != nil {
+		return errAdmin
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Actor:    query.Get("actor"),
+		Action:   query.Get("action"),
+		TargetID: query.Get("target"),
+	}
+	for param, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, errParse := time.Parse(time.RFC3339, value)
+		if errParse != nil {
+			return apierr.Validation(ErrForm{
+				Location: "query",
+				Param:    param,
+				Msg:      "must be RFC3339 time",
+				Value:    value,
+			})
+		}
+		*dst = parsed
+	}
+
+	entries, errQuery := h.AuditRepo.Query(filter)
+	if errQuery != nil {
+		return apierr.Internal("error in querying audit log", errQuery)
+	}
+	// newest entries are the interesting ones
+	if len(entries) > maxAuditEntries {
+		entries = entries[len(entries)-maxAuditEntries:]
+	}
+	return jsonResp(h.Logger, w, entries)
+}
+
+// ============================== HELP FUNC ==============================
+func recordAudit(logger *zap.SugaredLogger, repo audit.AuditRepo, r *http.Request, actor, action, targetID string) {
+	_, errAppend := repo.Append(audit.Entry{
+		Actor:    actor,
+		Action:   action,
+		TargetID: targetID,
+		IP:       clientIP(r),
+	})
+	if errAppend != nil {
+		logger.Infow("Error in writing audit log", errAppend, "action", action, "target", targetID)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, errSplit := net.SplitHostPort(r.RemoteAddr)
+	if errSplit != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
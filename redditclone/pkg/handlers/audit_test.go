@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+)
+
+func TestAuditLogIsForAdmins(t *testing.T) {
+	userRepo := user.NewMemoryRepo("admin")
+	admin, _ := userRepo.AddUser("admin", "password1")
+	alice, _ := userRepo.AddUser("alice", "password2")
+	auditRepo := audit.NewMemoryRepo()
+	auditRepo.Append(audit.Entry{Actor: "alice", Action: audit.ActionLogin})
+	auditRepo.Append(audit.Entry{Actor: "admin", Action: audit.ActionLogin})
+	h := &AuditHandler{Logger: zap.NewNop().Sugar(), AuditRepo: auditRepo, UserRepo: userRepo}
+	query := func(viewer user.User, url string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest("GET", url, nil)
+		r = r.WithContext(session.ContextWithSession(r.Context(), &session.Session{UserID: viewer.ID, UserLogin: viewer.Login}))
+		w := httptest.NewRecorder()
+		return w, h.Query(w, r)
+	}
+
+	if _, err := query(alice, "/api/admin/audit"); apierr.From(err).Status != http.StatusForbidden {
+		t.Errorf("non-admin got %v, expected 403", err)
+	}
+	if _, err := query(admin, "/api/admin/audit?from=yesterday"); apierr.From(err).Status != http.StatusUnprocessableEntity {
+		t.Errorf("bad time got %v, expected 422", err)
+	}
+	w, err := query(admin, "/api/admin/audit?actor=alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries := []audit.Entry{}
+	if err = json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "alice" {
+		t.Errorf("got entries %+v, expected the one of alice", entries)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/category"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+)
+
+type CategoryHandler struct {
+	Logger       *zap.SugaredLogger
+	CategoryRepo category.CategoryRepo
+	UserRepo     user.UserRepo
+	AuditRepo    audit.AuditRepo
+}
+
+type FlairsForm struct {
+	Flairs []string `json:"flairs"`
+}
+
+type ModeratorForm struct {
+	Login string `json:"username"`
+}
+
+// ================================ GET ===============================
+func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) error {
+	name := mux.Vars(r)["CATEGORY_NAME"]
+	cat, errGet := h.CategoryRepo.Get(name)
+	if errGet != nil {
+		return apierr.Internal("error in getting category", errGet)
+	}
+	return jsonResp(h.Logger, w, cat)
+}
+
+// ================================ PUT ===============================
+func (h *CategoryHandler) SetFlairs(w http.ResponseWriter, r *http.Request) error {
+	name := mux.Vars(r)["CATEGORY_NAME"]
+	currSession, errModerator := requireModerator(h.Logger, h.UserRepo, h.CategoryRepo, r, name)
+	if errModerator != nil {
+		return errModerator
+	}
+	form := &FlairsForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
+	}
+	cat, errSet := h.CategoryRepo.SetFlairs(name, form.Flairs)
+	if errSet != nil {
+		h.Logger.Infow("Error in setting flairs", errSet)
+		return apierr.Validation(ErrForm{
+			Location: "body",
+			Param:    "flairs",
+			Msg:      errSet.Error(),
+		})
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionFlairsEdit, name)
+	return jsonResp(h.Logger, w, cat)
+}
+
+// =============================== POST ===============================
+func (h *CategoryHandler) AddModerator(w http.ResponseWriter, r *http.Request) error {
+	name := mux.Vars(r)["CATEGORY_NAME"]
+	currSession, errModerator := requireModerator(h.Logger, h.UserRepo, h.CategoryRepo, r, name)
+	if errModerator != nil {
+		return errModerator
+	}
+	form := &ModeratorForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
+	}
+	if form.Login == "" {
+		return apierr.Validation(ErrForm{
+			Location: "body",
+			Param:    "username",
+			Msg:      "is required",
+		})
+	}
+	// a login nobody holds yet would hand the rights to whoever registers it later
+	moderator, errUser := h.UserRepo.GetUser(form.Login)
+	if errUser != nil {
+		h.Logger.Infow("Error in getting moderator", errUser)
+		return apierr.NotFound("user not found")
+	}
+	cat, errAdd := h.CategoryRepo.AddModerator(name, moderator.Login)
+	if errAdd != nil {
+		return apierr.Internal("error in adding moderator", errAdd)
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionModeratorAdd, name+"/"+form.Login)
+	return jsonResp(h.Logger, w, cat)
+}
+
+// ============================== HELP FUNC ==============================
+// requireModerator lets through admins and moderators of the category, writing the error response otherwise
+func requireModerator(logger *zap.SugaredLogger, userRepo user.UserRepo, categoryRepo category.CategoryRepo,
+	r *http.Request, name string) (*session.Session, error) {
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		logger.Infow("Unauthorized", errSession)
+		return nil, apierr.Unauthorized("bad token")
+	}
+	if userRepo.IsAdmin(currSession.UserLogin) || categoryRepo.IsModerator(name, currSession.UserLogin) {
+		return currSession, nil
+	}
+	logger.Infow("Forbidden", "user", currSession.UserLogin, "category", name)
+	return nil, apierr.Forbidden("not a moderator")
+}
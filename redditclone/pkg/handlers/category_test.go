@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/category"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+)
+
+func TestAddModeratorNeedsExistingUser(t *testing.T) {
+	userRepo := user.NewMemoryRepo("admin")
+	admin, _ := userRepo.AddUser("admin", "password1")
+	userRepo.AddUser("bob", "password2")
+	categoryRepo := category.NewMemoryRepo()
+	h := &CategoryHandler{
+		Logger:       zap.NewNop().Sugar(),
+		CategoryRepo: categoryRepo,
+		UserRepo:     userRepo,
+		AuditRepo:    audit.NewMemoryRepo(),
+	}
+	addModerator := func(login string) error {
+		r := httptest.NewRequest("POST", "/api/category/music/moderators", strings.NewReader(`{"username":"`+login+`"}`))
+		r = mux.SetURLVars(r, map[string]string{"CATEGORY_NAME": "music"})
+		r = r.WithContext(session.ContextWithSession(r.Context(), &session.Session{UserID: admin.ID, UserLogin: admin.Login}))
+		return h.AddModerator(httptest.NewRecorder(), r)
+	}
+
+	if err := addModerator("ghost"); apierr.From(err).Status != http.StatusNotFound {
+		t.Errorf("unknown login got %v, expected 404", err)
+	}
+	if categoryRepo.IsModerator("music", "ghost") {
+		t.Errorf("unknown login became moderator")
+	}
+	if err := addModerator("bob"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !categoryRepo.IsModerator("music", "bob") {
+		t.Errorf("bob did not become moderator")
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/feed"
+	"redditclone/pkg/post"
+	"redditclone/pkg/user"
+)
+
+type FeedHandler struct {
+	Logger   *zap.SugaredLogger
+	PostRepo post.PostRepo
+	UserRepo user.UserRepo
+	// SiteURL is the public address of the site without a trailing slash, links never come
+	// from request headers as a forged Host would end up in feed readers and caches
+	SiteURL string
+}
+
+// ================================ GET ===============================
+func (h *FeedHandler) All(w http.ResponseWriter, r *http.Request) error {
+	posts, errGet := h.PostRepo.GetAllPosts()
+	if errGet != nil {
+		return apierr.Internal("error in getting posts", errGet)
+	}
+	return h.serve(w, r, "redditclone", posts)
+}
+
+func (h *FeedHandler) Category(w http.ResponseWriter, r *http.Request) error {
+	category := mux.Vars(r)["CATEGORY"]
+	posts, errGet := h.PostRepo.GetCategory(category)
+	if errGet != nil {
+		return apierr.Internal("error in getting posts", errGet)
+	}
+	return h.serve(w, r, "a/"+category, posts)
+}
+
+func (h *FeedHandler) User(w http.ResponseWriter, r *http.Request) error {
+	login := mux.Vars(r)["LOGIN"]
+	if _, errUser := h.UserRepo.GetUser(login); errUser != nil {
+		return apierr.NotFound("user not found")
+	}
+	posts, errGet := h.PostRepo.GetUserPosts(login)
+	if errGet != nil {
+		return apierr.Internal("error in getting posts", errGet)
+	}
+	return h.serve(w, r, "u/"+login, posts)
+}
+
+// ============================== HELP FUNC ==============================
+// serve answers with 304 when the reader already has the current feed,
+// feeds are anonymous so shadow-hidden and nsfw posts are left out.
+// Edits, hides and removals do not show in creation times, so Last-Modified
+// is the time of the last change of any post.
+func (h *FeedHandler) serve(w http.ResponseWriter, r *http.Request, title string, posts []post.Post) error {
+	_, modified := h.PostRepo.Revision()
+	modified = modified.UTC().Truncate(time.Second)
+	posts = post.ListFilter{}.Apply(posts)
+	etag := feed.ETag(posts)
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	}
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	body, errMarsh := xml.MarshalIndent(feed.Build(title, h.SiteURL, h.SiteURL+r.URL.Path, posts), "", "  ")
+	if errMarsh != nil {
+		return apierr.Internal("error in building feed", errMarsh)
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	_, errWrite := w.Write(append([]byte(xml.Header), body...))
+	if errWrite != nil {
+		h.Logger.Infow("Error in writing feed", errWrite)
+	}
+	return nil
+}
+
+// notModified follows RFC 7232: If-None-Match wins over If-Modified-Since
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	since, errParse := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return errParse == nil && !modified.IsZero() && !modified.After(since)
+}
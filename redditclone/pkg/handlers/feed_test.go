@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/post"
+	"redditclone/pkg/user"
+)
+
+func TestFeedLinks(t *testing.T) {
+	postRepo := post.NewMemoryRepo()
+	h := &FeedHandler{
+		Logger:   zap.NewNop().Sugar(),
+		PostRepo: postRepo,
+		UserRepo: user.NewMemoryRepo(),
+		SiteURL:  "https://site.example",
+	}
+	created, _ := postRepo.Create(post.Post{Title: "first", Category: "music", Author: user.User{Login: "alice"}})
+
+	r := httptest.NewRequest("GET", "/feeds/all.atom", nil)
+	r.Host = "evil.example"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	if err := h.All(w, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "evil.example") {
+		t.Errorf("feed links come from the request host:\n%s", body)
+	}
+	if !strings.Contains(body, "https://site.example/a/music/"+created.ID) {
+		t.Errorf("feed has no link to the post:\n%s", body)
+	}
+
+	// hiding changes no creation time, the feed must still look modified
+	postRepo.Update(created.ID, post.AnyVersion, func(item *post.Post) error {
+		item.Hidden = true
+		return nil
+	})
+	_, modified := postRepo.Revision()
+	w = httptest.NewRecorder()
+	if err := h.All(w, httptest.NewRequest("GET", "/feeds/all.atom", nil)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := w.Header().Get("Last-Modified"); got != modified.UTC().Format(http.TimeFormat) {
+		t.Errorf("got Last-Modified %q, expected the time of the last change", got)
+	}
+}
@@ -0,0 +1,780 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/category"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/token"
+	"redditclone/pkg/user"
+)
+
+const (
+	// maxGraphQLBody is far above any real query, variables included
+	maxGraphQLBody = 1 << 20
+	maxPageSize    = 100
+	// maxGraphQLDepth stops nesting like post { author { posts { author { posts ... } } } }
+	maxGraphQLDepth = 10
+	// maxGraphQLCost is how many list items one request may resolve. Selections multiply:
+	// a page costs its first argument before it is loaded, nested lists cost their length.
+	maxGraphQLCost = 5000
+)
+
+const gqlSchema = `schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	# null for anonymous requests
+	me: User
+	user(username: String!): User
+	post(id: ID!): Post
+	posts(category: String, first: Int = 25, offset: Int = 0, order: PostOrder = TOP): [Post!]!
+	category(name: String!): Category!
+}
+
+type Mutation {
+	createPost(input: PostInput!): Post!
+	deletePost(id: ID!): Boolean!
+	addComment(postId: ID!, body: String!): Comment!
+	deleteComment(postId: ID!, id: ID!): Post!
+	# sets the vote of the viewer, value is -1, 0 or 1
+	vote(postId: ID!, value: Int!): Post!
+}
+
+enum PostOrder {
+	# highest score first
+	TOP
+	# newest first
+	NEW
+}
+
+type User {
+	id: ID!
+	username: String!
+	# posts of the user the viewer may see, by score
+	posts: [Post!]!
+	# total score of all posts of the user
+	karma: Int!
+}
+
+type Post {
+	id: ID!
+	title: String!
+	type: String!
+	url: String
+	text: String
+	textHtml: String
+	category: String!
+	flair: String
+	tags: [String!]!
+	nsfw: Boolean!
+	spoiler: Boolean!
+	locked: Boolean!
+	pinned: Boolean!
+	archived: Boolean!
+	created: String!
+	score: Int!
+	upvotePercentage: Int!
+	views: Int!
+	commentCount: Int!
+	author: User!
+	# votes without voters, the viewer finds their own in viewerVote
+	votes: [Vote!]!
+	comments: [Comment!]!
+	# vote of the viewer, null for anonymous requests
+	viewerVote: Int
+}
+
+type Vote {
+	vote: Int!
+	created: String
+}
+
+type Comment {
+	id: ID!
+	body: String!
+	bodyHtml: String!
+	created: String!
+	author: User!
+}
+
+type Category {
+	name: String!
+	flairs: [String!]!
+	moderators: [String!]!
+	# pinned posts come first
+	posts(first: Int = 25, offset: Int = 0, order: PostOrder = TOP): [Post!]!
+}
+
+input PollInput {
+	options: [String!]!
+	# RFC3339 time
+	closesAt: String
+}
+
+input PostInput {
+	category: String!
+	title: String!
+	# text, link or poll
+	type: String = "text"
+	text: String
+	url: String
+	flair: String
+	tags: [String!]
+	nsfw: Boolean = false
+	spoiler: Boolean = false
+	# RFC3339 time, the post stays hidden until then
+	publishAt: String
+	# RFC3339 time, the post is archived then
+	expiresAt: String
+	poll: PollInput
+}
+`
+
+// GraphQLHandler serves /graphql over the same repositories and checks as the REST handlers
+type GraphQLHandler struct {
+	Logger *zap.SugaredLogger
+	Posts  *PostHandler
+	Schema *graphql.Schema
+}
+
+type gqlKey string
+
+const gqlViewerKey gqlKey = "viewer"
+
+// gqlViewer is what resolvers know about the request
+type gqlViewer struct {
+	// cost counts the list items resolved so far, see maxGraphQLCost
+	cost int64
+	r    *http.Request
+	// session is nil for anonymous requests
+	session *session.Session
+	filter  post.ListFilter
+	// readOnly refuses mutations, GET requests must not change anything
+	readOnly bool
+	// comments loads comments by post id, authored loads posts by author login
+	comments *gqlLoader
+	authored *gqlLoader
+}
+
+// gqlLoader batches lookups of items that resolve in parallel: resolving a list collects
+// the keys of its items, the first item that needs its data loads it for all of them
+type gqlLoader struct {
+	mutex   sync.Mutex
+	pending map[string]bool
+	loaded  map[string]interface{}
+	load    func(keys []string) (map[string]interface{}, error)
+}
+
+type gqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// gqlPageArgs are not pointers, the schema gives them defaults
+type gqlPageArgs struct {
+	First  int32
+	Offset int32
+	// Order is a PostOrder value
+	Order string
+}
+
+type gqlPostInput struct {
+	Category  string
+	Title     string
+	Type      string
+	Text      *string
+	URL       *string
+	Flair     *string
+	Tags      *[]string
+	NSFW      bool
+	Spoiler   bool
+	PublishAt *string
+	ExpiresAt *string
+	Poll      *struct {
+		Options  []string
+		ClosesAt *string
+	}
+}
+
+// gqlRoot resolves the fields of Query and Mutation
+type gqlRoot struct {
+	h *GraphQLHandler
+}
+
+type gqlUser struct {
+	h    *GraphQLHandler
+	user user.User
+}
+
+type gqlPost struct {
+	h    *GraphQLHandler
+	post post.Post
+}
+
+type gqlComment struct {
+	h       *GraphQLHandler
+	comment *comment.Comment
+}
+
+type gqlVote struct {
+	vote *post.Votes
+}
+
+type gqlCategory struct {
+	h        *GraphQLHandler
+	category category.Category
+}
+
+// NewGraphQLHandler parses the schema and checks that every field of it has a resolver
+func NewGraphQLHandler(logger *zap.SugaredLogger, posts *PostHandler) (*GraphQLHandler, error) {
+	h := &GraphQLHandler{Logger: logger, Posts: posts}
+	schema, errSchema := graphql.ParseSchema(gqlSchema, &gqlRoot{h: h},
+		graphql.MaxDepth(maxGraphQLDepth),
+		graphql.Logger(h),
+	)
+	if errSchema != nil {
+		return nil, errSchema
+	}
+	h.Schema = schema
+	return h, nil
+}
+
+// ================================ GET ===============================
+// Serve runs queries sent as POST bodies or in the url of GET requests, GET never runs mutations.
+// GET without a query prints the schema.
+func (h *GraphQLHandler) Serve(w http.ResponseWriter, r *http.Request) error {
+	req := gqlRequest{}
+	if r.Method == http.MethodGet {
+		values := r.URL.Query()
+		if values.Get("query") == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, errWrite := w.Write([]byte(gqlSchema))
+			if errWrite != nil {
+				h.Logger.Infow("Error in write resp", errWrite)
+			}
+			return nil
+		}
+		req.Query = values.Get("query")
+		req.OperationName = values.Get("operationName")
+		if variables := values.Get("variables"); variables != "" {
+			if errDecode := json.Unmarshal([]byte(variables), &req.Variables); errDecode != nil {
+				return apierr.Validation(ErrForm{Location: "query", Param: "variables", Msg: "must be a json object"})
+			}
+		}
+	} else {
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBody))
+		if errDecode := decoder.Decode(&req); errDecode != nil {
+			h.Logger.Infow("Error in unmarshaling graphql request", errDecode)
+			return apierr.BadRequest("cant unpack payload")
+		}
+		if req.Query == "" {
+			return apierr.Validation(ErrForm{Location: "body", Param: "query", Msg: "is required"})
+		}
+	}
+
+	viewer := &gqlViewer{
+		r:        r,
+		filter:   h.Posts.listFilter(r),
+		readOnly: r.Method == http.MethodGet,
+		comments: newLoader(h.loadComments),
+		authored: newLoader(h.loadAuthored),
+	}
+	// flair and tag come from the arguments of the query, not from the url
+	viewer.filter.Flair, viewer.filter.Tag = "", ""
+	if currSession, errSession := session.SessionFromContext(r.Context()); errSession == nil {
+		viewer.session = currSession
+	}
+	resp := h.Schema.Exec(context.WithValue(r.Context(), gqlViewerKey, viewer), req.Query, req.OperationName, req.Variables)
+	for _, errQuery := range resp.Errors {
+		if errQuery.ResolverError != nil {
+			errQuery.Message, errQuery.Extensions = h.present(errQuery.ResolverError)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return jsonResp(h.Logger, w, resp)
+}
+
+func (root *gqlRoot) Me(ctx context.Context) (*gqlUser, error) {
+	viewer := viewerFrom(ctx)
+	if viewer.session == nil {
+		return nil, nil
+	}
+	return root.h.findUser(viewer.session.UserLogin)
+}
+
+func (root *gqlRoot) User(args struct{ Username string }) (*gqlUser, error) {
+	return root.h.findUser(args.Username)
+}
+
+func (root *gqlRoot) Post(ctx context.Context, args struct{ ID graphql.ID }) (*gqlPost, error) {
+	viewer := viewerFrom(ctx)
+	currPost, errGet := root.h.Posts.PostRepo.Get(string(args.ID))
+	if errGet != nil || !currPost.ShownTo(viewer.filter.Viewer) {
+		return nil, nil
+	}
+	root.h.Posts.countView(viewer.r, currPost)
+	return &gqlPost{h: root.h, post: currPost}, nil
+}
+
+func (root *gqlRoot) Posts(ctx context.Context, args struct {
+	Category *string
+	First    int32
+	Offset   int32
+	Order    string
+}) ([]*gqlPost, error) {
+	page := gqlPageArgs{First: args.First, Offset: args.Offset, Order: args.Order}
+	return root.h.listPosts(ctx, valueOf(args.Category), page)
+}
+
+func (root *gqlRoot) Category(args struct{ Name string }) (*gqlCategory, error) {
+	cat, errGet := root.h.Posts.CategoryRepo.Get(args.Name)
+	if errGet != nil {
+		return nil, apierr.Internal("error in getting category", errGet)
+	}
+	return &gqlCategory{h: root.h, category: cat}, nil
+}
+
+// listPosts lists the posts of the category or of the whole site the way the REST listings do
+func (h *GraphQLHandler) listPosts(ctx context.Context, categoryName string, args gqlPageArgs) ([]*gqlPost, error) {
+	first, offset := args.First, args.Offset
+	if first < 0 || first > maxPageSize {
+		return nil, apierr.Validation(ErrForm{Location: "query", Param: "first", Msg: "must be between 0 and 100"})
+	}
+	if offset < 0 {
+		return nil, apierr.Validation(ErrForm{Location: "query", Param: "offset", Msg: "must not be negative"})
+	}
+	viewer := viewerFrom(ctx)
+	// the whole page is paid up front, a short last page does not make a nested query cheaper
+	if errCost := viewer.spend(int(first)); errCost != nil {
+		return nil, errCost
+	}
+
+	var posts []post.Post
+	var errGet error
+	if categoryName == "" {
+		posts, errGet = h.Posts.PostRepo.GetAllPosts()
+	} else {
+		posts, errGet = h.Posts.PostRepo.GetCategory(categoryName)
+	}
+	if errGet != nil {
+		return nil, apierr.Internal("error in getting posts", errGet)
+	}
+	posts = viewer.filter.Apply(posts)
+	if args.Order == "NEW" {
+		// the repo lists in creation order, reversing it first keeps posts of the same second newest first
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+		sort.SliceStable(posts, func(i, j int) bool { return posts[i].Created > posts[j].Created })
+	} else {
+		sort.Stable(PostSort(posts))
+	}
+	if categoryName != "" {
+		posts = post.PinnedFirst(posts)
+	}
+	if int(offset) > len(posts) {
+		offset = int32(len(posts))
+	}
+	if int(first) > len(posts)-int(offset) {
+		first = int32(len(posts)) - offset
+	}
+	return h.wrapPosts(viewer, posts[offset:offset+first]), nil
+}
+
+// loadComments is the batch of gqlViewer.comments
+func (h *GraphQLHandler) loadComments(postIDs []string) (map[string]interface{}, error) {
+	byPost, errGet := h.Posts.CommentRepo.GetByPosts(postIDs)
+	if errGet != nil {
+		return nil, apierr.Internal("error in getting comments", errGet)
+	}
+	loaded := make(map[string]interface{}, len(byPost))
+	for postID, comments := range byPost {
+		loaded[postID] = comments
+	}
+	return loaded, nil
+}
+
+// loadAuthored is the batch of gqlViewer.authored
+func (h *GraphQLHandler) loadAuthored(logins []string) (map[string]interface{}, error) {
+	byAuthor, errGet := h.Posts.PostRepo.GetByAuthors(logins)
+	if errGet != nil {
+		return nil, apierr.Internal("error in getting posts", errGet)
+	}
+	loaded := make(map[string]interface{}, len(byAuthor))
+	for login, posts := range byAuthor {
+		loaded[login] = posts
+	}
+	return loaded, nil
+}
+
+func (u *gqlUser) ID() graphql.ID   { return graphql.ID(u.user.ID) }
+func (u *gqlUser) Username() string { return u.user.Login }
+
+func (u *gqlUser) Posts(ctx context.Context) ([]*gqlPost, error) {
+	viewer := viewerFrom(ctx)
+	authored, errGet := viewer.authored.get(u.user.Login)
+	if errGet != nil {
+		return nil, errGet
+	}
+	byAuthor, _ := authored.([]post.Post)
+	posts := viewer.filter.Apply(byAuthor)
+	if errCost := viewer.spend(len(posts)); errCost != nil {
+		return nil, errCost
+	}
+	sort.Stable(PostSort(posts))
+	return u.h.wrapPosts(viewer, posts), nil
+}
+
+func (u *gqlUser) Karma(ctx context.Context) (int32, error) {
+	authored, errGet := viewerFrom(ctx).authored.get(u.user.Login)
+	if errGet != nil {
+		return 0, errGet
+	}
+	byAuthor, _ := authored.([]post.Post)
+	karma := 0
+	for _, item := range byAuthor {
+		karma += item.Score
+	}
+	return int32(karma), nil
+}
+
+func (p *gqlPost) ID() graphql.ID          { return graphql.ID(p.post.ID) }
+func (p *gqlPost) Title() string           { return p.post.Title }
+func (p *gqlPost) Type() string            { return p.post.Type }
+func (p *gqlPost) URL() *string            { return optional(p.post.URL) }
+func (p *gqlPost) Text() *string           { return optional(p.post.Text) }
+func (p *gqlPost) TextHTML() *string       { return optional(p.post.TextHTML) }
+func (p *gqlPost) Category() string        { return p.post.Category }
+func (p *gqlPost) Flair() *string          { return optional(p.post.Flair) }
+func (p *gqlPost) NSFW() bool              { return p.post.NSFW }
+func (p *gqlPost) Spoiler() bool           { return p.post.Spoiler }
+func (p *gqlPost) Locked() bool            { return p.post.Locked }
+func (p *gqlPost) Pinned() bool            { return p.post.Pinned }
+func (p *gqlPost) Archived() bool          { return p.post.Archived }
+func (p *gqlPost) Created() string         { return p.post.Created }
+func (p *gqlPost) Score() int32            { return int32(p.post.Score) }
+func (p *gqlPost) UpvotePercentage() int32 { return int32(p.post.UpvotePercentage) }
+func (p *gqlPost) Views() int32            { return int32(p.post.Views) }
+func (p *gqlPost) CommentCount() int32     { return int32(p.post.CommentCount) }
+func (p *gqlPost) Author() *gqlUser        { return &gqlUser{h: p.h, user: p.post.Author} }
+
+func (p *gqlPost) Tags() []string {
+	if p.post.Tags == nil {
+		return []string{}
+	}
+	return p.post.Tags
+}
+
+func (p *gqlPost) Votes(ctx context.Context) ([]*gqlVote, error) {
+	if errCost := viewerFrom(ctx).spend(len(p.post.Votes)); errCost != nil {
+		return nil, errCost
+	}
+	votes := make([]*gqlVote, 0, len(p.post.Votes))
+	for _, vote := range p.post.Votes {
+		votes = append(votes, &gqlVote{vote: vote})
+	}
+	return votes, nil
+}
+
+func (p *gqlPost) Comments(ctx context.Context) ([]*gqlComment, error) {
+	viewer := viewerFrom(ctx)
+	loaded, errGet := viewer.comments.get(p.post.ID)
+	if errGet != nil {
+		return nil, errGet
+	}
+	byPost, _ := loaded.([]*comment.Comment)
+	visible := p.post.WithComments(byPost).VisibleTo(viewer.filter.Viewer).Comments
+	if errCost := viewer.spend(len(visible)); errCost != nil {
+		return nil, errCost
+	}
+	comments := make([]*gqlComment, 0, len(visible))
+	logins := make([]string, 0, len(visible))
+	for _, item := range visible {
+		comments = append(comments, &gqlComment{h: p.h, comment: item})
+		logins = append(logins, item.Author.Login)
+	}
+	viewer.authored.prime(logins...)
+	return comments, nil
+}
+
+func (p *gqlPost) ViewerVote(ctx context.Context) *int32 {
+	viewer := viewerFrom(ctx)
+	if viewer.session == nil {
+		return nil
+	}
+	vote := int32(0)
+	for _, item := range p.post.Votes {
+		if item.User == viewer.session.UserID {
+			vote = int32(item.Vote)
+		}
+	}
+	return &vote
+}
+
+func (v *gqlVote) Vote() int32      { return int32(v.vote.Vote) }
+func (v *gqlVote) Created() *string { return optional(v.vote.Created) }
+
+func (c *gqlComment) ID() graphql.ID   { return graphql.ID(c.comment.ID) }
+func (c *gqlComment) Body() string     { return c.comment.Body }
+func (c *gqlComment) BodyHTML() string { return c.comment.BodyHTML }
+func (c *gqlComment) Created() string  { return c.comment.Created }
+func (c *gqlComment) Author() *gqlUser { return &gqlUser{h: c.h, user: c.comment.Author} }
+
+func (c *gqlCategory) Name() string         { return c.category.Name }
+func (c *gqlCategory) Flairs() []string     { return emptyIfNil(c.category.Flairs) }
+func (c *gqlCategory) Moderators() []string { return emptyIfNil(c.category.Moderators) }
+
+func (c *gqlCategory) Posts(ctx context.Context, args gqlPageArgs) ([]*gqlPost, error) {
+	return c.h.listPosts(ctx, c.category.Name, args)
+}
+
+// =============================== POST ===============================
+func (root *gqlRoot) CreatePost(ctx context.Context, args struct{ Input gqlPostInput }) (*gqlPost, error) {
+	currUser, errUser := viewerFrom(ctx).currUser(token.ScopePost)
+	if errUser != nil {
+		return nil, errUser
+	}
+	input := args.Input
+	newPost := post.Post{
+		Category:  input.Category,
+		Title:     input.Title,
+		Type:      input.Type,
+		Text:      valueOf(input.Text),
+		URL:       valueOf(input.URL),
+		Flair:     valueOf(input.Flair),
+		NSFW:      input.NSFW,
+		Spoiler:   input.Spoiler,
+		PublishAt: valueOf(input.PublishAt),
+		ExpiresAt: valueOf(input.ExpiresAt),
+	}
+	if input.Tags != nil {
+		newPost.Tags = *input.Tags
+	}
+	if input.Poll != nil {
+		newPost.Poll = &post.Poll{ClosesAt: valueOf(input.Poll.ClosesAt)}
+		for _, option := range input.Poll.Options {
+			newPost.Poll.Options = append(newPost.Poll.Options, post.PollOption{Text: option})
+		}
+	}
+	created, _, errCreate := root.h.Posts.createPost(currUser, newPost)
+	if errCreate != nil {
+		return nil, errCreate
+	}
+	return &gqlPost{h: root.h, post: created}, nil
+}
+
+func (root *gqlRoot) AddComment(ctx context.Context, args struct {
+	PostID graphql.ID
+	Body   string
+}) (*gqlComment, error) {
+	currUser, errUser := viewerFrom(ctx).currUser(token.ScopeComment)
+	if errUser != nil {
+		return nil, errUser
+	}
+	_, created, errComment := root.h.Posts.addComment(currUser, string(args.PostID), args.Body)
+	if errComment != nil {
+		return nil, errComment
+	}
+	return &gqlComment{h: root.h, comment: created}, nil
+}
+
+func (root *gqlRoot) Vote(ctx context.Context, args struct {
+	PostID graphql.ID
+	Value  int32
+}) (*gqlPost, error) {
+	currUser, errUser := viewerFrom(ctx).currUser(token.ScopeVote)
+	if errUser != nil {
+		return nil, errUser
+	}
+	voted, errVote := root.h.Posts.votePost(currUser, string(args.PostID), int(args.Value), post.AnyVersion)
+	if errVote != nil {
+		return nil, errVote
+	}
+	return &gqlPost{h: root.h, post: voted}, nil
+}
+
+// ============================== DELETE ==============================
+func (root *gqlRoot) DeletePost(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	viewer := viewerFrom(ctx)
+	currUser, errUser := viewer.currUser(token.ScopePost)
+	if errUser != nil {
+		return false, errUser
+	}
+	if errDel := root.h.Posts.deletePost(viewer.r, currUser, string(args.ID)); errDel != nil {
+		return false, errDel
+	}
+	return true, nil
+}
+
+func (root *gqlRoot) DeleteComment(ctx context.Context, args struct {
+	PostID graphql.ID
+	ID     graphql.ID
+}) (*gqlPost, error) {
+	viewer := viewerFrom(ctx)
+	currUser, errUser := viewer.currUser(token.ScopeComment)
+	if errUser != nil {
+		return nil, errUser
+	}
+	currPost, errDel := root.h.Posts.deleteComment(viewer.r, currUser, string(args.PostID), string(args.ID))
+	if errDel != nil {
+		return nil, errDel
+	}
+	return &gqlPost{h: root.h, post: currPost}, nil
+}
+
+// ============================== HELP FUNC ==============================
+// present shows clients the same status and fields a REST response would carry
+func (h *GraphQLHandler) present(err error) (string, map[string]interface{}) {
+	typed := apierr.From(err)
+	if typed.Status >= http.StatusInternalServerError {
+		h.Logger.Errorw("Error in graphql resolver", "err", err)
+	}
+	extensions := map[string]interface{}{"status": typed.Status}
+	if len(typed.Fields) > 0 {
+		extensions["errors"] = typed.Fields
+	}
+	return typed.Message, extensions
+}
+
+// LogPanic reports panics the schema recovered from resolvers
+func (h *GraphQLHandler) LogPanic(ctx context.Context, value interface{}) {
+	h.Logger.Errorw("Panic in graphql resolver", "panic", value)
+}
+
+// findUser gives null for unknown logins, like a missing post
+func (h *GraphQLHandler) findUser(login string) (*gqlUser, error) {
+	found, errGet := h.Posts.UserRepo.GetUser(login)
+	if errGet == user.ErrNoUser {
+		return nil, nil
+	}
+	if errGet != nil {
+		return nil, apierr.Internal("error in getting user", errGet)
+	}
+	return &gqlUser{h: h, user: found}, nil
+}
+
+// wrapPosts hands the ids and authors of a listing to the loaders before any post resolves its fields
+func (h *GraphQLHandler) wrapPosts(viewer *gqlViewer, posts []post.Post) []*gqlPost {
+	wrapped := make([]*gqlPost, 0, len(posts))
+	postIDs := make([]string, 0, len(posts))
+	logins := make([]string, 0, len(posts))
+	for _, item := range posts {
+		wrapped = append(wrapped, &gqlPost{h: h, post: item})
+		postIDs = append(postIDs, item.ID)
+		logins = append(logins, item.Author.Login)
+	}
+	viewer.comments.prime(postIDs...)
+	viewer.authored.prime(logins...)
+	return wrapped
+}
+
+func viewerFrom(ctx context.Context) *gqlViewer {
+	viewer, ok := ctx.Value(gqlViewerKey).(*gqlViewer)
+	if !ok {
+		return &gqlViewer{r: &http.Request{}}
+	}
+	return viewer
+}
+
+// currUser is the user acting through the request, tokens must carry the scope of the mutation
+func (viewer *gqlViewer) currUser(scope string) (*user.User, error) {
+	if viewer.readOnly {
+		return nil, apierr.New(http.StatusMethodNotAllowed, "mutation is not allowed here")
+	}
+	if viewer.session == nil {
+		return nil, apierr.Unauthorized("authorize error")
+	}
+	if !viewer.session.HasScope(scope) {
+		return nil, apierr.Forbidden("token lacks scope " + scope)
+	}
+	return &user.User{ID: viewer.session.UserID, Login: viewer.session.UserLogin}, nil
+}
+
+// spend charges list items to the request, see maxGraphQLCost
+func (viewer *gqlViewer) spend(items int) error {
+	if atomic.AddInt64(&viewer.cost, int64(items)) > maxGraphQLCost {
+		return apierr.BadRequest(fmt.Sprintf("query asks for more than %d items, ask for smaller pages", maxGraphQLCost))
+	}
+	return nil
+}
+
+func newLoader(load func(keys []string) (map[string]interface{}, error)) *gqlLoader {
+	return &gqlLoader{
+		pending: make(map[string]bool),
+		loaded:  make(map[string]interface{}),
+		load:    load,
+	}
+}
+
+// prime collects keys to load with the next batch
+func (loader *gqlLoader) prime(keys ...string) {
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+	for _, key := range keys {
+		if _, ok := loader.loaded[key]; !ok {
+			loader.pending[key] = true
+		}
+	}
+}
+
+// get loads the key together with all collected ones, unless an earlier batch has it already.
+// Keys the batch does not find are remembered as nil.
+func (loader *gqlLoader) get(key string) (interface{}, error) {
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+	if value, ok := loader.loaded[key]; ok {
+		return value, nil
+	}
+	loader.pending[key] = true
+	keys := make([]string, 0, len(loader.pending))
+	for pending := range loader.pending {
+		keys = append(keys, pending)
+	}
+	loader.pending = make(map[string]bool)
+	values, errLoad := loader.load(keys)
+	if errLoad != nil {
+		return nil, errLoad
+	}
+	for _, loadedKey := range keys {
+		loader.loaded[loadedKey] = values[loadedKey]
+	}
+	return loader.loaded[key], nil
+}
+
+// optional turns empty strings into null
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func valueOf(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func emptyIfNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/audit"
+	"redditclone/pkg/category"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/spam"
+	"redditclone/pkg/user"
+)
+
+// countingComments counts the batches asked from the comment repository
+type countingComments struct {
+	comment.CommentRepo
+	batches int
+}
+
+func (repo *countingComments) GetByPosts(postIDs []string) (map[string][]*comment.Comment, error) {
+	repo.batches++
+	return repo.CommentRepo.GetByPosts(postIDs)
+}
+
+// countingPosts counts the batches asked from the post repository
+type countingPosts struct {
+	post.PostRepo
+	batches int
+}
+
+func (repo *countingPosts) GetByAuthors(userLogins []string) (map[string][]post.Post, error) {
+	repo.batches++
+	return repo.PostRepo.GetByAuthors(userLogins)
+}
+
+type gqlTestResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func newGraphQLTest(t *testing.T) (*GraphQLHandler, *countingPosts, *countingComments, user.User) {
+	t.Helper()
+	userRepo := user.NewMemoryRepo()
+	alice, _ := userRepo.AddUser("alice", "password1")
+	posts := &countingPosts{PostRepo: post.NewMemoryRepo()}
+	comments := &countingComments{CommentRepo: comment.NewMemoryRepo()}
+	postHandler := &PostHandler{
+		Logger:       zap.NewNop().Sugar(),
+		PostRepo:     posts,
+		CommentRepo:  comments,
+		CategoryRepo: category.NewMemoryRepo(),
+		UserRepo:     userRepo,
+		AuditRepo:    audit.NewMemoryRepo(),
+		Spam:         spam.NewPipeline(),
+	}
+	h, err := NewGraphQLHandler(zap.NewNop().Sugar(), postHandler)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return h, posts, comments, alice
+}
+
+func serveGraphQL(t *testing.T, h *GraphQLHandler, method, query string, viewer *user.User) gqlTestResponse {
+	t.Helper()
+	r := httptest.NewRequest(method, "/graphql?query="+url.QueryEscape(query), nil)
+	if method == "POST" {
+		body, _ := json.Marshal(map[string]string{"query": query})
+		r = httptest.NewRequest(method, "/graphql", strings.NewReader(string(body)))
+	}
+	if viewer != nil {
+		r = r.WithContext(session.ContextWithSession(r.Context(), &session.Session{UserID: viewer.ID, UserLogin: viewer.Login}))
+	}
+	w := httptest.NewRecorder()
+	if err := h.Serve(w, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp := gqlTestResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unexpected error: %v in %s", err, w.Body.String())
+	}
+	return resp
+}
+
+func TestGraphQLBatchesNestedLists(t *testing.T) {
+	h, posts, comments, alice := newGraphQLTest(t)
+	for i := 0; i < 5; i++ {
+		created, _, err := h.Posts.createPost(&alice, post.Post{Category: "music", Type: "text", Title: "post", Text: "text"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, _, err = h.Posts.addComment(&alice, created.ID, "comment"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	posts.batches, comments.batches = 0, 0
+
+	resp := serveGraphQL(t, h, "POST", `{ posts { comments { author { karma } } author { karma } } }`, nil)
+	if len(resp.Errors) != 0 {
+		t.Fatalf("unexpected errors: %+v", resp.Errors)
+	}
+	if comments.batches != 1 || posts.batches != 1 {
+		t.Errorf("got %d comment and %d post batches for 5 posts, expected one each", comments.batches, posts.batches)
+	}
+}
+
+func TestGraphQLCostMultipliesPages(t *testing.T) {
+	h, _, _, _ := newGraphQLTest(t)
+	// every field alone is cheap and shallow, together they ask for 5100 posts
+	fields := make([]string, 0, 51)
+	for i := 0; i < 51; i++ {
+		fields = append(fields, fmt.Sprintf("p%d: posts(first: 100) { id }", i))
+	}
+	resp := serveGraphQL(t, h, "POST", "{ "+strings.Join(fields, " ")+" }", nil)
+	if len(resp.Errors) == 0 || resp.Errors[0].Extensions["status"] != float64(400) {
+		t.Errorf("expensive query was not refused: %+v", resp.Errors)
+	}
+}
+
+func TestGraphQLHidesVoters(t *testing.T) {
+	h, _, _, alice := newGraphQLTest(t)
+	created, _, _ := h.Posts.createPost(&alice, post.Post{Category: "music", Type: "text", Title: "post", Text: "text"})
+
+	resp := serveGraphQL(t, h, "POST", `{ post(id: "`+created.ID+`") { votes { user { username } } } }`, nil)
+	if len(resp.Errors) == 0 {
+		t.Errorf("votes tell who voted")
+	}
+	resp = serveGraphQL(t, h, "POST", `{ post(id: "`+created.ID+`") { viewerVote } }`, &alice)
+	if len(resp.Errors) != 0 || string(resp.Data["post"]) != `{"viewerVote":1}` {
+		t.Errorf("got %s %+v, expected the own vote of the author", resp.Data["post"], resp.Errors)
+	}
+}
+
+func TestGraphQLGetRefusesMutations(t *testing.T) {
+	h, _, _, alice := newGraphQLTest(t)
+	created, _, _ := h.Posts.createPost(&alice, post.Post{Category: "music", Type: "text", Title: "post", Text: "text"})
+
+	resp := serveGraphQL(t, h, "GET", `mutation { deletePost(id: "`+created.ID+`") }`, &alice)
+	if len(resp.Errors) == 0 || resp.Errors[0].Extensions["status"] != float64(405) {
+		t.Errorf("GET ran a mutation: %+v", resp.Errors)
+	}
+	if _, err := h.Posts.PostRepo.Get(created.ID); err != nil {
+		t.Errorf("GET deleted the post")
+	}
+}
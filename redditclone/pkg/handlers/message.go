@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/message"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+)
+
+type MessageHandler struct {
+	Logger      *zap.SugaredLogger
+	MessageRepo message.MessageRepo
+	UserRepo    user.UserRepo
+	AuditRepo   audit.AuditRepo
+}
+
+type MessageForm struct {
+	Body string `json:"body"`
+}
+
+// ================================ GET ===============================
+func (h *MessageHandler) GetConversations(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := h.currSession(r)
+	if errSession != nil {
+		return errSession
+	}
+	conversations, errGet := h.MessageRepo.GetConversations(currSession.UserLogin)
+	if errGet != nil {
+		return apierr.Internal("error in getting conversations", errGet)
+	}
+	return jsonResp(h.Logger, w, conversations)
+}
+
+func (h *MessageHandler) GetConversation(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := h.currSession(r)
+	if errSession != nil {
+		return errSession
+	}
+	messages, errGet := h.MessageRepo.GetConversation(currSession.UserLogin, mux.Vars(r)["USER_LOGIN"])
+	if errGet != nil {
+		return apierr.Internal("error in getting messages", errGet)
+	}
+	return jsonResp(h.Logger, w, messages)
+}
+
+func (h *MessageHandler) UnreadCount(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := h.currSession(r)
+	if errSession != nil {
+		return errSession
+	}
+	unread, errCount := h.MessageRepo.UnreadCount(currSession.UserLogin)
+	if errCount != nil {
+		return apierr.Internal("error in counting unread", errCount)
+	}
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"unread": unread,
+	})
+}
+
+func (h *MessageHandler) GetBlocked(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := h.currSession(r)
+	if errSession != nil {
+		return errSession
+	}
+	blocked, errGet := h.MessageRepo.GetBlocked(currSession.UserLogin)
+	if errGet != nil {
+		return apierr.Internal("error in getting blocked users", errGet)
+	}
+	return jsonResp(h.Logger, w, blocked)
+}
+
+// =============================== POST ===============================
+func (h *MessageHandler) Send(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := h.currSession(r)
+	if errSession != nil {
+		return errSession
+	}
+	form := &MessageForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
+	}
+	recipient, errUser := h.UserRepo.GetUser(mux.Vars(r)["USER_LOGIN"])
+	if errUser != nil {
+		h.Logger.Infow("Error in getting recipient", errUser)
+		return apierr.NotFound("user not found")
+	}
+	msg, errSend := h.MessageRepo.Send(currSession.UserLogin, recipient.Login, form.Body)
+	switch errSend {
+	case nil:
+	case message.ErrBlocked:
+		return apierr.Forbidden(errSend.Error())
+	case message.ErrEmptyBody, message.ErrLongBody, message.ErrSelf:
+		return apierr.Validation(ErrForm{
+			Location: "body",
+			Param:    "body",
+			Msg:      errSend.Error(),
+		})
+	default:
+		return apierr.Internal("error in sending message", errSend)
+	}
+	w.WriteHeader(http.StatusCreated)
+	return jsonResp(h.Logger, w, msg)
+}
+
+func (h *MessageHandler) MarkRead(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := h.currSession(r)
+	if errSession != nil {
+		return errSession
+	}
+	marked, errMark := h.MessageRepo.MarkRead(currSession.UserLogin, mux.Vars(r)["USER_LOGIN"])
+	if errMark != nil {
+		return apierr.Internal("error in marking messages read", errMark)
+	}
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"marked": marked,
+	})
+}
+
+func (h *MessageHandler) Block(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := h.currSession(r)
+	if errSession != nil {
+		return errSession
+	}
+	blocked, errUser := h.UserRepo.GetUser(mux.Vars(r)["USER_LOGIN"])
+	if errUser != nil {
+		h.Logger.Infow("Error in getting user", errUser)
+		return apierr.NotFound("user not found")
+	}
+	errBlock := h.MessageRepo.Block(currSession.UserLogin, blocked.Login)
+	if errBlock != nil {
+		h.Logger.Infow("Error in blocking user", errBlock)
+		return apierr.Validation(ErrForm{
+			Location: "params",
+			Param:    "login",
+			Msg:      errBlock.Error(),
+			Value:    blocked.Login,
+		})
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionUserBlock, blocked.ID)
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"message": "success",
+	})
+}
+
+// ============================== DELETE ==============================
+func (h *MessageHandler) Unblock(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := h.currSession(r)
+	if errSession != nil {
+		return errSession
+	}
+	errUnblock := h.MessageRepo.Unblock(currSession.UserLogin, mux.Vars(r)["USER_LOGIN"])
+	if errUnblock != nil {
+		return apierr.Internal("error in unblocking user", errUnblock)
+	}
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"message": "success",
+	})
+}
+
+// ============================== HELP FUNC ==============================
+func (h *MessageHandler) currSession(r *http.Request) (*session.Session, error) {
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		h.Logger.Infow("Unauthorized", errSession)
+		return nil, apierr.Unauthorized("bad token")
+	}
+	return currSession, nil
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/message"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+)
+
+func newMessageTest() (*MessageHandler, user.User, user.User) {
+	userRepo := user.NewMemoryRepo()
+	alice, _ := userRepo.AddUser("alice", "password1")
+	bob, _ := userRepo.AddUser("bob", "password2")
+	h := &MessageHandler{
+		Logger:      zap.NewNop().Sugar(),
+		MessageRepo: message.NewMemoryRepo(),
+		UserRepo:    userRepo,
+		AuditRepo:   audit.NewMemoryRepo(),
+	}
+	return h, alice, bob
+}
+
+func messageRequest(method, path, body string, from user.User, to string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r = mux.SetURLVars(r, map[string]string{"USER_LOGIN": to})
+	return r.WithContext(session.ContextWithSession(r.Context(), &session.Session{UserID: from.ID, UserLogin: from.Login}))
+}
+
+func TestSendMessageStatuses(t *testing.T) {
+	h, alice, bob := newMessageTest()
+	cases := []struct {
+		name   string
+		to     string
+		body   string
+		status int
+	}{
+		{"unknown recipient", "ghost", `{"body":"hi"}`, http.StatusNotFound},
+		{"self", "alice", `{"body":"hi"}`, http.StatusUnprocessableEntity},
+		{"empty", "bob", `{"body":""}`, http.StatusUnprocessableEntity},
+		{"long", "bob", `{"body":"` + strings.Repeat("a", message.MaxBodyLen+1) + `"}`, http.StatusUnprocessableEntity},
+	}
+	for _, item := range cases {
+		err := h.Send(httptest.NewRecorder(), messageRequest("POST", "/api/messages/"+item.to, item.body, alice, item.to))
+		if got := apierr.From(err).Status; err == nil || got != item.status {
+			t.Errorf("%s: got %v, expected status %d", item.name, err, item.status)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	if err := h.Send(w, messageRequest("POST", "/api/messages/bob", `{"body":"hi"}`, alice, "bob")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.Code != http.StatusCreated {
+		t.Errorf("got status %d, expected 201", w.Code)
+	}
+	if unread, _ := h.MessageRepo.UnreadCount(bob.Login); unread != 1 {
+		t.Errorf("bob has %d unread, expected 1", unread)
+	}
+}
+
+func TestBlockedSenderIsForbidden(t *testing.T) {
+	h, alice, bob := newMessageTest()
+	if err := h.Block(httptest.NewRecorder(), messageRequest("POST", "/api/blocks/alice", "", bob, "alice")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := h.Send(httptest.NewRecorder(), messageRequest("POST", "/api/messages/bob", `{"body":"hi"}`, alice, "bob"))
+	if apierr.From(err).Status != http.StatusForbidden {
+		t.Errorf("blocked sender got %v, expected 403", err)
+	}
+	if err = h.Unblock(httptest.NewRecorder(), messageRequest("DELETE", "/api/blocks/alice", "", bob, "alice")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = h.Send(httptest.NewRecorder(), messageRequest("POST", "/api/messages/bob", `{"body":"hi"}`, alice, "bob")); err != nil {
+		t.Errorf("unblocked sender got %v", err)
+	}
+}
+
+func TestMessagesNeedSession(t *testing.T) {
+	h, _, _ := newMessageTest()
+	err := h.GetConversations(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/inbox", nil))
+	if apierr.From(err).Status != http.StatusUnauthorized {
+		t.Errorf("anonymous request got %v, expected 401", err)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/post"
+)
+
+// HiddenComment is a shadow hidden comment together with the post it belongs to
+type HiddenComment struct {
+	PostID  string           `json:"postId"`
+	Comment *comment.Comment `json:"comment"`
+}
+
+// HiddenContent is everything the spam checks shadow hid in a category
+type HiddenContent struct {
+	Posts    []post.Post     `json:"posts"`
+	Comments []HiddenComment `json:"comments"`
+}
+
+// ================================ GET ===============================
+// GetHidden lists shadow hidden posts and comments of the category for its moderators to review
+func (h *PostHandler) GetHidden(w http.ResponseWriter, r *http.Request) error {
+	name := mux.Vars(r)["CATEGORY_NAME"]
+	if _, errModerator := requireModerator(h.Logger, h.UserRepo, h.CategoryRepo, r, name); errModerator != nil {
+		return errModerator
+	}
+	posts, errGet := h.PostRepo.GetCategory(name)
+	if errGet != nil {
+		return apierr.Internal("error in getting posts", errGet)
+	}
+	postIDs := make([]string, 0, len(posts))
+	hidden := HiddenContent{
+		Posts:    make([]post.Post, 0),
+		Comments: make([]HiddenComment, 0),
+	}
+	for _, item := range posts {
+		postIDs = append(postIDs, item.ID)
+		if item.Hidden {
+			hidden.Posts = append(hidden.Posts, item)
+		}
+	}
+	comments, errComments := h.CommentRepo.GetByPosts(postIDs)
+	if errComments != nil {
+		return apierr.Internal("error in getting comments", errComments)
+	}
+	for _, postID := range postIDs {
+		for _, item := range comments[postID] {
+			if item.Hidden {
+				hidden.Comments = append(hidden.Comments, HiddenComment{PostID: postID, Comment: item})
+			}
+		}
+	}
+	return jsonResp(h.Logger, w, hidden)
+}
+
+// =============================== POST ===============================
+// UnhidePost shows a post the spam checks hid, on behalf of a moderator of its category
+func (h *PostHandler) UnhidePost(w http.ResponseWriter, r *http.Request) error {
+	postID := mux.Vars(r)["POST_ID"]
+	currPost, errGet := h.PostRepo.Get(postID)
+	if errGet != nil {
+		return apierr.NotFound("post not found")
+	}
+	currSession, errModerator := requireModerator(h.Logger, h.UserRepo, h.CategoryRepo, r, currPost.Category)
+	if errModerator != nil {
+		return errModerator
+	}
+	updated, errUpdate := h.PostRepo.Update(postID, post.AnyVersion, func(item *post.Post) error {
+		item.Hidden = false
+		return nil
+	})
+	switch errUpdate {
+	case nil:
+	case post.ErrNoPost:
+		return apierr.NotFound("post not found")
+	default:
+		return apierr.Internal("error in unhiding post", errUpdate)
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionUnhide, postID)
+	updated, errComments := h.withComments(updated)
+	if errComments != nil {
+		return apierr.Internal("error in getting comments", errComments)
+	}
+	return jsonResp(h.Logger, w, updated.VisibleTo(currSession.UserLogin))
+}
+
+// UnhideComment shows a comment the spam checks hid, on behalf of a moderator of the post category
+func (h *PostHandler) UnhideComment(w http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	postID, commentID := vars["POST_ID"], vars["COMMENT_ID"]
+	currPost, errGet := h.PostRepo.Get(postID)
+	if errGet != nil {
+		return apierr.NotFound("post not found")
+	}
+	currSession, errModerator := requireModerator(h.Logger, h.UserRepo, h.CategoryRepo, r, currPost.Category)
+	if errModerator != nil {
+		return errModerator
+	}
+	shown, errUnhide := h.CommentRepo.SetHidden(commentID, postID, false)
+	if errUnhide != nil {
+		h.Logger.Infow("Error in unhiding comment", errUnhide)
+		return apierr.NotFound("comment not found")
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionUnhide, postID+"/"+commentID)
+	return jsonResp(h.Logger, w, shown)
+}
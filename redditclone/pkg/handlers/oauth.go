@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/oauth"
+	"redditclone/pkg/session"
+	"redditclone/pkg/twofactor"
+	"redditclone/pkg/user"
+)
+
+const oauthStateCookie = "oauth_state"
+
+type OAuthHandler struct {
+	Logger        *zap.SugaredLogger
+	Providers     map[string]*oauth.Provider
+	States        *oauth.StateStore
+	UserRepo      user.UserRepo
+	AuditRepo     audit.AuditRepo
+	Sessions      session.SessRepo
+	TwoFactorRepo twofactor.TwoFactorRepo
+}
+
+// ================================ GET ===============================
+func (h *OAuthHandler) Login(w http.ResponseWriter, r *http.Request) error {
+	provider, errProvider := h.provider(r)
+	if errProvider != nil {
+		return errProvider
+	}
+	state, errState := h.States.New(provider.Name)
+	if errState != nil {
+		return apierr.Internal("error in creating state", errState)
+	}
+	// the cookie binds the state to this browser
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/api/oauth/",
+		MaxAge:   int(h.States.TTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, provider.AuthCodeURL(state), http.StatusFound)
+	return nil
+}
+
+func (h *OAuthHandler) Callback(w http.ResponseWriter, r *http.Request) error {
+	provider, errProvider := h.provider(r)
+	if errProvider != nil {
+		return errProvider
+	}
+	query := r.URL.Query()
+	if errParam := query.Get("error"); errParam != "" {
+		h.Logger.Infow("OAuth provider error", "provider", provider.Name, "error", errParam)
+		return apierr.Unauthorized("provider denied login")
+	}
+	state := query.Get("state")
+	cookie, errCookie := r.Cookie(oauthStateCookie)
+	if errCookie != nil || cookie.Value != state || !h.States.Consume(provider.Name, state) {
+		h.Logger.Infow("Bad oauth state", "provider", provider.Name)
+		return apierr.BadRequest("bad state")
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   oauthStateCookie,
+		Path:   "/api/oauth/",
+		MaxAge: -1,
+	})
+
+	accessToken, errExchange := provider.Exchange(r.Context(), query.Get("code"))
+	if errExchange != nil {
+		h.Logger.Infow("Error in code exchange", errExchange, "provider", provider.Name)
+		return apierr.New(http.StatusBadGateway, "error in code exchange")
+	}
+	identity, errInfo := provider.UserInfo(r.Context(), accessToken)
+	if errInfo != nil {
+		h.Logger.Infow("Error in getting userinfo", errInfo, "provider", provider.Name)
+		return apierr.New(http.StatusBadGateway, "error in getting userinfo")
+	}
+	currUser, errUser := h.UserRepo.GetOrCreateExternal(identity.Provider, identity.Subject, identity.Login)
+	if errUser != nil {
+		return apierr.Internal("error in linking user", errUser)
+	}
+	if sent, errChallenge := challengeResp(h.Logger, h.Sessions, h.TwoFactorRepo, w, currUser); sent || errChallenge != nil {
+		return errChallenge
+	}
+
+	sess, errSession := h.Sessions.Create(currUser)
+	if errSession != nil {
+		return apierr.Internal("error in session creating", errSession)
+	}
+	tokenString, errToken := h.Sessions.CreateToken(sess)
+	if errToken != nil {
+		return apierr.Internal(errToken.Error(), errToken)
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currUser.Login, audit.ActionOAuthLogin, provider.Name+"/"+identity.Subject)
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"token": tokenString,
+	})
+}
+
+// ============================== HELP FUNC ==============================
+func (h *OAuthHandler) provider(r *http.Request) (*oauth.Provider, error) {
+	provider, ok := h.Providers[mux.Vars(r)["PROVIDER"]]
+	if !ok {
+		return nil, apierr.NotFound("unknown provider")
+	}
+	return provider, nil
+}
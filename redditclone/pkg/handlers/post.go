@@ -1,40 +1,98 @@
 package handlers
 
 import (
+	"crypto/sha1"
 	"encoding/json"
-	"io"
+	"fmt"
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/category"
 	"redditclone/pkg/comment"
+	"redditclone/pkg/httpcache"
 	"redditclone/pkg/post"
 	"redditclone/pkg/session"
+	"redditclone/pkg/spam"
 	"redditclone/pkg/user"
+	"redditclone/pkg/views"
 )
 
 type PostHandler struct {
-	Logger      *zap.SugaredLogger
-	PostRepo    post.PostRepo
-	CommentRepo comment.CommentRepo
-	Sessions    session.SessRepo
+	Logger       *zap.SugaredLogger
+	PostRepo     post.PostRepo
+	CommentRepo  comment.CommentRepo
+	CategoryRepo category.CategoryRepo
+	UserRepo     user.UserRepo
+	AuditRepo    audit.AuditRepo
+	Sessions     session.SessRepo
+	Spam         spam.Checker
+	// Cache keeps rendered read responses, nil disables it
+	Cache *httpcache.Cache
+	// Views counts post reads, nil disables counting
+	Views *views.Counter
+	// more than VoteBurstLimit votes within VoteBurstWindow are reported as possible brigading
+	VoteBurstWindow time.Duration
+	VoteBurstLimit  int
 }
 
+// PostForm lists everything an author may set on a new post, the state, counters
+// and moderator flags of post.Post never come from the request
 type PostForm struct {
-	Category string `json:"category"`
-	Text     string `json:"text"`
-	Title    string `json:"title"`
-	Type     string `json:"type,omitempty"`
-	URL      string `json:"url,omitempty"`
+	Category  string    `json:"category"`
+	Text      string    `json:"text"`
+	Title     string    `json:"title"`
+	Type      string    `json:"type,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Flair     string    `json:"flair,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	NSFW      bool      `json:"nsfw"`
+	Spoiler   bool      `json:"spoiler"`
+	PublishAt string    `json:"publishAt,omitempty"`
+	ExpiresAt string    `json:"expiresAt,omitempty"`
+	Poll      *PollForm `json:"poll,omitempty"`
+}
+
+type PollForm struct {
+	Options []struct {
+		Text string `json:"text"`
+	} `json:"options"`
+	ClosesAt string `json:"closesAt,omitempty"`
 }
 
 type CommentForm struct {
 	Comment string `json:"comment"`
 }
 
+type VoteForm struct {
+	Vote *int `json:"vote"`
+}
+
+type PollVoteForm struct {
+	Option *int `json:"option"`
+}
+
+type StateForm struct {
+	Action string `json:"action"`
+}
+
+type CrosspostForm struct {
+	Category string `json:"category"`
+	Title    string `json:"title"`
+	Flair    string `json:"flair,omitempty"`
+}
+
+type PostWithDiscussions struct {
+	post.Post
+	OtherDiscussions []post.Post `json:"otherDiscussions,omitempty"`
+}
+
 type PostSort []post.Post
 
 func (a PostSort) Len() int           { return len(a) }
@@ -42,97 +100,133 @@ func (a PostSort) Less(i, j int) bool { return a[i].Score > a[j].Score }
 func (a PostSort) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 
 // ================================ GET ===============================
-func (h *PostHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
-	posts, errGetData := h.PostRepo.GetAllPosts()
-	if errGetData != nil {
-		h.Logger.Infow("Error in getting posts", errGetData)
-		http.Error(w, `Error in getting posts`, http.StatusInternalServerError)
-		return
-	}
-	sort.Sort(PostSort(posts))
-	resp, errMarsh := json.Marshal(posts)
-	if errMarsh != nil {
-		h.Logger.Infow("Error in marshaling response", errMarsh)
-		h.errorResp(w, http.StatusBadRequest, "cant unpack payload")
-		return
-	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in writing", errWrite)
-		return
-	}
+func (h *PostHandler) GetPosts(w http.ResponseWriter, r *http.Request) error {
+	filter := h.listFilter(r)
+	return h.cachedResp(w, r, listCacheKey(r, filter), func() (interface{}, error) {
+		posts, errGetData := h.PostRepo.GetAllPosts()
+		if errGetData != nil {
+			return nil, apierr.Internal("error in getting posts", errGetData)
+		}
+		posts = filter.Apply(posts)
+		sort.Sort(PostSort(posts))
+		return posts, nil
+	})
 }
 
-func (h *PostHandler) GetCategoryPosts(w http.ResponseWriter, r *http.Request) {
+func (h *PostHandler) GetCategoryPosts(w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	category, errVars := vars["CATEGORY_NAME"]
 	if !errVars {
 		h.Logger.Infow("Error in getting category", errVars)
-		http.Error(w, `Bad category`, http.StatusBadGateway)
-		return
-	}
-	posts, errGet := h.PostRepo.GetCategory(category)
-	if errGet != nil {
-		h.Logger.Infow("Error in getting posts", errGet)
-		http.Error(w, `Error in getting posts`, http.StatusInternalServerError)
-		return
-	}
-	sort.Sort(PostSort(posts))
-	resp, errMarsh := json.Marshal(posts)
-	if errMarsh != nil {
-		h.Logger.Infow("Error in marshaling response", errMarsh)
-		h.errorResp(w, http.StatusBadRequest, "cant unpack payload")
-		return
-	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in writing", errWrite)
-		return
+		return apierr.New(http.StatusBadGateway, "bad category")
 	}
+	filter := h.listFilter(r)
+	return h.cachedResp(w, r, listCacheKey(r, filter), func() (interface{}, error) {
+		posts, errGet := h.PostRepo.GetCategory(category)
+		if errGet != nil {
+			return nil, apierr.Internal("error in getting posts", errGet)
+		}
+		posts = filter.Apply(posts)
+		sort.Sort(PostSort(posts))
+		return post.PinnedFirst(posts), nil
+	})
 }
 
-func (h *PostHandler) GetPostAndComment(w http.ResponseWriter, r *http.Request) {
+func (h *PostHandler) GetPostAndComment(w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	postID, errVars := vars["POST_ID"]
 	if !errVars {
 		h.Logger.Infow("Error in getting ID", errVars)
-		http.Error(w, `Bad id`, http.StatusBadGateway)
-		return
+		return apierr.New(http.StatusBadGateway, "bad id")
+	}
+	viewer := viewerLogin(r)
+	currPost, errGet := h.PostRepo.Get(postID)
+	if errGet != nil || !currPost.ShownTo(viewer) {
+		return apierr.NotFound("post not found")
 	}
-	post, errGet := h.PostRepo.GetPost(postID)
+	// views are counted for every read, cached and 304 answers included
+	h.countView(r, currPost)
+	return h.cachedResp(w, r, r.URL.Path+"|"+viewer, func() (interface{}, error) {
+		post, errGet := h.PostRepo.Get(postID)
+		if errGet != nil || !post.ShownTo(viewer) {
+			return nil, apierr.NotFound("post not found")
+		}
+		post, errComments := h.withComments(post)
+		if errComments != nil {
+			return nil, apierr.Internal("error in getting comments", errComments)
+		}
+		return post.VisibleTo(viewer), nil
+	})
+}
+
+// Stats shows the author how many people read the post, pending views are not included yet
+func (h *PostHandler) Stats(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		h.Logger.Infow("Unauthorized", errSession)
+		return apierr.Unauthorized("bad token")
+	}
+	currPost, errGet := h.PostRepo.Get(mux.Vars(r)["POST_ID"])
 	if errGet != nil {
-		h.Logger.Infow("Error in getting posts", errGet)
-		http.Error(w, `Error in getting posts`, http.StatusInternalServerError)
-		return
+		return apierr.NotFound("post not found")
+	}
+	if currPost.Author.ID != currSession.UserID {
+		return apierr.Forbidden("only the author can see post stats")
 	}
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"uniqueViews": currPost.Views,
+		"totalViews":  currPost.TotalViews,
+	})
+}
 
-	resp, errMarsh := json.Marshal(post)
-	if errMarsh != nil {
-		h.Logger.Infow("Error in marshaling response", errMarsh)
-		h.errorResp(w, http.StatusBadRequest, "cant unpack payload")
-		return
+// GetPoll shows the options of the poll, counts stay hidden until the viewer votes or the poll closes
+func (h *PostHandler) GetPoll(w http.ResponseWriter, r *http.Request) error {
+	viewerID := ""
+	if currSession, errSession := session.SessionFromContext(r.Context()); errSession == nil {
+		viewerID = currSession.UserID
 	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in writing", errWrite)
-		return
+	currPost, errGet := h.PostRepo.Get(mux.Vars(r)["POST_ID"])
+	if errGet != nil || !currPost.ShownTo(viewerLogin(r)) || currPost.Poll == nil {
+		return apierr.NotFound("poll not found")
+	}
+	return jsonResp(h.Logger, w, currPost.Poll.Results(viewerID, time.Now()))
+}
+
+// OtherDiscussions lists posts sharing the link of the given one, crossposts included
+func (h *PostHandler) OtherDiscussions(w http.ResponseWriter, r *http.Request) error {
+	currPost, errGet := h.PostRepo.Get(mux.Vars(r)["POST_ID"])
+	if errGet != nil {
+		h.Logger.Infow("Error in getting post", errGet)
+		return apierr.NotFound("post not found")
 	}
+	others := make([]post.Post, 0)
+	if currPost.URL != "" {
+		sameURL, errOthers := h.PostRepo.GetByURL(currPost.URL)
+		if errOthers != nil {
+			return apierr.Internal("error in getting posts", errOthers)
+		}
+		for _, item := range sameURL {
+			if item.ID != currPost.ID {
+				others = append(others, item)
+			}
+		}
+	}
+	others = h.listFilter(r).Apply(others)
+	sort.Sort(PostSort(others))
+	return jsonResp(h.Logger, w, others)
 }
 
-func (h *PostHandler) Rating(w http.ResponseWriter, r *http.Request) {
+func (h *PostHandler) Rating(w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	postID, errVars := vars["POST_ID"]
 	if !errVars {
 		h.Logger.Infow("Error in getting ID", errVars)
-		http.Error(w, `Bad id`, http.StatusBadGateway)
-		return
+		return apierr.New(http.StatusBadGateway, "bad id")
 	}
 	currSession, errSession := session.SessionFromContext(r.Context())
 	if errSession != nil {
 		h.Logger.Infow("Unauthorized", errSession.Error())
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		h.errorResp(w, http.StatusUnauthorized, "bad token")
-		return
+		return apierr.Unauthorized("authorize error")
 	}
 	currUser := &user.User{}
 	currUser.ID = currSession.UserID
@@ -149,62 +243,91 @@ func (h *PostHandler) Rating(w http.ResponseWriter, r *http.Request) {
 	default: // case "downvote"
 		vote = 0
 	}
-	elem, errVote := h.PostRepo.UpdateVote(vote, postID, currUser)
+	// the same checks as the vote endpoint, posts hidden from the user can not be voted on by id
+	elem, errVote := h.votePost(currUser, postID, vote, post.AnyVersion)
 	if errVote != nil {
-		h.Logger.Infow("Error in UpdateVote", errVote)
-		http.Error(w, `Error in updating vote`, http.StatusInternalServerError)
-		return
+		return errVote
+	}
+	elem, errComments := h.withComments(elem)
+	if errComments != nil {
+		return apierr.Internal("error in getting comments", errComments)
 	}
 
-	resp, errMarshal := json.Marshal(elem)
-	if errMarshal != nil {
-		h.Logger.Infow("Error in Marshaling response", errMarshal)
-		h.errorResp(w, http.StatusBadRequest, "cant unpack payload")
-		return
+	w.Header().Set("ETag", elem.ETag())
+	return jsonResp(h.Logger, w, elem.VisibleTo(currUser.Login))
+}
+
+// Vote sets the vote of the current user to the given value, so repeating the request changes nothing
+func (h *PostHandler) Vote(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		h.Logger.Infow("Unauthorized", errSession)
+		return apierr.Unauthorized("bad token")
 	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in writing", errWrite)
-		return
+	currUser := &user.User{}
+	currUser.ID = currSession.UserID
+	currUser.Login = currSession.UserLogin
+
+	form := &VoteForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
+	}
+	if form.Vote == nil {
+		return apierr.Validation(errVoteValue)
 	}
+
+	postID := mux.Vars(r)["POST_ID"]
+	version := post.AnyVersion
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		currPost, errGet := h.PostRepo.Get(postID)
+		if errGet != nil {
+			h.Logger.Infow("Error in getting post", errGet)
+			return apierr.NotFound("post not found")
+		}
+		if ifMatch != currPost.ETag() {
+			w.Header().Set("ETag", currPost.ETag())
+			return apierr.New(http.StatusPreconditionFailed, "post was changed")
+		}
+		// the vote only lands if nobody changed the post since the check
+		version = currPost.Version
+	}
+
+	elem, errVote := h.votePost(currUser, postID, *form.Vote, version)
+	if errVote != nil {
+		return errVote
+	}
+	elem, errComments := h.withComments(elem)
+	if errComments != nil {
+		return apierr.Internal("error in getting comments", errComments)
+	}
+
+	w.Header().Set("ETag", elem.ETag())
+	return jsonResp(h.Logger, w, elem.VisibleTo(currUser.Login))
 }
 
-func (h *PostHandler) UserPosts(w http.ResponseWriter, r *http.Request) {
+func (h *PostHandler) UserPosts(w http.ResponseWriter, r *http.Request) error {
 	vars := mux.Vars(r)
 	userLogin, errVars := vars["USER_LOGIN"]
 	if !errVars {
 		h.Logger.Infow("Error in getting login", errVars)
-		http.Error(w, `Bad login`, http.StatusBadGateway)
-		return
+		return apierr.New(http.StatusBadGateway, "bad login")
 	}
 
 	posts, errGet := h.PostRepo.GetUserPosts(userLogin)
 	if errGet != nil {
-		h.Logger.Infow("Error in getting posts", errGet)
-		http.Error(w, `Error in getting posts`, http.StatusInternalServerError)
-		return
+		return apierr.Internal("error in getting posts", errGet)
 	}
+	posts = h.listFilter(r).Apply(posts)
 	sort.Sort(PostSort(posts))
-	resp, errMarsh := json.Marshal(posts)
-	if errMarsh != nil {
-		h.Logger.Infow("Error in marshaling response", errMarsh)
-		h.errorResp(w, http.StatusBadRequest, "cant unpack payload")
-	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in writing", errWrite)
-		return
-	}
+	return jsonResp(h.Logger, w, posts)
 }
 
 // =============================== POST ===============================
-func (h *PostHandler) AddPost(w http.ResponseWriter, r *http.Request) {
+func (h *PostHandler) AddPost(w http.ResponseWriter, r *http.Request) error {
 
-	body, errBodyRead := io.ReadAll(r.Body)
+	body, errBodyRead := readBody(r)
 	if errBodyRead != nil {
-		h.Logger.Infow("Error in reading req body", errBodyRead)
-		http.Error(w, `Error in reading req body`, http.StatusInternalServerError)
-		return
+		return errBodyRead
 	}
 	defer func(r *http.Request) {
 		errBodyClose := r.Body.Close()
@@ -217,57 +340,126 @@ func (h *PostHandler) AddPost(w http.ResponseWriter, r *http.Request) {
 	currSession, errSession := session.SessionFromContext(r.Context())
 	if errSession != nil {
 		h.Logger.Infow("Unauthorized", errSession)
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		h.errorResp(w, http.StatusUnauthorized, "bad token")
-		return
+		return apierr.Unauthorized("authorize error")
 	}
 
-	post := post.Post{}
-	errUnmarsh := json.Unmarshal(body, &post)
+	form := &PostForm{}
+	errUnmarsh := json.Unmarshal(body, form)
 	if errUnmarsh != nil {
-		h.Logger.Infow("Error in unmarshaling", errUnmarsh)
-		http.Error(w, `Error in unmarshaling`, http.StatusInternalServerError)
-		return
+		h.Logger.Infow("Error in unmarshaling Post", errUnmarsh)
+		return apierr.BadRequest("cant unpack payload")
 	}
 	currUser := &user.User{}
 	currUser.ID = currSession.UserID
 	currUser.Login = currSession.UserLogin
 
-	post.Author = *currUser
-	post, errCreate := h.PostRepo.Create(post)
+	post, others, errCreate := h.createPost(currUser, form.post())
 	if errCreate != nil {
-		h.Logger.Infow("Error in creating post", errCreate)
-		http.Error(w, `Error in creating post`, http.StatusInternalServerError)
-		return
+		return errCreate
 	}
-	post, errUpd := h.PostRepo.UpdateVote(1, post.ID, currUser)
-	if errUpd != nil {
-		h.Logger.Infow("Error in UpdateVote", errUpd)
-		http.Error(w, `Error in updating vote`, http.StatusInternalServerError)
-		return
+
+	return jsonResp(h.Logger, w, PostWithDiscussions{
+		Post:             post,
+		OtherDiscussions: others,
+	})
+}
+
+func (h *PostHandler) Crosspost(w http.ResponseWriter, r *http.Request) error {
+	body, errBodyRead := readBody(r)
+	if errBodyRead != nil {
+		return errBodyRead
 	}
+	defer func(r *http.Request) {
+		errBodyClose := r.Body.Close()
+		if errBodyClose != nil {
+			h.Logger.Infow("Error in closing req body", errBodyClose)
+			return
+		}
+	}(r)
 
-	resp, errMarsh := json.Marshal(post)
-	if errMarsh != nil {
-		h.Logger.Infow("Error in marshaling", errMarsh)
-		http.Error(w, `Error in marshaling`, http.StatusInternalServerError)
-		return
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		h.Logger.Infow("Unauthorized", errSession)
+		return apierr.Unauthorized("bad token")
 	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in writing responce", errWrite)
-		return
+	currUser := &user.User{}
+	currUser.ID = currSession.UserID
+	currUser.Login = currSession.UserLogin
+
+	form := &CrosspostForm{}
+	errUnmarsh := json.Unmarshal(body, form)
+	if errUnmarsh != nil {
+		h.Logger.Infow("Error in unmarshaling", errUnmarsh)
+		return apierr.BadRequest("cant unpack payload")
+	}
+	if form.Category == "" {
+		return apierr.Validation(ErrForm{
+			Location: "body",
+			Param:    "category",
+			Msg:      "is required",
+		})
+	}
+
+	original, errGet := h.PostRepo.Get(mux.Vars(r)["POST_ID"])
+	if errGet != nil || !original.ShownTo(currUser.Login) {
+		h.Logger.Infow("Error in getting post", errGet)
+		return apierr.NotFound("post not found")
+	}
+	if original.Type == post.TypePoll {
+		return apierr.Validation(ErrForm{Location: "path", Param: "POST_ID", Msg: "polls cant be crossposted"})
+	}
+	// crossposts of crossposts point straight at the original discussion
+	parentID := original.ID
+	if original.CrosspostParent != "" {
+		parentID = original.CrosspostParent
+	}
+	title := form.Title
+	if title == "" {
+		title = original.Title
+	}
+
+	crosspost := post.Post{
+		Category:        form.Category,
+		CrosspostParent: parentID,
+		Flair:           form.Flair,
+		NSFW:            original.NSFW,
+		Spoiler:         original.Spoiler,
+		Tags:            original.Tags,
+		Text:            original.Text,
+		Title:           title,
+		Type:            original.Type,
+		URL:             original.URL,
+	}
+	if errForm := h.validatePost(&crosspost); errForm != nil {
+		h.Logger.Infow("Invalid crosspost", "param", errForm.Param, "msg", errForm.Msg)
+		return apierr.Validation(*errForm)
+	}
+	verdict := h.checkSpam(currUser, spam.KindPost, crosspost.Category, crosspost.Title+"\n"+crosspost.Text, crosspost.URL)
+	if verdict.Verdict == spam.Reject {
+		return apierr.Validation(ErrForm{
+			Location: "body",
+			Param:    "post",
+			Msg:      verdict.Reason,
+		})
+	}
+	crosspost.Author = *currUser
+	crosspost.Hidden = verdict.Verdict == spam.ShadowHide
+	crosspost, errCreate := h.PostRepo.Create(crosspost)
+	if errCreate != nil {
+		return apierr.Internal("error in creating post", errCreate)
+	}
+	crosspost, errUpd := h.PostRepo.UpdateVote(1, crosspost.ID, currUser)
+	if errUpd != nil {
+		return apierr.Internal("error in updating vote", errUpd)
 	}
-	http.Redirect(w, r, "/", http.StatusFound)
+	return jsonResp(h.Logger, w, crosspost)
 }
 
-func (h *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
+func (h *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) error {
 
-	body, errBodyRead := io.ReadAll(r.Body)
+	body, errBodyRead := readBody(r)
 	if errBodyRead != nil {
-		h.Logger.Infow("Error in reading req body", errBodyRead)
-		http.Error(w, `Error in reading req body`, http.StatusInternalServerError)
-		return
+		return errBodyRead
 	}
 	defer func(r *http.Request) {
 		errBodyClose := r.Body.Close()
@@ -280,9 +472,7 @@ func (h *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	currSession, errSession := session.SessionFromContext(r.Context())
 	if errSession != nil {
 		h.Logger.Infow("Unauthorized", errSession)
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		h.errorResp(w, http.StatusUnauthorized, "bad token")
-		return
+		return apierr.Unauthorized("authorize error")
 	}
 	currUser := &user.User{}
 	currUser.ID = currSession.UserID
@@ -292,142 +482,136 @@ func (h *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
 	id, errID := vars["POST_ID"]
 	if !errID {
 		h.Logger.Infow("Error in getting id", errID)
-		http.Error(w, `Bad id`, http.StatusBadGateway)
-		return
+		return apierr.New(http.StatusBadGateway, "bad id")
 	}
 
 	commentForm := &CommentForm{}
 	errUnmarsh := json.Unmarshal(body, commentForm)
 	if errUnmarsh != nil {
-		h.Logger.Infow("Error in unmarshaling", errUnmarsh)
-		http.Error(w, `Error in unmarshaling`, http.StatusInternalServerError)
-		return
+		h.Logger.Infow("Error in unmarshaling CommentForm", errUnmarsh)
+		return apierr.BadRequest("cant unpack payload")
 	}
-	if commentForm.Comment == "" {
-		RespErr, errMarh := json.Marshal(map[string][]ErrForm{
-			"errors": {
-				{
-					Location: "body",
-					Param:    "comment",
-					Msg:      "is required",
-				},
-			}})
-		if errMarh != nil {
-			h.Logger.Infow("Error in Marshaling response", errMarh)
-		}
-		http.Error(w, "Unable to process the instructions", http.StatusUnprocessableEntity)
-		_, errWrite := w.Write(RespErr)
-		if errWrite != nil {
-			h.Logger.Infow("Error in writing", errWrite)
+	post, _, errComment := h.addComment(currUser, id, commentForm.Comment)
+	if errComment != nil {
+		return errComment
+	}
+	return jsonResp(h.Logger, w, post.VisibleTo(currUser.Login))
+}
+
+// VotePoll casts the single poll vote of the user, it is unrelated to the score votes
+func (h *PostHandler) VotePoll(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		h.Logger.Infow("Unauthorized", errSession)
+		return apierr.Unauthorized("bad token")
+	}
+	form := &PollVoteForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
+	}
+	if form.Option == nil {
+		return apierr.Validation(ErrForm{Location: "body", Param: "option", Msg: "is required"})
+	}
+	now := time.Now()
+	updated, errVote := h.PostRepo.Update(mux.Vars(r)["POST_ID"], post.AnyVersion, func(currPost *post.Post) error {
+		if !currPost.ShownTo(currSession.UserLogin) {
+			return post.ErrNoPost
 		}
-		return
+		return post.CastPollVote(currPost, currSession.UserID, *form.Option, now)
+	})
+	switch errVote {
+	case nil:
+	case post.ErrNoPost, post.ErrNotPoll:
+		return apierr.NotFound("poll not found")
+	case post.ErrPollClosed:
+		return apierr.Forbidden(errVote.Error())
+	case post.ErrAlreadyVoted:
+		return apierr.Conflict(errVote.Error())
+	case post.ErrBadPollOption:
+		return apierr.Validation(ErrForm{Location: "body", Param: "option", Msg: errVote.Error()})
+	default:
+		return apierr.Internal("error in poll vote", errVote)
 	}
-	post, errGetPost := h.PostRepo.Get(id)
-	if errGetPost != nil {
-		h.Logger.Infow("Error in getting post", errGetPost)
-		http.Error(w, `Error in getting post`, http.StatusInternalServerError)
-		return
+	return jsonResp(h.Logger, w, updated.Poll.Results(currSession.UserID, now))
+}
+
+// SetState locks, pins or archives the post on behalf of a moderator of its category
+func (h *PostHandler) SetState(w http.ResponseWriter, r *http.Request) error {
+	postID := mux.Vars(r)["POST_ID"]
+	currPost, errGet := h.PostRepo.Get(postID)
+	if errGet != nil {
+		return apierr.NotFound("post not found")
 	}
-	currComment, errComment := h.CommentRepo.Create(commentForm.Comment, currUser, post.ID)
-	if errComment != nil {
-		h.Logger.Infow("Error in creating comment", errComment)
-		http.Error(w, `Error in creating comment`, http.StatusInternalServerError)
-		return
+	currSession, errModerator := requireModerator(h.Logger, h.UserRepo, h.CategoryRepo, r, currPost.Category)
+	if errModerator != nil {
+		return errModerator
 	}
-	post, errAddComment := h.PostRepo.AddComment(post, currComment)
-	if errAddComment != nil {
-		h.Logger.Infow("Error in adding comment", errAddComment)
-		http.Error(w, `Error in adding comment`, http.StatusInternalServerError)
-		return
+	form := &StateForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
 	}
-	resp, errMarsh := json.Marshal(post)
-	if errMarsh != nil {
-		h.Logger.Infow("Error in marshaling response", errMarsh)
-		h.errorResp(w, http.StatusBadRequest, "cant unpack payload")
-		return
+	updated, errUpdate := h.PostRepo.Update(postID, post.AnyVersion, func(item *post.Post) error {
+		return post.ApplyAction(item, form.Action)
+	})
+	switch errUpdate {
+	case nil:
+	case post.ErrNoPost:
+		return apierr.NotFound("post not found")
+	case post.ErrBadAction:
+		return apierr.Validation(ErrForm{Location: "body", Param: "action", Msg: errUpdate.Error(), Value: form.Action})
+	case post.ErrPinArchived, post.ErrScheduled, post.ErrTooManyPins:
+		return apierr.Conflict(errUpdate.Error())
+	default:
+		return apierr.Internal("error in changing post state", errUpdate)
 	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in writing", errWrite)
-		return
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionPostState, postID+"/"+form.Action)
+	updated, errComments := h.withComments(updated)
+	if errComments != nil {
+		return apierr.Internal("error in getting comments", errComments)
 	}
+	return jsonResp(h.Logger, w, updated.VisibleTo(currSession.UserLogin))
 }
 
 // ============================== DELETE ==============================
-func (h *PostHandler) DelPost(w http.ResponseWriter, r *http.Request) {
+func (h *PostHandler) DelPost(w http.ResponseWriter, r *http.Request) error {
 
 	vars := mux.Vars(r)
 	postID, errID := vars["POST_ID"]
 	if !errID {
 		h.Logger.Infow("Error in getting id", errID)
-		http.Error(w, `Bad id`, http.StatusBadGateway)
-		return
+		return apierr.New(http.StatusBadGateway, "bad id")
 	}
 
 	currSession, errSession := session.SessionFromContext(r.Context())
 	if errSession != nil {
 		h.Logger.Infow("Unauthorized", errSession)
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		h.errorResp(w, http.StatusUnauthorized, "bad token")
-		return
+		return apierr.Unauthorized("authorize error")
 	}
 	currUser := &user.User{}
 	currUser.ID = currSession.UserID
 	currUser.Login = currSession.UserLogin
 
-	post, errGet := h.PostRepo.GetPost(postID)
-	if errGet != nil {
-		h.Logger.Infow("Error in getting posts", errGet)
-		http.Error(w, `Error in getting posts`, http.StatusInternalServerError)
-		return
-	}
-	if currUser.ID != post.Author.ID {
-		h.Logger.Infow("Unauthorized", errSession)
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		h.errorResp(w, http.StatusUnauthorized, "bad token")
-		return
-	}
-
-	ok, errDel := h.PostRepo.Delete(postID)
-	if errDel != nil {
-		h.Logger.Infow("Error in deleting post", errID)
-		http.Error(w, `Error in deleting post`, http.StatusInternalServerError)
-		return
-	}
-	if ok {
-		// also del comments repo
-		h.CommentRepo.DeleteAll(postID)
-		resp, errMarsh := json.Marshal(map[string]interface{}{
-			"message": "success",
-		})
-		if errMarsh != nil {
-			h.Logger.Infow("Error of Marshal", errMarsh)
-		}
-		_, errWrite := w.Write(resp)
-		if errWrite != nil {
-			h.Logger.Infow("Error of write", errWrite)
-		}
-	} else {
-		h.errorResp(w, http.StatusInternalServerError, "error of delete")
+	if errDel := h.deletePost(r, currUser, postID); errDel != nil {
+		return errDel
 	}
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"message": "success",
+	})
 }
 
-func (h *PostHandler) DelComment(w http.ResponseWriter, r *http.Request) {
+func (h *PostHandler) DelComment(w http.ResponseWriter, r *http.Request) error {
 
 	vars := mux.Vars(r)
 	postID, errID := vars["POST_ID"]
 	if !errID {
 		h.Logger.Infow("Error in getting id", errID)
-		http.Error(w, `Bad id`, http.StatusBadGateway)
-		return
+		return apierr.New(http.StatusBadGateway, "bad id")
 	}
 
 	currSession, errSession := session.SessionFromContext(r.Context())
 	if errSession != nil {
 		h.Logger.Infow("Unauthorized", errSession)
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		h.errorResp(w, http.StatusUnauthorized, "bad token")
-		return
+		return apierr.Unauthorized("authorize error")
 	}
 	currUser := &user.User{}
 	currUser.ID = currSession.UserID
@@ -436,65 +620,450 @@ func (h *PostHandler) DelComment(w http.ResponseWriter, r *http.Request) {
 	commentID, errCommentID := vars["COMMENT_ID"]
 	if !errCommentID {
 		h.Logger.Infow("Error in getting comment id", errCommentID)
-		http.Error(w, `Bad id`, http.StatusBadGateway)
+		return apierr.New(http.StatusBadGateway, "bad id")
+	}
+	post, errDel := h.deleteComment(r, currUser, postID, commentID)
+	if errDel != nil {
+		return errDel
+	}
+	return jsonResp(h.Logger, w, post.VisibleTo(currUser.Login))
+}
+
+// ============================== HELP FUNC ==============================
+func (f *PostForm) post() post.Post {
+	newPost := post.Post{
+		Category:  f.Category,
+		Text:      f.Text,
+		Title:     f.Title,
+		Type:      f.Type,
+		URL:       f.URL,
+		Flair:     f.Flair,
+		Tags:      f.Tags,
+		NSFW:      f.NSFW,
+		Spoiler:   f.Spoiler,
+		PublishAt: f.PublishAt,
+		ExpiresAt: f.ExpiresAt,
+	}
+	if f.Poll != nil {
+		newPost.Poll = &post.Poll{ClosesAt: f.Poll.ClosesAt}
+		for _, option := range f.Poll.Options {
+			newPost.Poll.Options = append(newPost.Poll.Options, post.PollOption{Text: option.Text})
+		}
+	}
+	return newPost
+}
+
+// cachedResp answers GET requests whose body depends only on the key and the stored posts and comments.
+// Errors of render are returned as they are, successful bodies are cached until the next change.
+func (h *PostHandler) cachedResp(w http.ResponseWriter, r *http.Request, key string, render func() (interface{}, error)) error {
+	// the revision is taken before rendering, so a concurrent change can only make the cached body newer
+	postRevision, postModified := h.PostRepo.Revision()
+	commentRevision, commentModified := h.CommentRepo.Revision()
+	revision := fmt.Sprintf("%d.%d", postRevision, commentRevision)
+	modified := postModified
+	if commentModified.After(modified) {
+		modified = commentModified
+	}
+	modified = modified.UTC().Truncate(time.Second)
+	etag := fmt.Sprintf(`"%x"`, sha1.Sum([]byte(key+"@"+revision)))
+
+	// responses depend on the viewer, shared caches must not keep them
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	}
+	if notModified(r, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	entry, hit := h.Cache.Get(key, revision)
+	if !hit {
+		data, errRender := render()
+		if errRender != nil {
+			w.Header().Del("ETag")
+			w.Header().Del("Last-Modified")
+			return errRender
+		}
+		body, errMarsh := json.Marshal(data)
+		if errMarsh != nil {
+			return apierr.Internal("error in marshaling response", errMarsh)
+		}
+		entry = httpcache.Entry{Body: body, Revision: revision}
+		h.Cache.Set(key, entry)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, errWrite := w.Write(entry.Body)
+	if errWrite != nil {
+		h.Logger.Infow("Error in writing", errWrite)
+	}
+	return nil
+}
+
+// countView skips the author and crawlers, viewers are told apart by login or by address
+func (h *PostHandler) countView(r *http.Request, currPost post.Post) {
+	if h.Views == nil || isBot(r.UserAgent()) {
 		return
 	}
-	post, errGetPost := h.PostRepo.Get(postID)
-	if errGetPost != nil {
-		h.Logger.Infow("Error in getting post", errGetPost)
-		http.Error(w, `Error in getting post`, http.StatusInternalServerError)
+	viewer := viewerLogin(r)
+	switch {
+	case viewer == currPost.Author.Login:
 		return
+	case viewer != "":
+		h.Views.Record(currPost.ID, "u:"+viewer)
+	default:
+		h.Views.Record(currPost.ID, "ip:"+clientIP(r))
+	}
+}
+
+func isBot(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, marker := range []string{"bot", "crawler", "spider", "slurp"} {
+		if strings.Contains(userAgent, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// listCacheKey covers everything a listing depends on besides the stored posts
+func listCacheKey(r *http.Request, filter post.ListFilter) string {
+	return fmt.Sprintf("%s?%s|%s|%t", r.URL.Path, r.URL.RawQuery, filter.Viewer, filter.ShowNSFW)
+}
+
+func (h *PostHandler) listFilter(r *http.Request) post.ListFilter {
+	query := r.URL.Query()
+	filter := post.ListFilter{
+		Flair: query.Get("flair"),
+		Tag:   query.Get("tag"),
 	}
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		return filter
+	}
+	filter.Viewer = currSession.UserLogin
+	settings, errSettings := h.UserRepo.GetSettings(currSession.UserLogin)
+	if errSettings != nil {
+		h.Logger.Infow("Error in getting settings", errSettings)
+		return filter
+	}
+	filter.ShowNSFW = settings.ShowNSFW
+	return filter
+}
 
-	comment, errGet := h.CommentRepo.Get(commentID, post.ID)
+// checkSpam scores the content on behalf of the user, lookup failures count as a brand-new account without karma
+func (h *PostHandler) checkSpam(currUser *user.User, kind, category, text, link string) spam.Result {
+	content := spam.Content{
+		Kind:     kind,
+		Author:   currUser.Login,
+		Category: category,
+		Text:     text,
+		URL:      link,
+	}
+	author, errUser := h.UserRepo.GetUser(currUser.Login)
+	if errUser != nil {
+		h.Logger.Infow("Error in getting user", errUser)
+	} else {
+		content.AccountAge = time.Since(author.Created)
+	}
+	posts, errPosts := h.PostRepo.GetUserPosts(currUser.Login)
+	if errPosts != nil {
+		h.Logger.Infow("Error in getting user posts", errPosts)
+	}
+	for _, item := range posts {
+		content.Karma += item.Score
+	}
+
+	result := h.Spam.Check(content)
+	if result.Verdict != spam.Allow {
+		h.Logger.Infow("Spam check",
+			"user", currUser.Login,
+			"kind", kind,
+			"category", category,
+			"verdict", result.Verdict.String(),
+			"rule", result.Rule,
+			"reason", result.Reason,
+		)
+	}
+	return result
+}
+
+// createPost runs the checks every new post goes through and stores it with the upvote of its author,
+// the other posts of the same link are returned for the author to see
+func (h *PostHandler) createPost(currUser *user.User, newPost post.Post) (post.Post, []post.Post, error) {
+	if errForm := h.validatePost(&newPost); errForm != nil {
+		h.Logger.Infow("Invalid post", "param", errForm.Param, "msg", errForm.Msg)
+		return post.Post{}, nil, apierr.Validation(*errForm)
+	}
+	if errForm := schedulePost(&newPost, time.Now()); errForm != nil {
+		return post.Post{}, nil, apierr.Validation(*errForm)
+	}
+	if errForm := setupPoll(&newPost, time.Now()); errForm != nil {
+		return post.Post{}, nil, apierr.Validation(*errForm)
+	}
+
+	others, errOthers := h.PostRepo.GetByURL(newPost.URL)
+	if errOthers != nil {
+		return post.Post{}, nil, apierr.Internal("error in getting posts", errOthers)
+	}
+
+	verdict := h.checkSpam(currUser, spam.KindPost, newPost.Category, newPost.Title+"\n"+newPost.Text, newPost.URL)
+	if verdict.Verdict == spam.Reject {
+		return post.Post{}, nil, apierr.Validation(ErrForm{
+			Location: "body",
+			Param:    "post",
+			Msg:      verdict.Reason,
+		})
+	}
+
+	newPost.Author = *currUser
+	newPost.CrosspostParent = ""
+	newPost.Hidden = verdict.Verdict == spam.ShadowHide
+	newPost, errCreate := h.PostRepo.Create(newPost)
+	if errCreate != nil {
+		return post.Post{}, nil, apierr.Internal("error in creating post", errCreate)
+	}
+	newPost, errUpd := h.PostRepo.UpdateVote(1, newPost.ID, currUser)
+	if errUpd != nil {
+		return post.Post{}, nil, apierr.Internal("error in updating vote", errUpd)
+	}
+	return newPost, others, nil
+}
+
+var errVoteValue = ErrForm{Location: "body", Param: "vote", Msg: "must be -1, 0 or 1"}
+
+// votePost sets the vote of the user, a version other than post.AnyVersion must still be current
+func (h *PostHandler) votePost(currUser *user.User, postID string, vote int, version uint64) (post.Post, error) {
+	if vote < -1 || vote > 1 {
+		return post.Post{}, apierr.Validation(errVoteValue)
+	}
+	elem, errVote := h.PostRepo.Update(postID, version, func(currPost *post.Post) error {
+		switch {
+		case !currPost.ShownTo(currUser.Login):
+			return post.ErrNoPost
+		case !currPost.CanVote():
+			return post.ErrArchived
+		}
+		return post.ApplyVote(currPost, vote, currUser.ID)
+	})
+	switch errVote {
+	case nil:
+	case post.ErrNoPost:
+		return post.Post{}, apierr.NotFound("post not found")
+	case post.ErrArchived:
+		return post.Post{}, apierr.Forbidden(errVote.Error())
+	case post.ErrConflict:
+		return post.Post{}, apierr.New(http.StatusPreconditionFailed, "post was changed")
+	default:
+		return post.Post{}, apierr.Internal("error in updating vote", errVote)
+	}
+	h.checkVoteBurst(elem)
+	return elem, nil
+}
+
+// addComment returns the post with its comments along with the new comment
+func (h *PostHandler) addComment(currUser *user.User, postID, text string) (post.Post, *comment.Comment, error) {
+	if text == "" {
+		return post.Post{}, nil, apierr.Validation(ErrForm{Location: "body", Param: "comment", Msg: "is required"})
+	}
+	currPost, errGetPost := h.PostRepo.Get(postID)
+	if errGetPost != nil || !currPost.ShownTo(currUser.Login) {
+		return post.Post{}, nil, apierr.NotFound("post not found")
+	}
+	if !currPost.CanComment() {
+		reason := "post is locked"
+		if currPost.Archived {
+			reason = "post is archived"
+		}
+		return post.Post{}, nil, apierr.Forbidden(reason)
+	}
+	verdict := h.checkSpam(currUser, spam.KindComment, currPost.Category, text, "")
+	if verdict.Verdict == spam.Reject {
+		return post.Post{}, nil, apierr.Validation(ErrForm{
+			Location: "body",
+			Param:    "comment",
+			Msg:      verdict.Reason,
+		})
+	}
+	hidden := verdict.Verdict == spam.ShadowHide
+	created, errComment := h.CommentRepo.Create(text, currUser, currPost.ID, hidden)
+	if errComment != nil {
+		return post.Post{}, nil, apierr.Internal("error in creating comment", errComment)
+	}
+	currPost, errAddComment := h.PostRepo.AddCommentCount(currPost.ID, 1)
+	if errAddComment != nil {
+		return post.Post{}, nil, apierr.Internal("error in adding comment", errAddComment)
+	}
+	currPost, errComments := h.withComments(currPost)
+	if errComments != nil {
+		return post.Post{}, nil, apierr.Internal("error in getting comments", errComments)
+	}
+	return currPost, created, nil
+}
+
+// deletePost removes a post of the user together with its comments
+func (h *PostHandler) deletePost(r *http.Request, currUser *user.User, postID string) error {
+	currPost, errGet := h.PostRepo.Get(postID)
 	if errGet != nil {
-		h.Logger.Infow("Error in getting comment", errGet)
-		http.Error(w, `Error in getting comment`, http.StatusInternalServerError)
-		return
+		return apierr.NotFound("post not found")
 	}
-	if currUser.ID != comment.Author.ID {
-		h.Logger.Infow("Unauthorized", errSession)
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		h.errorResp(w, http.StatusUnauthorized, "bad token")
-		return
+	if currUser.ID != currPost.Author.ID {
+		return apierr.Forbidden("not the author")
 	}
 
-	delIDx, errDel := h.CommentRepo.Delete(post.Comments, commentID, post.ID)
+	ok, errDel := h.PostRepo.Delete(postID)
 	if errDel != nil {
-		h.Logger.Infow("Error in deleting comment", errID)
-		http.Error(w, `Error in deleting comment`, http.StatusInternalServerError)
-		return
+		return apierr.Internal("error in deleting post", errDel)
+	}
+	if !ok {
+		return apierr.NotFound("post not found")
+	}
+	// also del comments repo
+	h.CommentRepo.DeleteAll(postID)
+	recordAudit(h.Logger, h.AuditRepo, r, currUser.Login, audit.ActionPostDelete, postID)
+	return nil
+}
+
+// deleteComment removes a comment of the user and returns the post with the remaining comments
+func (h *PostHandler) deleteComment(r *http.Request, currUser *user.User, postID, commentID string) (post.Post, error) {
+	currPost, errGetPost := h.PostRepo.Get(postID)
+	if errGetPost != nil {
+		return post.Post{}, apierr.NotFound("post not found")
 	}
-	post, errDelComment := h.PostRepo.DeleteComment(delIDx, postID)
+
+	currComment, errGet := h.CommentRepo.Get(commentID, currPost.ID)
+	if errGet != nil {
+		return post.Post{}, apierr.NotFound("comment not found")
+	}
+	if currUser.ID != currComment.Author.ID {
+		return post.Post{}, apierr.Forbidden("not the author")
+	}
+
+	errDel := h.CommentRepo.Delete(commentID, currPost.ID)
+	if errDel != nil {
+		return post.Post{}, apierr.Internal("error in deleting comment", errDel)
+	}
+	currPost, errDelComment := h.PostRepo.AddCommentCount(postID, -1)
 	if errDelComment != nil {
-		h.Logger.Infow("Error in deleting comment in post", errDelComment)
-		http.Error(w, `Error in deleting comment in post`, http.StatusInternalServerError)
-		return
+		return post.Post{}, apierr.Internal("error in deleting comment in post", errDelComment)
 	}
-	resp, errMarsh := json.Marshal(post)
-	if errMarsh != nil {
-		h.Logger.Infow("Error in marshaling response", errMarsh)
-		h.errorResp(w, http.StatusBadRequest, "cant unpack payload")
-		return
+	currPost, errComments := h.withComments(currPost)
+	if errComments != nil {
+		return post.Post{}, apierr.Internal("error in getting comments", errComments)
 	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in writing", errWrite)
+	recordAudit(h.Logger, h.AuditRepo, r, currUser.Login, audit.ActionCommentDelete, commentID)
+	return currPost, nil
+}
+
+// withComments hydrates the post from CommentRepo, the only place comments are kept
+func (h *PostHandler) withComments(currPost post.Post) (post.Post, error) {
+	comments, errComments := h.CommentRepo.GetAll(currPost.ID)
+	if errComments != nil {
+		h.Logger.Infow("Error in getting comments", errComments)
+		return post.Post{}, errComments
+	}
+	return currPost.WithComments(comments), nil
+}
+
+func (h *PostHandler) checkVoteBurst(currPost post.Post) {
+	if h.VoteBurstLimit <= 0 {
 		return
 	}
+	recent := currPost.VotesSince(time.Now().Add(-h.VoteBurstWindow))
+	if recent > h.VoteBurstLimit {
+		h.Logger.Warnw("Possible vote brigading",
+			"post", currPost.ID,
+			"category", currPost.Category,
+			"votes", recent,
+			"window", h.VoteBurstWindow,
+		)
+	}
 }
 
-// ============================== HELP FUNC ==============================
-func (h *PostHandler) errorResp(w http.ResponseWriter, status int, msg string) {
-	resp, errMarsh := json.Marshal(map[string]interface{}{
-		"status": status,
-		"error":  msg,
-	})
-	if errMarsh != nil {
-		h.Logger.Infow("Error in marshal resp", errMarsh)
+func (h *PostHandler) validatePost(currPost *post.Post) *ErrForm {
+	if currPost.Flair != "" && !h.CategoryRepo.IsAllowedFlair(currPost.Category, currPost.Flair) {
+		return &ErrForm{
+			Location: "body",
+			Param:    "flair",
+			Msg:      "is not allowed in this category",
+			Value:    currPost.Flair,
+		}
 	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in write resp", errMarsh)
+	tags, errTags := post.NormalizeTags(currPost.Tags)
+	if errTags != nil {
+		return &ErrForm{
+			Location: "body",
+			Param:    "tags",
+			Msg:      "is invalid",
+		}
+	}
+	currPost.Tags = tags
+	return nil
+}
+
+// schedulePost checks publishAt and expiresAt of a new post, a publish time
+// that has already passed publishes the post right away
+func schedulePost(currPost *post.Post, now time.Time) *ErrForm {
+	currPost.Archived = false
+	currPost.Scheduled = false
+	publishAt := now
+	if currPost.PublishAt != "" {
+		parsed, errParse := time.Parse(time.RFC3339, currPost.PublishAt)
+		if errParse != nil {
+			return &ErrForm{Location: "body", Param: "publishAt", Msg: "must be RFC3339 time", Value: currPost.PublishAt}
+		}
+		if parsed.After(now) {
+			publishAt = parsed
+			currPost.Scheduled = true
+			currPost.PublishAt = parsed.UTC().Format(time.RFC3339)
+		} else {
+			currPost.PublishAt = ""
+		}
+	}
+	if currPost.ExpiresAt != "" {
+		parsed, errParse := time.Parse(time.RFC3339, currPost.ExpiresAt)
+		if errParse != nil {
+			return &ErrForm{Location: "body", Param: "expiresAt", Msg: "must be RFC3339 time", Value: currPost.ExpiresAt}
+		}
+		if !parsed.After(publishAt) {
+			return &ErrForm{Location: "body", Param: "expiresAt", Msg: "must be after the publish time", Value: currPost.ExpiresAt}
+		}
+		currPost.ExpiresAt = parsed.UTC().Format(time.RFC3339)
+	}
+	return nil
+}
+
+// setupPoll builds the poll of a poll post from the submitted options, other post types cant carry one
+func setupPoll(currPost *post.Post, now time.Time) *ErrForm {
+	if currPost.Type != post.TypePoll {
+		currPost.Poll = nil
+		return nil
+	}
+	if currPost.Poll == nil {
+		return &ErrForm{Location: "body", Param: "poll", Msg: "is required"}
+	}
+	options := make([]string, 0, len(currPost.Poll.Options))
+	for _, option := range currPost.Poll.Options {
+		options = append(options, option.Text)
+	}
+	poll, errPoll := post.NewPoll(options, currPost.Poll.ClosesAt, now)
+	switch {
+	case errPoll == post.ErrPollClosed:
+		return &ErrForm{Location: "body", Param: "poll.closesAt", Msg: "must be a future RFC3339 time", Value: currPost.Poll.ClosesAt}
+	case errPoll != nil:
+		return &ErrForm{Location: "body", Param: "poll.options", Msg: errPoll.Error()}
+	case poll.ClosesAt != "" && currPost.PublishAt != "" && poll.ClosesAt <= currPost.PublishAt:
+		return &ErrForm{Location: "body", Param: "poll.closesAt", Msg: "must be after the publish time", Value: poll.ClosesAt}
+	}
+	currPost.Poll = poll
+	return nil
+}
+
+func viewerLogin(r *http.Request) string {
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		return ""
 	}
+	return currSession.UserLogin
 }
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/category"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/kv"
+	"redditclone/pkg/middleware"
+	"redditclone/pkg/post"
+	"redditclone/pkg/session"
+	"redditclone/pkg/spam"
+	"redditclone/pkg/user"
+)
+
+func TestAddPostIgnoresModeratorFlags(t *testing.T) {
+	userRepo := user.NewMemoryRepo()
+	author, _ := userRepo.AddUser("alice", "password1")
+	h := &PostHandler{
+		Logger:       zap.NewNop().Sugar(),
+		PostRepo:     post.NewMemoryRepo(),
+		CommentRepo:  comment.NewMemoryRepo(),
+		CategoryRepo: category.NewMemoryRepo(),
+		UserRepo:     userRepo,
+		AuditRepo:    audit.NewMemoryRepo(),
+		Spam:         spam.NewPipeline(),
+	}
+	body := `{"category":"music","type":"text","title":"mine","text":"hello",
+		"pinned":true,"locked":true,"archived":true,"score":1000,"id":"chosen"}`
+	r := httptest.NewRequest("POST", "/api/posts", strings.NewReader(body))
+	r = r.WithContext(session.ContextWithSession(r.Context(), &session.Session{UserID: author.ID, UserLogin: author.Login}))
+	w := httptest.NewRecorder()
+	if err := h.AddPost(w, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created := PostWithDiscussions{}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created.Pinned || created.Locked || created.Archived || created.Score != 1 || created.ID == "chosen" {
+		t.Errorf("the author set fields of moderators or the repository: %+v", created.Post)
+	}
+	if created.Title != "mine" || created.Text != "hello" || created.Category != "music" {
+		t.Errorf("fields of the author were lost: %+v", created.Post)
+	}
+}
+
+func TestCrosspostsAreNotDuplicates(t *testing.T) {
+	userRepo := user.NewMemoryRepo()
+	author, _ := userRepo.AddUser("alice", "password1")
+	pipeline, err := spam.DefaultConfig().Pipeline(kv.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h := &PostHandler{
+		Logger:       zap.NewNop().Sugar(),
+		PostRepo:     post.NewMemoryRepo(),
+		CommentRepo:  comment.NewMemoryRepo(),
+		CategoryRepo: category.NewMemoryRepo(),
+		UserRepo:     userRepo,
+		AuditRepo:    audit.NewMemoryRepo(),
+		Spam:         pipeline,
+	}
+	original, _, err := h.createPost(&author, post.Post{Category: "music", Type: "text", Title: "mine", Text: "hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"news", "funny"} {
+		r := httptest.NewRequest("POST", "/api/post/"+original.ID+"/crosspost", strings.NewReader(`{"category":"`+name+`"}`))
+		r = mux.SetURLVars(r, map[string]string{"POST_ID": original.ID})
+		r = r.WithContext(session.ContextWithSession(r.Context(), &session.Session{UserID: author.ID, UserLogin: author.Login}))
+		if err = h.Crosspost(httptest.NewRecorder(), r); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		posts, _ := h.PostRepo.GetCategory(name)
+		if visible := (post.ListFilter{Viewer: "bob"}).Apply(posts); len(visible) != 1 {
+			t.Errorf("other users see %d crossposts in %s, expected 1", len(visible), name)
+		}
+	}
+}
+
+func TestPinLimitIsConflict(t *testing.T) {
+	userRepo := user.NewMemoryRepo("admin")
+	admin, _ := userRepo.AddUser("admin", "password1")
+	h := &PostHandler{
+		Logger:       zap.NewNop().Sugar(),
+		PostRepo:     post.NewMemoryRepo(),
+		CommentRepo:  comment.NewMemoryRepo(),
+		CategoryRepo: category.NewMemoryRepo(),
+		UserRepo:     userRepo,
+		AuditRepo:    audit.NewMemoryRepo(),
+		Spam:         spam.NewPipeline(),
+	}
+	pin := func(postID string) error {
+		r := httptest.NewRequest("POST", "/api/post/"+postID+"/state", strings.NewReader(`{"action":"pin"}`))
+		r = mux.SetURLVars(r, map[string]string{"POST_ID": postID})
+		r = r.WithContext(session.ContextWithSession(r.Context(), &session.Session{UserID: admin.ID, UserLogin: admin.Login}))
+		return h.SetState(httptest.NewRecorder(), r)
+	}
+	for i := 0; i <= post.MaxPinned; i++ {
+		created, _, err := h.createPost(&admin, post.Post{Category: "music", Type: "text", Title: "mine", Text: "hello"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		err = pin(created.ID)
+		switch {
+		case i < post.MaxPinned && err != nil:
+			t.Errorf("pin %d got %v", i, err)
+		case i == post.MaxPinned && apierr.From(err).Status != http.StatusConflict:
+			t.Errorf("pin over the limit got %v, expected 409", err)
+		}
+	}
+}
+
+func TestLargeBodyIsRefused(t *testing.T) {
+	h := &PostHandler{Logger: zap.NewNop().Sugar()}
+	body := `{"category":"music","type":"text","title":"big","text":"` + strings.Repeat("[", middleware.DefaultMaxBody) + `"}`
+	w := httptest.NewRecorder()
+	middleware.BodyLimit(middleware.DefaultMaxBody, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierr.Write(w, h.AddPost(w, r))
+	})).ServeHTTP(w, httptest.NewRequest("POST", "/api/posts", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d, expected 413", w.Code)
+	}
+}
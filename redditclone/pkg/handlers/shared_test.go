@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/audit"
+	"redditclone/pkg/category"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/httpcache"
+	"redditclone/pkg/kv"
+	"redditclone/pkg/kv/kvtest"
+	"redditclone/pkg/post"
+	"redditclone/pkg/spam"
+	"redditclone/pkg/user"
+)
+
+func TestInstancesServeTheSameSite(t *testing.T) {
+	server, err := kvtest.NewServer()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer server.Close()
+	newInstance := func() *PostHandler {
+		store := kv.NewRedisStore(server.Addr, 4)
+		t.Cleanup(func() { store.Close() })
+		return &PostHandler{
+			Logger:       zap.NewNop().Sugar(),
+			PostRepo:     post.NewSharedRepo(store),
+			CommentRepo:  comment.NewSharedRepo(store),
+			CategoryRepo: category.NewSharedRepo(store),
+			UserRepo:     user.NewSharedRepo(store),
+			AuditRepo:    audit.NewSharedRepo(store),
+			Spam:         spam.NewPipeline(),
+			Cache:        httpcache.New(10),
+		}
+	}
+	first, second := newInstance(), newInstance()
+	listed := func(h *PostHandler) []post.Post {
+		w := httptest.NewRecorder()
+		if err := h.GetPosts(w, httptest.NewRequest("GET", "/api/posts/", nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		posts := make([]post.Post, 0)
+		if err := json.Unmarshal(w.Body.Bytes(), &posts); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return posts
+	}
+
+	// the second instance caches an empty listing before the first one gets a post
+	if posts := listed(second); len(posts) != 0 {
+		t.Fatalf("got %d posts on an empty site", len(posts))
+	}
+	author, err := first.UserRepo.AddUser("alice", "password1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created, _, err := first.createPost(&author, post.Post{Category: "music", Type: "text", Title: "mine", Text: "hello"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	posts := listed(second)
+	if len(posts) != 1 || posts[0].ID != created.ID || posts[0].Score != 1 {
+		t.Errorf("the other instance lists %+v", posts)
+	}
+	if _, err = second.UserRepo.Authorize("alice", "password1"); err != nil {
+		t.Errorf("login on the other instance got %v", err)
+	}
+}
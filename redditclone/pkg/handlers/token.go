@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/session"
+	"redditclone/pkg/token"
+	"redditclone/pkg/user"
+)
+
+type TokenHandler struct {
+	Logger    *zap.SugaredLogger
+	TokenRepo token.TokenRepo
+	AuditRepo audit.AuditRepo
+}
+
+type TokenForm struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type CreatedToken struct {
+	token.Token
+	Secret string `json:"token"`
+}
+
+// ================================ GET ===============================
+func (h *TokenHandler) GetTokens(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := fullSession(h.Logger, r)
+	if errSession != nil {
+		return errSession
+	}
+	tokens, errGet := h.TokenRepo.GetUserTokens(currSession.UserLogin)
+	if errGet != nil {
+		return apierr.Internal("error in getting tokens", errGet)
+	}
+	return jsonResp(h.Logger, w, tokens)
+}
+
+// =============================== POST ===============================
+func (h *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := fullSession(h.Logger, r)
+	if errSession != nil {
+		return errSession
+	}
+	form := &TokenForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
+	}
+	owner := user.User{
+		ID:    currSession.UserID,
+		Login: currSession.UserLogin,
+	}
+	tok, secret, errCreate := h.TokenRepo.Create(owner, form.Name, form.Scopes)
+	switch errCreate {
+	case nil:
+	case token.ErrEmptyName:
+		return apierr.Validation(ErrForm{Location: "body", Param: "name", Msg: "is required"})
+	case token.ErrBadScope, token.ErrNoScopes, token.ErrTooMany:
+		return apierr.Validation(ErrForm{Location: "body", Param: "scopes", Msg: errCreate.Error()})
+	default:
+		return apierr.Internal("error in creating token", errCreate)
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionTokenCreate, tok.ID)
+	w.WriteHeader(http.StatusCreated)
+	return jsonResp(h.Logger, w, CreatedToken{
+		Token:  tok,
+		Secret: secret,
+	})
+}
+
+// ============================== DELETE ==============================
+func (h *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := fullSession(h.Logger, r)
+	if errSession != nil {
+		return errSession
+	}
+	tokenID := mux.Vars(r)["TOKEN_ID"]
+	errRevoke := h.TokenRepo.Revoke(tokenID, currSession.UserLogin)
+	if errRevoke != nil {
+		h.Logger.Infow("Error in revoking token", errRevoke)
+		return apierr.NotFound("token not found")
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionTokenRevoke, tokenID)
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"message": "success",
+	})
+}
+
+// ============================== HELP FUNC ==============================
+// fullSession keeps API tokens from managing tokens, settings and account security
+func fullSession(logger *zap.SugaredLogger, r *http.Request) (*session.Session, error) {
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		logger.Infow("Unauthorized", errSession)
+		return nil, apierr.Unauthorized("bad token")
+	}
+	if currSession.Scopes != nil {
+		return nil, apierr.Forbidden("api tokens cant manage the account")
+	}
+	return currSession, nil
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/session"
+	"redditclone/pkg/token"
+)
+
+func TestTokenRoutesRefuseTokens(t *testing.T) {
+	h := &TokenHandler{
+		Logger:    zap.NewNop().Sugar(),
+		TokenRepo: token.NewMemoryRepo(),
+		AuditRepo: audit.NewMemoryRepo(),
+	}
+	full := &session.Session{UserID: "id", UserLogin: "alice"}
+	// a token holding every scope still can not mint or revoke tokens
+	viaToken := &session.Session{UserID: "id", UserLogin: "alice", Scopes: token.AllScopes}
+	request := func(sess *session.Session, method, body string) *http.Request {
+		r := httptest.NewRequest(method, "/api/tokens", strings.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"TOKEN_ID": "any"})
+		return r.WithContext(session.ContextWithSession(r.Context(), sess))
+	}
+
+	routes := map[string]func(sess *session.Session) error{
+		"list": func(sess *session.Session) error {
+			return h.GetTokens(httptest.NewRecorder(), request(sess, "GET", ""))
+		},
+		"create": func(sess *session.Session) error {
+			return h.CreateToken(httptest.NewRecorder(), request(sess, "POST", `{"name":"bot","scopes":["read"]}`))
+		},
+		"revoke": func(sess *session.Session) error {
+			return h.RevokeToken(httptest.NewRecorder(), request(sess, "DELETE", ""))
+		},
+	}
+	for name, route := range routes {
+		if err := route(viaToken); apierr.From(err).Status != http.StatusForbidden {
+			t.Errorf("%s through a token got %v, expected 403", name, err)
+		}
+	}
+	if err := routes["create"](full); err != nil {
+		t.Errorf("create with a full session: unexpected error: %v", err)
+	}
+	if tokens, _ := h.TokenRepo.GetUserTokens("alice"); len(tokens) != 1 {
+		t.Errorf("got %d tokens, expected only the one of the full session", len(tokens))
+	}
+}
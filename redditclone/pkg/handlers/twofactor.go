@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
+	"redditclone/pkg/session"
+	"redditclone/pkg/twofactor"
+	"redditclone/pkg/user"
+)
+
+type TwoFactorHandler struct {
+	Logger        *zap.SugaredLogger
+	TwoFactorRepo twofactor.TwoFactorRepo
+	UserRepo      user.UserRepo
+	AuditRepo     audit.AuditRepo
+	Sessions      session.SessRepo
+	// Issuer names the site in authenticator apps
+	Issuer string
+}
+
+type TwoFactorForm struct {
+	Code string `json:"code"`
+}
+
+type DisableTwoFactorForm struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type ChallengeForm struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+	Cookie    bool   `json:"cookie"`
+}
+
+// ================================ GET ===============================
+func (h *TwoFactorHandler) GetStatus(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := fullSession(h.Logger, r)
+	if errSession != nil {
+		return errSession
+	}
+	status, errGet := h.TwoFactorRepo.GetStatus(currSession.UserLogin)
+	if errGet != nil {
+		return apierr.Internal("error in getting status", errGet)
+	}
+	return jsonResp(h.Logger, w, status)
+}
+
+// =============================== POST ===============================
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := fullSession(h.Logger, r)
+	if errSession != nil {
+		return errSession
+	}
+	secret, errEnroll := h.TwoFactorRepo.Enroll(currSession.UserLogin)
+	switch errEnroll {
+	case nil:
+	case twofactor.ErrEnabled:
+		return apierr.Conflict(errEnroll.Error())
+	default:
+		return apierr.Internal("error in enrollment", errEnroll)
+	}
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"secret": secret,
+		"uri":    twofactor.ProvisioningURI(h.Issuer, currSession.UserLogin, secret),
+	})
+}
+
+func (h *TwoFactorHandler) Enable(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := fullSession(h.Logger, r)
+	if errSession != nil {
+		return errSession
+	}
+	form := &TwoFactorForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
+	}
+	codes, errEnable := h.TwoFactorRepo.Enable(currSession.UserLogin, form.Code)
+	switch errEnable {
+	case nil:
+	case twofactor.ErrBadCode:
+		return apierr.Validation(ErrForm{Location: "body", Param: "code", Msg: errEnable.Error()})
+	case twofactor.ErrNotEnrolled, twofactor.ErrEnabled:
+		return apierr.Conflict(errEnable.Error())
+	default:
+		return apierr.Internal("error in enabling 2fa", errEnable)
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionTwoFactorEnable, currSession.UserID)
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"recoveryCodes": codes,
+	})
+}
+
+// Disable asks for the password and a second factor again, a stolen token alone is not enough
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := fullSession(h.Logger, r)
+	if errSession != nil {
+		return errSession
+	}
+	form := &DisableTwoFactorForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
+	}
+	_, errAuth := h.UserRepo.Authorize(currSession.UserLogin, form.Password)
+	if errAuth != nil {
+		recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionLoginFailed, currSession.UserID)
+		return apierr.Unauthorized("bad password")
+	}
+	errVerify := h.TwoFactorRepo.Verify(currSession.UserLogin, form.Code)
+	switch errVerify {
+	case nil:
+	case twofactor.ErrBadCode:
+		return apierr.Validation(ErrForm{Location: "body", Param: "code", Msg: errVerify.Error()})
+	case twofactor.ErrLocked:
+		return apierr.New(http.StatusTooManyRequests, errVerify.Error())
+	case twofactor.ErrNotEnrolled:
+		return apierr.Conflict(errVerify.Error())
+	default:
+		return apierr.Internal("error in verifying code", errVerify)
+	}
+	errDisable := h.TwoFactorRepo.Disable(currSession.UserLogin)
+	if errDisable != nil {
+		return apierr.Internal("error in disabling 2fa", errDisable)
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionTwoFactorDisable, currSession.UserID)
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"message": "success",
+	})
+}
+
+// Login finishes a login started with a password or an oauth provider
+func (h *TwoFactorHandler) Login(w http.ResponseWriter, r *http.Request) error {
+	form := &ChallengeForm{}
+	if errForm := readForm(h.Logger, r, form); errForm != nil {
+		return errForm
+	}
+	currUser, errChallenge := h.Sessions.CheckChallenge(form.Challenge)
+	switch errChallenge {
+	case nil:
+	case session.ErrBadChallenge:
+		h.Logger.Infow("Bad login challenge", errChallenge)
+		return apierr.Unauthorized(errChallenge.Error())
+	default:
+		return apierr.Internal("error in checking challenge", errChallenge)
+	}
+	errVerify := h.TwoFactorRepo.Verify(currUser.Login, form.Code)
+	if errVerify != nil {
+		recordAudit(h.Logger, h.AuditRepo, r, currUser.Login, audit.ActionLoginFailed, currUser.ID)
+		if errVerify == twofactor.ErrLocked {
+			return apierr.New(http.StatusTooManyRequests, errVerify.Error())
+		}
+		return apierr.Unauthorized("bad two-factor code")
+	}
+	// a challenge opens one session, a parallel request with the same code gets nothing
+	errConsume := h.Sessions.ConsumeChallenge(form.Challenge)
+	switch errConsume {
+	case nil:
+	case session.ErrBadChallenge:
+		return apierr.Unauthorized(errConsume.Error())
+	default:
+		return apierr.Internal("error in checking challenge", errConsume)
+	}
+	sess, errSession := h.Sessions.Create(currUser)
+	if errSession != nil {
+		return apierr.Internal("error in session creating", errSession)
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currUser.Login, audit.ActionLogin, currUser.ID)
+	return tokenResp(h.Logger, h.Sessions, w, sess, form.Cookie)
+}
+
+// ============================== HELP FUNC ==============================
+// challengeResp answers a first login step with a challenge when the account needs a second factor,
+// sent reports that the response is already written
+func challengeResp(logger *zap.SugaredLogger, sessions session.SessRepo, twoFactor twofactor.TwoFactorRepo,
+	w http.ResponseWriter, currUser user.User) (bool, error) {
+	if twoFactor == nil || !twoFactor.IsEnabled(currUser.Login) {
+		return false, nil
+	}
+	challenge, errChallenge := sessions.CreateChallenge(currUser)
+	if errChallenge != nil {
+		return false, apierr.Internal("error in challenge creating", errChallenge)
+	}
+	return true, jsonResp(logger, w, map[string]interface{}{
+		"twoFactorRequired": true,
+		"challenge":         challenge,
+	})
+}
@@ -2,178 +2,192 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 
+	"redditclone/pkg/apierr"
+	"redditclone/pkg/audit"
 	"redditclone/pkg/session"
+	"redditclone/pkg/twofactor"
 	"redditclone/pkg/user"
 
 	"go.uber.org/zap"
 )
 
 type UserHandler struct {
-	Logger   *zap.SugaredLogger
-	UserRepo user.UserRepo
-	Sessions session.SessRepo
+	Logger    *zap.SugaredLogger
+	UserRepo  user.UserRepo
+	AuditRepo audit.AuditRepo
+	Sessions  session.SessRepo
+	// TwoFactorRepo turns a password login into a challenge for enrolled accounts
+	TwoFactorRepo twofactor.TwoFactorRepo
 }
 
 type LoginForm struct {
 	Login    string `json:"username"`
 	Password string `json:"password"`
+	// Cookie asks for an HttpOnly session cookie instead of a token in the body
+	Cookie bool `json:"cookie"`
 }
 
-type ErrForm struct {
-	Location string `json:"location"`
-	Param    string `json:"param"`
-	Msg      string `json:"msg"`
-	Value    string `json:"value,omitempty"`
-}
+// ErrForm is kept for the handlers, it is the field of a validation error
+type ErrForm = apierr.Field
 
-func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
-	body, errRead := io.ReadAll(r.Body)
-	if errRead != nil {
-		h.Logger.Infow("Error in reading req body", errRead)
-		http.Error(w, `Error in reading req body`, http.StatusInternalServerError)
-		return
-	}
-	defer func(r *http.Request) {
-		errBody := r.Body.Close()
-		if errBody != nil {
-			h.Logger.Infow("Error in closing req body", errBody)
-			return
-		}
-	}(r)
+func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) error {
 	logForm := &LoginForm{}
-	errUnMarsh := json.Unmarshal(body, logForm)
-	if errUnMarsh != nil {
-		h.Logger.Infow("Error in unmarshaling LoginForm", errUnMarsh)
-		h.errorResp(w, http.StatusBadRequest, "cant unpack payload")
-		return
+	if errForm := readForm(h.Logger, r, logForm); errForm != nil {
+		return errForm
 	}
 
 	user, errAuth := h.UserRepo.Authorize(logForm.Login, logForm.Password)
 	if errAuth != nil {
 		h.Logger.Infow(errAuth.Error())
-		h.errorResp(w, http.StatusUnauthorized, "bad login or password")
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		return
+		recordAudit(h.Logger, h.AuditRepo, r, logForm.Login, audit.ActionLoginFailed, user.ID)
+		return apierr.Unauthorized("bad login or password")
+	}
+	if sent, errChallenge := challengeResp(h.Logger, h.Sessions, h.TwoFactorRepo, w, user); sent || errChallenge != nil {
+		return errChallenge
 	}
 	sess, errSession := h.Sessions.Create(user)
 	if errSession != nil {
-		h.Logger.Infow("Err in session creating: ", errSession)
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		return
-	}
-	tokenString, err := h.Sessions.CreateToken(sess)
-	if err != nil {
-		h.Logger.Infow("Err jwt", err.Error())
-		h.errorResp(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	resp, errMrsh := json.Marshal(map[string]interface{}{
-		"token": tokenString,
-	})
-	if errMrsh != nil {
-		h.Logger.Infow("Error in marshal resp", errMrsh)
-		return
-	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in write resp", errWrite)
-		return
+		return apierr.Internal("authorize error", errSession)
 	}
+	recordAudit(h.Logger, h.AuditRepo, r, user.Login, audit.ActionLogin, user.ID)
+	return tokenResp(h.Logger, h.Sessions, w, sess, logForm.Cookie)
 }
 
-func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
-	body, errRead := io.ReadAll(r.Body)
-	if errRead != nil {
-		h.Logger.Infow("Error in reading req body", errRead)
-		http.Error(w, `Error in reading req body`, http.StatusInternalServerError)
-		return
-	}
-	defer func(r *http.Request) {
-		errBody := r.Body.Close()
-		if errBody != nil {
-			h.Logger.Infow("Error in closing req body", errBody)
-			return
-		}
-	}(r)
-
+func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) error {
 	logForm := &LoginForm{}
-	errUnMarsh := json.Unmarshal(body, logForm)
-	if errUnMarsh != nil {
-		h.Logger.Infow("Error in unmarshaling LoginForm", errUnMarsh)
-		h.errorResp(w, http.StatusBadRequest, "cant unpack payload")
-		return
+	if errForm := readForm(h.Logger, r, logForm); errForm != nil {
+		return errForm
+	}
+	if logForm.Login == user.DeletedLogin {
+		return apierr.Validation(ErrForm{Location: "body", Param: "username", Msg: "is reserved", Value: logForm.Login})
 	}
 	_, errUser := h.UserRepo.Authorize(logForm.Login, logForm.Password)
 	if errUser != user.ErrNoUser {
-		RespErr, errMarsh := json.Marshal(map[string][]ErrForm{
-			"errors": {
-				{
-					Location: "body",
-					Msg:      "already exists",
-					Param:    "username",
-					Value:    logForm.Login,
-				},
-			}})
-		if errMarsh != nil {
-			h.Logger.Infow("Error in marshal resp", errMarsh)
-		}
-		h.Logger.Infow("Unable to process the instructions", errUser)
-		http.Error(w, "", http.StatusUnprocessableEntity)
-		_, errWrite := w.Write(RespErr)
-		if errWrite != nil {
-			h.Logger.Infow("Error in write resp", errWrite)
-		}
-		return
+		return apierr.Validation(ErrForm{Location: "body", Param: "username", Msg: "already exists", Value: logForm.Login})
 	}
 	user, errAuth := h.UserRepo.AddUser(logForm.Login, logForm.Password)
 	if errAuth != nil {
-		h.Logger.Infow(errAuth.Error())
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		h.errorResp(w, http.StatusUnauthorized, "bad login or password")
-		return
+		return apierr.Internal("authorize error", errAuth)
 	}
 	sess, errSession := h.Sessions.Create(user)
 	if errSession != nil {
-		h.Logger.Infow("Err in session creating", errSession)
-		http.Error(w, "Authorize error", http.StatusUnauthorized)
-		return
+		return apierr.Internal("authorize error", errSession)
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, user.Login, audit.ActionRegister, user.ID)
+	return tokenResp(h.Logger, h.Sessions, w, sess, logForm.Cookie)
+}
+
+// Logout drops the session cookie, bearer clients just forget their token
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) error {
+	h.Sessions.DestroyCookie(w)
+	return jsonResp(h.Logger, w, map[string]interface{}{
+		"message": "success",
+	})
+}
+
+func (h *UserHandler) GetSettings(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := session.SessionFromContext(r.Context())
+	if errSession != nil {
+		h.Logger.Infow("Unauthorized", errSession)
+		return apierr.Unauthorized("bad token")
+	}
+	settings, errSettings := h.UserRepo.GetSettings(currSession.UserLogin)
+	if errSettings != nil {
+		h.Logger.Infow("Error in getting settings", errSettings)
+		return apierr.NotFound(errSettings.Error())
 	}
+	return jsonResp(h.Logger, w, settings)
+}
 
-	tokenString, err := h.Sessions.CreateToken(sess)
-	if err != nil {
-		h.Logger.Infow("Err jwt", err.Error())
-		h.errorResp(w, http.StatusInternalServerError, err.Error())
-		return
+// UpdateSettings is refused to API tokens like every other change of the profile
+func (h *UserHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) error {
+	currSession, errSession := fullSession(h.Logger, r)
+	if errSession != nil {
+		return errSession
 	}
+	settings := user.Settings{}
+	if errForm := readForm(h.Logger, r, &settings); errForm != nil {
+		return errForm
+	}
+	settings, errSettings := h.UserRepo.UpdateSettings(currSession.UserLogin, settings)
+	if errSettings != nil {
+		h.Logger.Infow("Error in updating settings", errSettings)
+		return apierr.NotFound(errSettings.Error())
+	}
+	recordAudit(h.Logger, h.AuditRepo, r, currSession.UserLogin, audit.ActionSettingsEdit, currSession.UserID)
+	return jsonResp(h.Logger, w, settings)
+}
 
-	resp, errMrsh := json.Marshal(map[string]interface{}{
-		"token": tokenString,
-	})
-	if errMrsh != nil {
-		h.Logger.Infow("Error in marshal resp", errMrsh)
-		return
+// ============================== HELP FUNC ==============================
+func jsonResp(logger *zap.SugaredLogger, w http.ResponseWriter, data interface{}) error {
+	resp, errMarsh := json.Marshal(data)
+	if errMarsh != nil {
+		return apierr.Internal("error in marshaling", errMarsh)
 	}
 	_, errWrite := w.Write(resp)
 	if errWrite != nil {
-		h.Logger.Infow("Error in write resp", errWrite)
-		return
+		// the status is already sent, there is nothing left to report to the client
+		logger.Infow("Error in write resp", errWrite)
 	}
+	return nil
 }
 
-func (h *UserHandler) errorResp(w http.ResponseWriter, status int, msg string) {
-	resp, errMarsh := json.Marshal(map[string]interface{}{
-		"status": status,
-		"error":  msg,
+// tokenResp hands the session to the client, in the body or as a cookie the page scripts can not read
+func tokenResp(logger *zap.SugaredLogger, sessions session.SessRepo, w http.ResponseWriter, sess *session.Session, cookie bool) error {
+	if cookie {
+		errCookie := sessions.CreateCookie(w, sess)
+		if errCookie != nil {
+			return apierr.Internal("authorize error", errCookie)
+		}
+		return jsonResp(logger, w, map[string]interface{}{
+			"user": map[string]interface{}{
+				"username": sess.UserLogin,
+				"id":       sess.UserID,
+			},
+		})
+	}
+	tokenString, errToken := sessions.CreateToken(sess)
+	if errToken != nil {
+		return apierr.Internal("authorize error", errToken)
+	}
+	return jsonResp(logger, w, map[string]interface{}{
+		"token": tokenString,
 	})
-	if errMarsh != nil {
-		h.Logger.Infow("Error in marshal resp", errMarsh)
+}
+
+// readBody reads the whole body, bodies over the limit of middleware.BodyLimit are refused
+func readBody(r *http.Request) ([]byte, error) {
+	body, errRead := io.ReadAll(r.Body)
+	tooLarge := &http.MaxBytesError{}
+	if errors.As(errRead, &tooLarge) {
+		return nil, apierr.New(http.StatusRequestEntityTooLarge, "payload too large")
 	}
-	_, errWrite := w.Write(resp)
-	if errWrite != nil {
-		h.Logger.Infow("Error in write resp", errMarsh)
+	if errRead != nil {
+		return nil, apierr.Internal("error in reading req body", errRead)
+	}
+	return body, nil
+}
+
+func readForm(logger *zap.SugaredLogger, r *http.Request, form interface{}) error {
+	body, errRead := readBody(r)
+	if errRead != nil {
+		return errRead
+	}
+	defer func(r *http.Request) {
+		errBody := r.Body.Close()
+		if errBody != nil {
+			logger.Infow("Error in closing req body", errBody)
+			return
+		}
+	}(r)
+	errUnMarsh := json.Unmarshal(body, form)
+	if errUnMarsh != nil {
+		logger.Infow("Error in unmarshaling form", errUnMarsh)
+		return apierr.BadRequest("cant unpack payload")
 	}
+	return nil
 }
@@ -0,0 +1,88 @@
+package httpcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Entry is a rendered response body together with the revision of the data it was rendered from
+type Entry struct {
+	Body     []byte
+	Revision string
+}
+
+type item struct {
+	key   string
+	entry Entry
+}
+
+// Cache keeps the most recently used responses. Entries are never invalidated explicitly:
+// a mutation changes the revision and an entry with an older revision is a miss.
+// A nil *Cache is a valid cache that stores nothing.
+type Cache struct {
+	max   int
+	data  map[string]*list.Element
+	order *list.List
+	mutex sync.Mutex
+}
+
+// New returns nil when size is not positive, so the cache can be switched off by configuration
+func New(size int) *Cache {
+	if size <= 0 {
+		return nil
+	}
+	return &Cache{
+		max:   size,
+		data:  make(map[string]*list.Element, size),
+		order: list.New(),
+		mutex: sync.Mutex{},
+	}
+}
+
+func (c *Cache) Get(key string, revision string) (Entry, bool) {
+	if c == nil {
+		return Entry{}, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.data[key]
+	if !ok {
+		return Entry{}, false
+	}
+	cached := elem.Value.(*item)
+	if cached.entry.Revision != revision {
+		c.order.Remove(elem)
+		delete(c.data, key)
+		return Entry{}, false
+	}
+	c.order.MoveToFront(elem)
+	return cached.entry, true
+}
+
+func (c *Cache) Set(key string, entry Entry) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.data[key]; ok {
+		elem.Value.(*item).entry = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.data[key] = c.order.PushFront(&item{key: key, entry: entry})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.data, oldest.Value.(*item).key)
+	}
+}
+
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
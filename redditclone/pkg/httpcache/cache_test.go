@@ -0,0 +1,42 @@
+package httpcache
+
+import "testing"
+
+func TestRevisionInvalidates(t *testing.T) {
+	cache := New(10)
+	cache.Set("posts", Entry{Body: []byte("old"), Revision: "1.0"})
+	if entry, ok := cache.Get("posts", "1.0"); !ok || string(entry.Body) != "old" {
+		t.Fatalf("expected a hit, got %v %q", ok, entry.Body)
+	}
+	if _, ok := cache.Get("posts", "2.0"); ok {
+		t.Errorf("entry of an older revision was served")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("stale entry was kept")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	cache := New(2)
+	cache.Set("a", Entry{Revision: "1"})
+	cache.Set("b", Entry{Revision: "1"})
+	cache.Get("a", "1")
+	cache.Set("c", Entry{Revision: "1"})
+	if _, ok := cache.Get("b", "1"); ok {
+		t.Errorf("least recently used entry was not evicted")
+	}
+	if _, ok := cache.Get("a", "1"); !ok {
+		t.Errorf("recently used entry was evicted")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("got %d entries, expected 2", cache.Len())
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	cache := New(0)
+	cache.Set("a", Entry{Revision: "1"})
+	if _, ok := cache.Get("a", "1"); ok || cache.Len() != 0 {
+		t.Errorf("disabled cache stored an entry")
+	}
+}
@@ -0,0 +1,28 @@
+// Package kv is the shared state of server instances: short-lived keys, counters and pub/sub.
+// MemoryStore serves a single instance, RedisStore shares sessions, revocations, oauth states,
+// two-factor attempts, spam limits and viewers. Shared keeps the repositories in the store,
+// so several instances behind one address serve the same site.
+package kv
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNoKey = errors.New("no such key")
+
+type Store interface {
+	Get(key string) (string, error)
+	// Set with ttl 0 keeps the value until it is deleted
+	Set(key, value string, ttl time.Duration) error
+	// GetDel reads and removes the value at once, only one caller gets it
+	GetDel(key string) (string, error)
+	Del(key string) error
+	// Incr adds one to the counter, the ttl starts when the counter is created
+	Incr(key string, ttl time.Duration) (int64, error)
+	Publish(channel, message string) error
+	// Subscribe delivers messages published after it returns. The channel is closed when ctx
+	// is done or the subscription breaks, messages may be lost from then on.
+	Subscribe(ctx context.Context, channel string) (<-chan string, error)
+}
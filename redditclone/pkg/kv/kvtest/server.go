@@ -0,0 +1,261 @@
+// Package kvtest runs an in-process stand-in for redis, in the spirit of miniredis.
+// It serves the commands RedisStore uses from a MemoryStore.
+package kvtest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+var errProtocol = errors.New("bad command")
+
+type Server struct {
+	Addr     string
+	store    *kv.MemoryStore
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	connsMu  sync.Mutex
+	// commands run one at a time, so MULTI blocks and SET NX are atomic
+	mutex sync.Mutex
+	wg    sync.WaitGroup
+}
+
+// NewServer listens on a random local port until Close
+func NewServer() (*Server, error) {
+	listener, errListen := net.Listen("tcp", "127.0.0.1:0")
+	if errListen != nil {
+		return nil, errListen
+	}
+	server := &Server{
+		Addr:     listener.Addr().String(),
+		store:    kv.NewMemoryStore(),
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	server.wg.Add(1)
+	go server.serve()
+	return server, nil
+}
+
+// Close drops every client, subscribers see their channels closed
+func (s *Server) Close() {
+	s.listener.Close()
+	s.connsMu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsMu.Unlock()
+	s.wg.Wait()
+}
+
+// ============================== HELP FUNC ==============================
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, errAccept := s.listener.Accept()
+		if errAccept != nil {
+			return
+		}
+		s.connsMu.Lock()
+		s.conns[conn] = struct{}{}
+		s.connsMu.Unlock()
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		conn.Close()
+		s.connsMu.Lock()
+		delete(s.conns, conn)
+		s.connsMu.Unlock()
+	}()
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	var queued [][]string
+	inMulti := false
+	for {
+		args, errRead := readCommand(reader)
+		if errRead != nil {
+			return
+		}
+		name := strings.ToUpper(args[0])
+		switch {
+		case name == "SUBSCRIBE" && len(args) == 2 && !inMulti:
+			s.subscribe(conn, reader, writer, args[1])
+			return
+		case name == "MULTI":
+			inMulti = true
+			queued = queued[:0]
+			writer.WriteString("+OK\r\n")
+		case name == "EXEC" && inMulti:
+			inMulti = false
+			s.mutex.Lock()
+			fmt.Fprintf(writer, "*%d\r\n", len(queued))
+			for _, command := range queued {
+				writer.WriteString(s.exec(command))
+			}
+			s.mutex.Unlock()
+		case inMulti:
+			queued = append(queued, args)
+			writer.WriteString("+QUEUED\r\n")
+		default:
+			s.mutex.Lock()
+			writer.WriteString(s.exec(args))
+			s.mutex.Unlock()
+		}
+		if errWrite := writer.Flush(); errWrite != nil {
+			return
+		}
+	}
+}
+
+// subscribe turns the connection into a push stream until either side goes away
+func (s *Server) subscribe(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer, channel string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages, _ := s.store.Subscribe(ctx, channel)
+	fmt.Fprintf(writer, "*3\r\n%s%s:1\r\n", bulk("subscribe"), bulk(channel))
+	if writer.Flush() != nil {
+		return
+	}
+	go func() {
+		// the client sends nothing more, reading only notices the disconnect
+		io.Copy(io.Discard, reader)
+		cancel()
+	}()
+	for message := range messages {
+		fmt.Fprintf(writer, "*3\r\n%s%s%s", bulk("message"), bulk(channel), bulk(message))
+		if writer.Flush() != nil {
+			return
+		}
+	}
+}
+
+// exec must be called with the mutex held, it returns the encoded reply
+func (s *Server) exec(args []string) string {
+	name := strings.ToUpper(args[0])
+	switch {
+	case name == "PING" && len(args) == 1:
+		return "+PONG\r\n"
+	case name == "GET" && len(args) == 2:
+		return bulkReply(s.store.Get(args[1]))
+	case name == "GETDEL" && len(args) == 2:
+		return bulkReply(s.store.GetDel(args[1]))
+	case name == "SET" && len(args) >= 3:
+		return s.set(args[1], args[2], args[3:])
+	case name == "DEL" && len(args) >= 2:
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, errGet := s.store.Get(key); errGet == nil {
+				deleted++
+			}
+			s.store.Del(key)
+		}
+		return ":" + strconv.Itoa(deleted) + "\r\n"
+	case name == "INCR" && len(args) == 2:
+		counter, errIncr := s.store.Incr(args[1], 0)
+		if errIncr != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		return ":" + strconv.FormatInt(counter, 10) + "\r\n"
+	case name == "PUBLISH" && len(args) == 3:
+		s.store.Publish(args[1], args[2])
+		// receivers are not counted, clients here ignore the number
+		return ":0\r\n"
+	}
+	return "-ERR unknown command or wrong number of arguments for '" + args[0] + "'\r\n"
+}
+
+func (s *Server) set(key, value string, options []string) string {
+	var ttl time.Duration
+	onlyNew := false
+	for idx := 0; idx < len(options); idx++ {
+		switch strings.ToUpper(options[idx]) {
+		case "NX":
+			onlyNew = true
+		case "PX", "EX":
+			if idx+1 == len(options) {
+				return "-ERR syntax error\r\n"
+			}
+			amount, errParse := strconv.ParseInt(options[idx+1], 10, 64)
+			if errParse != nil || amount <= 0 {
+				return "-ERR invalid expire time in 'set' command\r\n"
+			}
+			ttl = time.Duration(amount) * time.Millisecond
+			if strings.ToUpper(options[idx]) == "EX" {
+				ttl = time.Duration(amount) * time.Second
+			}
+			idx++
+		default:
+			return "-ERR syntax error\r\n"
+		}
+	}
+	if _, errGet := s.store.Get(key); onlyNew && errGet == nil {
+		return "$-1\r\n"
+	}
+	s.store.Set(key, value, ttl)
+	return "+OK\r\n"
+}
+
+// readCommand reads one array of bulk strings, inline commands are not supported
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	count, errCount := readSize(reader, '*')
+	if errCount != nil {
+		return nil, errCount
+	}
+	if count < 1 {
+		return nil, errProtocol
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		size, errSize := readSize(reader, '$')
+		if errSize != nil {
+			return nil, errSize
+		}
+		data := make([]byte, size+2)
+		if _, errData := io.ReadFull(reader, data); errData != nil {
+			return nil, errData
+		}
+		args = append(args, string(data[:size]))
+	}
+	return args, nil
+}
+
+func readSize(reader *bufio.Reader, kind byte) (int, error) {
+	line, errRead := reader.ReadString('\n')
+	if errRead != nil {
+		return 0, errRead
+	}
+	if len(line) < 4 || line[0] != kind || !strings.HasSuffix(line, "\r\n") {
+		return 0, errProtocol
+	}
+	size, errSize := strconv.Atoi(line[1 : len(line)-2])
+	if errSize != nil || size < 0 {
+		return 0, errProtocol
+	}
+	return size, nil
+}
+
+func bulk(value string) string {
+	return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+}
+
+func bulkReply(value string, errGet error) string {
+	if errGet != nil {
+		return "$-1\r\n"
+	}
+	return bulk(value)
+}
@@ -0,0 +1,166 @@
+package kv
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// subscriberBuffer is how far a subscriber may fall behind before it is dropped
+	subscriberBuffer = 64
+	// expired keys nobody reads again are removed every sweepEvery writes
+	sweepEvery = 1024
+)
+
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+type MemoryStore struct {
+	data        map[string]entry
+	subscribers map[string]map[chan string]struct{}
+	writes      int
+	mutex       sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		data:        make(map[string]entry),
+		subscribers: make(map[string]map[chan string]struct{}),
+		mutex:       sync.Mutex{},
+	}
+}
+
+// ================================ GET ===============================
+func (store *MemoryStore) Get(key string) (string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	item, ok := store.lookup(key)
+	if !ok {
+		return "", ErrNoKey
+	}
+	return item.value, nil
+}
+
+func (store *MemoryStore) GetDel(key string) (string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	item, ok := store.lookup(key)
+	if !ok {
+		return "", ErrNoKey
+	}
+	delete(store.data, key)
+	return item.value, nil
+}
+
+// =============================== POST ===============================
+func (store *MemoryStore) Set(key, value string, ttl time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.data[key] = entry{value: value, expires: expiry(ttl)}
+	store.written()
+	return nil
+}
+
+func (store *MemoryStore) Incr(key string, ttl time.Duration) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	item, ok := store.lookup(key)
+	if !ok {
+		item = entry{value: "0", expires: expiry(ttl)}
+	}
+	counter, errParse := strconv.ParseInt(item.value, 10, 64)
+	if errParse != nil {
+		return 0, errParse
+	}
+	counter++
+	item.value = strconv.FormatInt(counter, 10)
+	store.data[key] = item
+	store.written()
+	return counter, nil
+}
+
+func (store *MemoryStore) Publish(channel, message string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for subscriber := range store.subscribers[channel] {
+		select {
+		case subscriber <- message:
+		default:
+			store.unsubscribe(channel, subscriber)
+		}
+	}
+	return nil
+}
+
+func (store *MemoryStore) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	subscriber := make(chan string, subscriberBuffer)
+	store.mutex.Lock()
+	if _, ok := store.subscribers[channel]; !ok {
+		store.subscribers[channel] = make(map[chan string]struct{})
+	}
+	store.subscribers[channel][subscriber] = struct{}{}
+	store.mutex.Unlock()
+	go func() {
+		<-ctx.Done()
+		store.mutex.Lock()
+		defer store.mutex.Unlock()
+		store.unsubscribe(channel, subscriber)
+	}()
+	return subscriber, nil
+}
+
+// ============================== DELETE ==============================
+func (store *MemoryStore) Del(key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.data, key)
+	return nil
+}
+
+// ============================== HELP FUNC ==============================
+// lookup must be called with the mutex held, expired keys are removed on the way
+func (store *MemoryStore) lookup(key string) (entry, bool) {
+	item, ok := store.data[key]
+	if !ok {
+		return entry{}, false
+	}
+	if !item.expires.IsZero() && !time.Now().Before(item.expires) {
+		delete(store.data, key)
+		return entry{}, false
+	}
+	return item, true
+}
+
+// written must be called with the mutex held after adding a key
+func (store *MemoryStore) written() {
+	store.writes++
+	if store.writes%sweepEvery != 0 {
+		return
+	}
+	for key := range store.data {
+		store.lookup(key)
+	}
+}
+
+// unsubscribe must be called with the mutex held, it is safe to call twice
+func (store *MemoryStore) unsubscribe(channel string, subscriber chan string) {
+	if _, ok := store.subscribers[channel][subscriber]; !ok {
+		return
+	}
+	delete(store.subscribers[channel], subscriber)
+	if len(store.subscribers[channel]) == 0 {
+		delete(store.subscribers, channel)
+	}
+	close(subscriber)
+}
+
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
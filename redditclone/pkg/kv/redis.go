@@ -0,0 +1,326 @@
+package kv
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// RedisStore speaks the redis protocol (RESP2), it needs GETDEL from redis 6.2 or later
+type RedisStore struct {
+	Addr    string
+	Timeout time.Duration
+	pool    chan *redisConn
+}
+
+// RedisError is an error reply of the server
+type RedisError string
+
+func (e RedisError) Error() string { return "redis: " + string(e) }
+
+var errProtocol = errors.New("redis: bad reply")
+
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisStore connects lazily, at most poolSize idle connections are kept
+func NewRedisStore(addr string, poolSize int) *RedisStore {
+	return &RedisStore{
+		Addr:    addr,
+		Timeout: 5 * time.Second,
+		pool:    make(chan *redisConn, poolSize),
+	}
+}
+
+// ================================ GET ===============================
+func (store *RedisStore) Get(key string) (string, error) {
+	return bulkReply(store.do("GET", key))
+}
+
+func (store *RedisStore) GetDel(key string) (string, error) {
+	return bulkReply(store.do("GETDEL", key))
+}
+
+// Ping checks that the server is reachable
+func (store *RedisStore) Ping() error {
+	_, errDo := store.do("PING")
+	return errDo
+}
+
+// =============================== POST ===============================
+func (store *RedisStore) Set(key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, errDo := store.do(args...)
+	return errDo
+}
+
+// Incr creates the counter and increments it in one transaction, so it never loses its ttl
+func (store *RedisStore) Incr(key string, ttl time.Duration) (int64, error) {
+	commands := [][]string{{"MULTI"}}
+	if ttl > 0 {
+		commands = append(commands, []string{"SET", key, "0", "PX", strconv.FormatInt(ttl.Milliseconds(), 10), "NX"})
+	}
+	commands = append(commands, []string{"INCR", key}, []string{"EXEC"})
+	replies, errDo := store.pipeline(commands)
+	if errDo != nil {
+		return 0, errDo
+	}
+	for _, reply := range replies {
+		if errReply, isErr := reply.(RedisError); isErr {
+			return 0, errReply
+		}
+	}
+	results, ok := replies[len(replies)-1].([]interface{})
+	if !ok || len(results) == 0 {
+		return 0, errProtocol
+	}
+	if errReply, isErr := results[len(results)-1].(RedisError); isErr {
+		return 0, errReply
+	}
+	counter, ok := results[len(results)-1].(int64)
+	if !ok {
+		return 0, errProtocol
+	}
+	return counter, nil
+}
+
+func (store *RedisStore) Publish(channel, message string) error {
+	_, errDo := store.do("PUBLISH", channel, message)
+	return errDo
+}
+
+// Subscribe uses a connection of its own, it is closed together with the returned channel
+func (store *RedisStore) Subscribe(ctx context.Context, channel string) (<-chan string, error) {
+	conn, errDial := store.dial()
+	if errDial != nil {
+		return nil, errDial
+	}
+	reply, errDo := conn.roundTrip(store.Timeout, []string{"SUBSCRIBE", channel})
+	if errDo == nil {
+		errDo = expectMessage(reply, "subscribe", channel)
+	}
+	if errDo != nil {
+		conn.Close()
+		return nil, errDo
+	}
+	// pushed messages may take any time to arrive
+	conn.SetDeadline(time.Time{})
+
+	messages := make(chan string, subscriberBuffer)
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		conn.Close()
+	}()
+	go func() {
+		defer close(messages)
+		defer close(stop)
+		for {
+			reply, errRead := readReply(conn.reader)
+			if errRead != nil {
+				return
+			}
+			push, ok := reply.([]interface{})
+			if !ok || len(push) != 3 || push[0] != "message" {
+				continue
+			}
+			payload, _ := push[2].(string)
+			select {
+			case messages <- payload:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return messages, nil
+}
+
+// ============================== DELETE ==============================
+func (store *RedisStore) Del(key string) error {
+	_, errDo := store.do("DEL", key)
+	return errDo
+}
+
+// Close drops the idle connections, subscriptions end with their contexts
+func (store *RedisStore) Close() error {
+	for {
+		select {
+		case conn := <-store.pool:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// ============================== HELP FUNC ==============================
+func (store *RedisStore) do(args ...string) (interface{}, error) {
+	replies, errDo := store.pipeline([][]string{args})
+	if errDo != nil {
+		return nil, errDo
+	}
+	if errReply, isErr := replies[0].(RedisError); isErr {
+		return nil, errReply
+	}
+	return replies[0], nil
+}
+
+// pipeline sends all commands before reading the replies, error replies are returned as values
+func (store *RedisStore) pipeline(commands [][]string) ([]interface{}, error) {
+	conn, errConn := store.get()
+	if errConn != nil {
+		return nil, errConn
+	}
+	conn.SetDeadline(time.Now().Add(store.Timeout))
+	writer := bufio.NewWriter(conn)
+	for _, args := range commands {
+		writeCommand(writer, args)
+	}
+	if errWrite := writer.Flush(); errWrite != nil {
+		conn.Close()
+		return nil, errWrite
+	}
+	replies := make([]interface{}, 0, len(commands))
+	for range commands {
+		reply, errRead := readReply(conn.reader)
+		if errRead != nil {
+			// the connection is out of sync with its replies now
+			conn.Close()
+			return nil, errRead
+		}
+		replies = append(replies, reply)
+	}
+	store.put(conn)
+	return replies, nil
+}
+
+func (store *RedisStore) get() (*redisConn, error) {
+	select {
+	case conn := <-store.pool:
+		return conn, nil
+	default:
+		return store.dial()
+	}
+}
+
+func (store *RedisStore) put(conn *redisConn) {
+	select {
+	case store.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (store *RedisStore) dial() (*redisConn, error) {
+	conn, errDial := net.DialTimeout("tcp", store.Addr, store.Timeout)
+	if errDial != nil {
+		return nil, errDial
+	}
+	return &redisConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+func (conn *redisConn) roundTrip(timeout time.Duration, args []string) (interface{}, error) {
+	conn.SetDeadline(time.Now().Add(timeout))
+	writer := bufio.NewWriter(conn)
+	writeCommand(writer, args)
+	if errWrite := writer.Flush(); errWrite != nil {
+		return nil, errWrite
+	}
+	return readReply(conn.reader)
+}
+
+func writeCommand(writer *bufio.Writer, args []string) {
+	fmt.Fprintf(writer, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(writer, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readReply returns string, int64, nil, RedisError or []interface{} of those
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, errRead := reader.ReadString('\n')
+	if errRead != nil {
+		return nil, errRead
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return RedisError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		size, errSize := strconv.Atoi(body)
+		if errSize != nil || size < -1 {
+			return nil, errProtocol
+		}
+		if size == -1 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, errData := io.ReadFull(reader, data); errData != nil {
+			return nil, errData
+		}
+		return string(data[:size]), nil
+	case '*':
+		size, errSize := strconv.Atoi(body)
+		if errSize != nil || size < -1 {
+			return nil, errProtocol
+		}
+		if size == -1 {
+			return nil, nil
+		}
+		items := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			item, errItem := readReply(reader)
+			if errItem != nil {
+				return nil, errItem
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return nil, errProtocol
+}
+
+func bulkReply(reply interface{}, errDo error) (string, error) {
+	if errDo != nil {
+		return "", errDo
+	}
+	if reply == nil {
+		return "", ErrNoKey
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", errProtocol
+	}
+	return value, nil
+}
+
+func expectMessage(reply interface{}, kind, channel string) error {
+	if errReply, isErr := reply.(RedisError); isErr {
+		return errReply
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 3 || items[0] != kind || items[1] != channel {
+		return errProtocol
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package kv
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// lockTTL frees the lock of an instance that died while writing
+	lockTTL   = 10 * time.Second
+	lockRetry = 5 * time.Millisecond
+	// stale never matches a generation of the store, the state is loaded on the next access
+	stale = "stale"
+)
+
+var ErrLockTimeout = errors.New("shared state is locked by another instance")
+
+// State is the content of a repository kept in memory, saved and loaded as a whole.
+// Restore of empty data empties the repository.
+type State interface {
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+}
+
+// Shared keeps a repository in memory in step with the store, so every instance serves
+// the same content. A write takes a lock in the store, loads the state other instances
+// saved since, changes it and saves it whole. A read loads the state again only when the
+// generation counter in the store moved. Saving whole states suits a site of megabytes.
+type Shared struct {
+	store  Store
+	name   string
+	state  State
+	loaded string // generation of the state in memory, empty before the first save
+	mutex  sync.Mutex
+}
+
+func NewShared(store Store, name string, state State) *Shared {
+	return &Shared{
+		store: store,
+		name:  name,
+		state: state,
+		mutex: sync.Mutex{},
+	}
+}
+
+// Sync loads the state saved by other instances, it is called before every read
+func (shared *Shared) Sync() error {
+	generation, errGet := shared.generation()
+	if errGet != nil {
+		return errGet
+	}
+	shared.mutex.Lock()
+	defer shared.mutex.Unlock()
+	return shared.load(generation)
+}
+
+// Write runs fn against the latest state under the lock of the store and saves the result.
+// A failed fn saves nothing, the state is loaded again in case fn changed it halfway.
+func (shared *Shared) Write(fn func() error) error {
+	shared.mutex.Lock()
+	defer shared.mutex.Unlock()
+	unlock, errLock := shared.lock()
+	if errLock != nil {
+		return errLock
+	}
+	defer unlock()
+	generation, errGet := shared.generation()
+	if errGet != nil {
+		return errGet
+	}
+	if errLoad := shared.load(generation); errLoad != nil {
+		return errLoad
+	}
+	if errFn := fn(); errFn != nil {
+		shared.loaded = stale
+		return errFn
+	}
+	return shared.save()
+}
+
+// load must be called with the mutex held
+func (shared *Shared) load(generation string) error {
+	if generation == shared.loaded {
+		return nil
+	}
+	data, errGet := shared.store.Get(shared.name + ":state")
+	if errGet != nil && errGet != ErrNoKey {
+		return errGet
+	}
+	if errRestore := shared.state.Restore([]byte(data)); errRestore != nil {
+		return errRestore
+	}
+	// the state may be newer than the generation read before it, the next sync loads it once more
+	shared.loaded = generation
+	return nil
+}
+
+// save must be called with the mutex and the lock held. The state goes first,
+// an instance seeing the new generation always finds the new state.
+func (shared *Shared) save() error {
+	data, errSnapshot := shared.state.Snapshot()
+	if errSnapshot != nil {
+		return errSnapshot
+	}
+	if errSet := shared.store.Set(shared.name+":state", string(data), 0); errSet != nil {
+		// the memory is ahead of the store now
+		shared.loaded = stale
+		return errSet
+	}
+	generation, errIncr := shared.store.Incr(shared.name+":generation", 0)
+	if errIncr != nil {
+		shared.loaded = stale
+		return errIncr
+	}
+	shared.loaded = strconv.FormatInt(generation, 10)
+	return nil
+}
+
+func (shared *Shared) generation() (string, error) {
+	generation, errGet := shared.store.Get(shared.name + ":generation")
+	if errGet == ErrNoKey {
+		return "", nil
+	}
+	return generation, errGet
+}
+
+// lock takes the lock of the state in the store, the first to create the counter holds it
+func (shared *Shared) lock() (func(), error) {
+	key := shared.name + ":lock"
+	deadline := time.Now().Add(2 * lockTTL)
+	for {
+		holders, errIncr := shared.store.Incr(key, lockTTL)
+		if errIncr != nil {
+			return nil, errIncr
+		}
+		if holders == 1 {
+			return func() { shared.store.Del(key) }, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(lockRetry)
+	}
+}
@@ -0,0 +1,102 @@
+package kv_test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"redditclone/pkg/kv"
+	"redditclone/pkg/kv/kvtest"
+)
+
+// counterState stands for a repository, its whole content is one number
+type counterState struct {
+	value int
+	mutex sync.Mutex
+}
+
+func (state *counterState) Snapshot() ([]byte, error) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return []byte(strconv.Itoa(state.value)), nil
+}
+
+func (state *counterState) Restore(data []byte) error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if len(data) == 0 {
+		state.value = 0
+		return nil
+	}
+	value, err := strconv.Atoi(string(data))
+	state.value = value
+	return err
+}
+
+func (state *counterState) get() int {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	return state.value
+}
+
+func (state *counterState) add() error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	state.value++
+	return nil
+}
+
+func TestSharedMemoryStore(t *testing.T) {
+	testShared(t, kv.NewMemoryStore())
+}
+
+func TestSharedRedisStore(t *testing.T) {
+	server, err := kvtest.NewServer()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer server.Close()
+	store := kv.NewRedisStore(server.Addr, 8)
+	defer store.Close()
+	testShared(t, store)
+}
+
+func testShared(t *testing.T, store kv.Store) {
+	states := []*counterState{{}, {}}
+	instances := []*kv.Shared{kv.NewShared(store, "counter", states[0]), kv.NewShared(store, "counter", states[1])}
+
+	if err := instances[0].Write(states[0].add); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := instances[1].Sync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := states[1].get(); got != 1 {
+		t.Fatalf("second instance sees %d, expected 1", got)
+	}
+
+	// writes of both instances are applied one after another, none is lost
+	const writes = 50
+	wg := &sync.WaitGroup{}
+	for idx, instance := range instances {
+		wg.Add(1)
+		go func(instance *kv.Shared, state *counterState) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				if err := instance.Write(state.add); err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+			}
+		}(instance, states[idx])
+	}
+	wg.Wait()
+	for idx, instance := range instances {
+		if err := instance.Sync(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := states[idx].get(); got != 1+2*writes {
+			t.Errorf("instance %d sees %d, expected %d", idx, got, 1+2*writes)
+		}
+	}
+}
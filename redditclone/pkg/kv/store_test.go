@@ -0,0 +1,107 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"redditclone/pkg/kv"
+	"redditclone/pkg/kv/kvtest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, kv.NewMemoryStore())
+}
+
+func TestRedisStore(t *testing.T) {
+	server, err := kvtest.NewServer()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer server.Close()
+	store := kv.NewRedisStore(server.Addr, 2)
+	defer store.Close()
+	if err = store.Ping(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testStore(t, store)
+
+	// a lost connection ends the subscription
+	messages, err := store.Subscribe(context.Background(), "events")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server.Close()
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Errorf("unexpected message after the server closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("subscription was not closed with the server")
+	}
+}
+
+func testStore(t *testing.T, store kv.Store) {
+	t.Helper()
+	if _, err := store.Get("missing"); err != kv.ErrNoKey {
+		t.Errorf("expected ErrNoKey, got %v", err)
+	}
+	if err := store.Set("key", "value", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value, err := store.Get("key"); value != "value" || err != nil {
+		t.Errorf("got %q, %v, expected value", value, err)
+	}
+	if value, err := store.GetDel("key"); value != "value" || err != nil {
+		t.Errorf("got %q, %v from GetDel, expected value", value, err)
+	}
+	if _, err := store.GetDel("key"); err != kv.ErrNoKey {
+		t.Errorf("second GetDel: expected ErrNoKey, got %v", err)
+	}
+
+	store.Set("short", "lived", 30*time.Millisecond)
+	for idx := int64(1); idx <= 3; idx++ {
+		if counter, err := store.Incr("counter", 30*time.Millisecond); counter != idx || err != nil {
+			t.Errorf("got %d, %v from Incr, expected %d", counter, err, idx)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := store.Get("short"); err != kv.ErrNoKey {
+		t.Errorf("key did not expire: %v", err)
+	}
+	if counter, _ := store.Incr("counter", time.Minute); counter != 1 {
+		t.Errorf("counter did not expire, got %d", counter)
+	}
+	if err := store.Del("counter"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Get("counter"); err != kv.ErrNoKey {
+		t.Errorf("deleted key is still there: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := store.Subscribe(ctx, "news")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.Publish("other", "skipped")
+	store.Publish("news", "hello")
+	select {
+	case message := <-messages:
+		if message != "hello" {
+			t.Errorf("got message %q, expected hello", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("message was not delivered")
+	}
+	cancel()
+	select {
+	case _, ok := <-messages:
+		if ok {
+			t.Errorf("unexpected message after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("subscription was not closed after cancel")
+	}
+}
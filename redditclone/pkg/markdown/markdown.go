@@ -0,0 +1,349 @@
+// Package markdown renders the markdown subset of posts and comments to html.
+// Raw html in the source is never passed through, every piece of text is escaped,
+// so the output is safe to insert into a page as is.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxDepth limits nesting of quotes and emphasis
+const maxDepth = 8
+
+var (
+	headingRe   = regexp.MustCompile(`^(#{1,6})\s+(.*?)(?:\s+#+)?$`)
+	bulletRe    = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	orderedRe   = regexp.MustCompile(`^\d{1,9}[.)]\s+(.*)$`)
+	ruleRe      = regexp.MustCompile(`^(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	referenceRe = regexp.MustCompile(`^/?([ru])/([A-Za-z0-9_-]+)`)
+)
+
+// referencePaths are the frontend routes of r/category and u/login references
+var referencePaths = map[string]string{
+	"r": "/a/",
+	"u": "/u/",
+}
+
+// Render turns the source into sanitized html, empty source gives an empty string
+func Render(src string) string {
+	if strings.TrimSpace(src) == "" {
+		return ""
+	}
+	out := &strings.Builder{}
+	renderBlocks(out, strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n"), 0)
+	return out.String()
+}
+
+// ============================== BLOCKS ==============================
+func renderBlocks(out *strings.Builder, lines []string, depth int) {
+	for idx := 0; idx < len(lines); {
+		line := strings.TrimSpace(lines[idx])
+		switch {
+		case line == "":
+			idx++
+		case strings.HasPrefix(line, "```"):
+			idx = renderFence(out, lines, idx)
+		case ruleRe.MatchString(line):
+			out.WriteString("<hr>\n")
+			idx++
+		case headingRe.MatchString(line):
+			match := headingRe.FindStringSubmatch(line)
+			tag := "h" + strconv.Itoa(len(match[1]))
+			out.WriteString("<" + tag + ">")
+			renderInline(out, match[2], 0, true)
+			out.WriteString("</" + tag + ">\n")
+			idx++
+		case strings.HasPrefix(line, ">") && depth < maxDepth:
+			quoted := make([]string, 0, 4)
+			for ; idx < len(lines); idx++ {
+				inner := strings.TrimSpace(lines[idx])
+				if !strings.HasPrefix(inner, ">") {
+					break
+				}
+				quoted = append(quoted, strings.TrimPrefix(inner[1:], " "))
+			}
+			out.WriteString("<blockquote>\n")
+			renderBlocks(out, quoted, depth+1)
+			out.WriteString("</blockquote>\n")
+		case bulletRe.MatchString(line):
+			idx = renderList(out, lines, idx, bulletRe, "ul")
+		case orderedRe.MatchString(line):
+			idx = renderList(out, lines, idx, orderedRe, "ol")
+		default:
+			idx = renderParagraph(out, lines, idx)
+		}
+	}
+}
+
+// renderFence writes a fenced code block, an unclosed fence runs to the end of the source
+func renderFence(out *strings.Builder, lines []string, start int) int {
+	end := start + 1
+	for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), "```") {
+		end++
+	}
+	out.WriteString("<pre><code>")
+	out.WriteString(html.EscapeString(strings.Join(lines[start+1:end], "\n")))
+	out.WriteString("</code></pre>\n")
+	if end < len(lines) {
+		end++
+	}
+	return end
+}
+
+func renderList(out *strings.Builder, lines []string, start int, marker *regexp.Regexp, tag string) int {
+	out.WriteString("<" + tag + ">\n")
+	idx := start
+	for ; idx < len(lines); idx++ {
+		match := marker.FindStringSubmatch(strings.TrimSpace(lines[idx]))
+		if match == nil {
+			break
+		}
+		out.WriteString("<li>")
+		renderInline(out, match[1], 0, true)
+		out.WriteString("</li>\n")
+	}
+	out.WriteString("</" + tag + ">\n")
+	return idx
+}
+
+// renderParagraph always takes the first line, so blocks too deep to nest end up as text
+func renderParagraph(out *strings.Builder, lines []string, start int) int {
+	end := start + 1
+	for end < len(lines) && !startsBlock(lines[end]) {
+		end++
+	}
+	text := make([]string, 0, end-start)
+	for _, line := range lines[start:end] {
+		text = append(text, strings.TrimSpace(line))
+	}
+	out.WriteString("<p>")
+	renderInline(out, strings.Join(text, "\n"), 0, true)
+	out.WriteString("</p>\n")
+	return end
+}
+
+func startsBlock(line string) bool {
+	line = strings.TrimSpace(line)
+	return line == "" ||
+		strings.HasPrefix(line, "```") ||
+		strings.HasPrefix(line, ">") ||
+		ruleRe.MatchString(line) ||
+		headingRe.MatchString(line) ||
+		bulletRe.MatchString(line) ||
+		orderedRe.MatchString(line)
+}
+
+// ============================== INLINE ==============================
+// renderInline writes text with emphasis, code and links, links are off inside link labels
+func renderInline(out *strings.Builder, text string, depth int, links bool) {
+	find := &closers{text: text, last: make(map[byte][2]int)}
+	for idx := 0; idx < len(text); {
+		if n := renderSpan(out, text, idx, depth, links, find); n > 0 {
+			idx += n
+			continue
+		}
+		writeEscaped(out, text[idx])
+		idx++
+	}
+}
+
+// renderSpan writes the span starting at idx and returns its length, 0 means plain text
+func renderSpan(out *strings.Builder, text string, idx int, depth int, links bool, find *closers) int {
+	rest := text[idx:]
+	boundary := idx == 0 || !isWord(text[idx-1])
+	switch rest[0] {
+	case '\\':
+		if len(rest) > 1 && strings.IndexByte("\\`*_{}[]()#+-.!~>|", rest[1]) >= 0 {
+			writeEscaped(out, rest[1])
+			return 2
+		}
+	case '`':
+		if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+			out.WriteString("<code>" + html.EscapeString(rest[1:end+1]) + "</code>")
+			return end + 2
+		}
+	case '[':
+		if links {
+			return renderLink(out, text, idx, depth, find)
+		}
+	case '*', '_', '~':
+		if depth < maxDepth {
+			return renderEmphasis(out, rest, depth, links, boundary)
+		}
+	case 'h':
+		if links && boundary {
+			return renderAutolink(out, rest)
+		}
+	case 'r', 'u', '/':
+		if links && (idx == 0 || !isWord(text[idx-1]) && text[idx-1] != '/' && text[idx-1] != '.') {
+			return renderReference(out, rest)
+		}
+	}
+	return 0
+}
+
+var emphasisTags = []struct {
+	delim string
+	tag   string
+}{
+	{"**", "strong"},
+	{"__", "strong"},
+	{"~~", "del"},
+	{"*", "em"},
+	{"_", "em"},
+}
+
+func renderEmphasis(out *strings.Builder, rest string, depth int, links bool, boundary bool) int {
+	for _, item := range emphasisTags {
+		if !strings.HasPrefix(rest, item.delim) {
+			continue
+		}
+		size := len(item.delim)
+		// underscores inside words such as snake_case are not emphasis
+		if item.delim[0] == '_' && !boundary {
+			return 0
+		}
+		end := strings.Index(rest[size:], item.delim)
+		if end <= 0 {
+			return 0
+		}
+		inner := rest[size : size+end]
+		after := size + end + size
+		if strings.TrimSpace(inner) != inner ||
+			item.delim[0] == '_' && after < len(rest) && isWord(rest[after]) {
+			return 0
+		}
+		out.WriteString("<" + item.tag + ">")
+		renderInline(out, inner, depth+1, links)
+		out.WriteString("</" + item.tag + ">")
+		return after
+	}
+	return 0
+}
+
+// renderLink handles [label](url), links with unsafe urls stay plain text
+func renderLink(out *strings.Builder, text string, idx int, depth int, find *closers) int {
+	labelEnd := find.next(']', idx)
+	if labelEnd <= idx+1 || labelEnd+1 >= len(text) || text[labelEnd+1] != '(' {
+		return 0
+	}
+	urlEnd := find.next(')', labelEnd+2)
+	if urlEnd < 0 {
+		return 0
+	}
+	href, ok := SafeURL(text[labelEnd+2 : urlEnd])
+	if !ok {
+		return 0
+	}
+	writeAnchor(out, href)
+	renderInline(out, text[idx+1:labelEnd], depth+1, false)
+	out.WriteString("</a>")
+	return urlEnd + 1 - idx
+}
+
+// closers finds the brackets closing links. Unlike emphasis and code, a link opener is not
+// its own closer, so a run of openers would scan the rest of the text once for each of them.
+// The last search is remembered instead, starts only move forward and the scan stays linear.
+type closers struct {
+	text string
+	last map[byte][2]int // where the search started and what it found, -1 for nothing
+}
+
+// next returns the index of the first c at or after start, -1 if there is none
+func (find *closers) next(c byte, start int) int {
+	if last, ok := find.last[c]; ok && last[0] <= start && (last[1] < 0 || start <= last[1]) {
+		return last[1]
+	}
+	found := strings.IndexByte(find.text[start:], c)
+	if found >= 0 {
+		found += start
+	}
+	find.last[c] = [2]int{start, found}
+	return found
+}
+
+// renderAutolink links bare http and https urls, trailing punctuation is left out of the link
+func renderAutolink(out *strings.Builder, rest string) int {
+	if !strings.HasPrefix(rest, "http://") && !strings.HasPrefix(rest, "https://") {
+		return 0
+	}
+	end := strings.IndexAny(rest, " \t\n<>\"")
+	if end < 0 {
+		end = len(rest)
+	}
+	end = len(strings.TrimRight(rest[:end], ".,;:!?)'"))
+	href, ok := SafeURL(rest[:end])
+	if !ok {
+		return 0
+	}
+	writeAnchor(out, href)
+	out.WriteString(html.EscapeString(rest[:end]))
+	out.WriteString("</a>")
+	return end
+}
+
+// renderReference links r/category and u/login to the frontend pages
+func renderReference(out *strings.Builder, rest string) int {
+	match := referenceRe.FindStringSubmatch(rest)
+	if match == nil {
+		return 0
+	}
+	out.WriteString(`<a href="` + referencePaths[match[1]] + match[2] + `">`)
+	out.WriteString(html.EscapeString(match[0]))
+	out.WriteString("</a>")
+	return len(match[0])
+}
+
+// ============================== HELP FUNC ==============================
+// SafeURL allows http, https and mailto urls and site paths, anything else may run scripts
+func SafeURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.ContainsAny(raw, "\\ \t\n") {
+		return "", false
+	}
+	if strings.HasPrefix(raw, "/") {
+		// a second slash would make a link to another host
+		return raw, !strings.HasPrefix(raw, "//")
+	}
+	parsed, errParse := url.Parse(raw)
+	if errParse != nil {
+		return "", false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		return parsed.String(), parsed.Host != ""
+	case "mailto":
+		return parsed.String(), parsed.Opaque != ""
+	}
+	return "", false
+}
+
+// writeAnchor opens a link to a user given url, those are not endorsed by the site
+func writeAnchor(out *strings.Builder, href string) {
+	out.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow">`)
+}
+
+func writeEscaped(out *strings.Builder, c byte) {
+	switch c {
+	case '&':
+		out.WriteString("&amp;")
+	case '<':
+		out.WriteString("&lt;")
+	case '>':
+		out.WriteString("&gt;")
+	case '"':
+		out.WriteString("&#34;")
+	case '\'':
+		out.WriteString("&#39;")
+	default:
+		out.WriteByte(c)
+	}
+}
+
+func isWord(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
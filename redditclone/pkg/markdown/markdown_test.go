@@ -0,0 +1,70 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		html string
+	}{
+		{"empty", " \n ", ""},
+		{"paragraphs", "one\ntwo\n\nthree", "<p>one\ntwo</p>\n<p>three</p>\n"},
+		{"emphasis", "**bold** *em* ~~gone~~ snake_case_name", "<p><strong>bold</strong> <em>em</em> <del>gone</del> snake_case_name</p>\n"},
+		{"code", "`<b>` and\n```\n<i>x</i>\n```", "<p><code>&lt;b&gt;</code> and</p>\n<pre><code>&lt;i&gt;x&lt;/i&gt;</code></pre>\n"},
+		{"heading", "## Title ##", "<h2>Title</h2>\n"},
+		{"lists", "- a\n- b\n1. c", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n<ol>\n<li>c</li>\n</ol>\n"},
+		{"quote", "> quoted\n> **line**\n\nafter", "<blockquote>\n<p>quoted\n<strong>line</strong></p>\n</blockquote>\n<p>after</p>\n"},
+		{"link", "[site](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow">site</a></p>` + "\n"},
+		{"autolink", "see https://example.com/x.", `<p>see <a href="https://example.com/x" rel="nofollow">https://example.com/x</a>.</p>` + "\n"},
+		{"references", "ask r/music or /u/some_login, not and/or r/", `<p>ask <a href="/a/music">r/music</a> or <a href="/u/some_login">/u/some_login</a>, not and/or r/</p>` + "\n"},
+		{"escape", `\*not em\*`, "<p>*not em*</p>\n"},
+	}
+	for _, item := range cases {
+		if got := Render(item.src); got != item.html {
+			t.Errorf("%s: got %q, expected %q", item.name, got, item.html)
+		}
+	}
+}
+
+func TestRenderSanitizes(t *testing.T) {
+	cases := []string{
+		`<script>alert(1)</script>`,
+		`<img src=x onerror=alert(1)>`,
+		`[click](javascript:alert(1))`,
+		`[click](//evil.example)`,
+		`[click](data:text/html;base64,PHNjcmlwdD4=)`,
+		`[x"onmouseover="alert(1)](https://example.com/"onmouseover="alert(1))`,
+		"> " + strings.Repeat(">", 100) + " <script>",
+	}
+	for _, src := range cases {
+		got := Render(src)
+		for _, bad := range []string{"<script", "<img", `href="javascript`, `href="data`, `href="//`, `"onmouseover`} {
+			if strings.Contains(got, bad) {
+				t.Errorf("Render(%q) = %q contains %q", src, got, bad)
+			}
+		}
+	}
+}
+
+func TestRenderLinearInUnclosedLinks(t *testing.T) {
+	size := 1 << 20
+	cases := map[string]string{
+		"openers":       strings.Repeat("[", size),
+		"labels":        strings.Repeat("[a]", size/3),
+		"urls":          strings.Repeat("[a](", size/4),
+		"openers first": strings.Repeat("[", size/2) + strings.Repeat("]", size/2),
+	}
+	for name, src := range cases {
+		start := time.Now()
+		Render(src)
+		// a linear render takes milliseconds, a quadratic one minutes
+		if spent := time.Since(start); spent > 2*time.Second {
+			t.Errorf("%s: render of %d bytes took %v", name, len(src), spent)
+		}
+	}
+}
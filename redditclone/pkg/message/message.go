@@ -0,0 +1,31 @@
+package message
+
+type Message struct {
+	ID      string `json:"id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Body    string `json:"body"`
+	Created string `json:"created"`
+	Read    bool   `json:"read"`
+}
+
+type Conversation struct {
+	With        string  `json:"with"`
+	LastMessage Message `json:"lastMessage"`
+	Unread      int     `json:"unread"`
+}
+
+type MessageRepo interface {
+	Send(from, to, body string) (Message, error)
+	GetConversations(login string) ([]Conversation, error)
+	GetConversation(login, with string) ([]Message, error)
+	MarkRead(login, with string) (int, error)
+	UnreadCount(login string) (int, error)
+	Block(login, blocked string) error
+	Unblock(login, blocked string) error
+	IsBlocked(login, by string) bool
+	GetBlocked(login string) ([]string, error)
+	// Purge removes the conversations of the user and every block made by or against them,
+	// so whoever registers the login later starts clean
+	Purge(login string) (int, error)
+}
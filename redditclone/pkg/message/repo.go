@@ -0,0 +1,196 @@
+package message
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const MaxBodyLen = 10000
+
+var (
+	ErrEmptyBody = errors.New("empty message")
+	ErrLongBody  = errors.New("message is too long")
+	ErrSelf      = errors.New("cant message yourself")
+	ErrBlocked   = errors.New("recipient does not accept your messages")
+)
+
+type MessageMemoryRepository struct {
+	// conversations are keyed by the sorted pair of logins
+	data    map[string][]Message
+	blocked map[string]map[string]bool
+	mutex   sync.Mutex
+}
+
+func NewMemoryRepo() *MessageMemoryRepository {
+	return &MessageMemoryRepository{
+		data:    make(map[string][]Message),
+		blocked: make(map[string]map[string]bool),
+		mutex:   sync.Mutex{},
+	}
+}
+
+// =============================== POST ===============================
+func (repo *MessageMemoryRepository) Send(from, to, body string) (Message, error) {
+	switch {
+	case from == to:
+		return Message{}, ErrSelf
+	case body == "":
+		return Message{}, ErrEmptyBody
+	case len(body) > MaxBodyLen:
+		return Message{}, ErrLongBody
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if repo.blocked[to][from] || repo.blocked[from][to] {
+		return Message{}, ErrBlocked
+	}
+	msg := Message{
+		ID:      uuid.New().String(),
+		From:    from,
+		To:      to,
+		Body:    body,
+		Created: time.Now().Format(time.RFC3339),
+	}
+	key := conversationKey(from, to)
+	repo.data[key] = append(repo.data[key], msg)
+	return msg, nil
+}
+
+func (repo *MessageMemoryRepository) MarkRead(login, with string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	marked := 0
+	messages := repo.data[conversationKey(login, with)]
+	for idx := range messages {
+		if messages[idx].To == login && !messages[idx].Read {
+			messages[idx].Read = true
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (repo *MessageMemoryRepository) Block(login, blocked string) error {
+	if login == blocked {
+		return ErrSelf
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.blocked[login]; !ok {
+		repo.blocked[login] = make(map[string]bool)
+	}
+	repo.blocked[login][blocked] = true
+	return nil
+}
+
+// ================================ GET ===============================
+func (repo *MessageMemoryRepository) GetConversations(login string) ([]Conversation, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	conversations := make([]Conversation, 0)
+	for _, messages := range repo.data {
+		if len(messages) == 0 {
+			continue
+		}
+		last := messages[len(messages)-1]
+		var with string
+		switch login {
+		case last.From:
+			with = last.To
+		case last.To:
+			with = last.From
+		default:
+			continue
+		}
+		conversations = append(conversations, Conversation{
+			With:        with,
+			LastMessage: last,
+			Unread:      countUnread(messages, login),
+		})
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].LastMessage.Created > conversations[j].LastMessage.Created
+	})
+	return conversations, nil
+}
+
+func (repo *MessageMemoryRepository) GetConversation(login, with string) ([]Message, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	messages := repo.data[conversationKey(login, with)]
+	return append(make([]Message, 0, len(messages)), messages...), nil
+}
+
+func (repo *MessageMemoryRepository) UnreadCount(login string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	unread := 0
+	for _, messages := range repo.data {
+		unread += countUnread(messages, login)
+	}
+	return unread, nil
+}
+
+func (repo *MessageMemoryRepository) IsBlocked(login, by string) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return repo.blocked[by][login]
+}
+
+func (repo *MessageMemoryRepository) GetBlocked(login string) ([]string, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	blocked := make([]string, 0, len(repo.blocked[login]))
+	for item := range repo.blocked[login] {
+		blocked = append(blocked, item)
+	}
+	sort.Strings(blocked)
+	return blocked, nil
+}
+
+// ============================== DELETE ==============================
+func (repo *MessageMemoryRepository) Unblock(login, blocked string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	delete(repo.blocked[login], blocked)
+	return nil
+}
+
+func (repo *MessageMemoryRepository) Purge(login string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	removed := 0
+	for key, messages := range repo.data {
+		if len(messages) > 0 && (messages[0].From == login || messages[0].To == login) {
+			removed += len(messages)
+			delete(repo.data, key)
+		}
+	}
+	delete(repo.blocked, login)
+	for _, blocked := range repo.blocked {
+		delete(blocked, login)
+	}
+	return removed, nil
+}
+
+// ============================== HELP FUNC ==============================
+func conversationKey(first, second string) string {
+	if first > second {
+		first, second = second, first
+	}
+	return first + "\x00" + second
+}
+
+func countUnread(messages []Message, login string) int {
+	unread := 0
+	for _, msg := range messages {
+		if msg.To == login && !msg.Read {
+			unread++
+		}
+	}
+	return unread
+}
@@ -0,0 +1,109 @@
+package message
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSendRefusals(t *testing.T) {
+	repo := NewMemoryRepo()
+	cases := []struct {
+		name     string
+		from, to string
+		body     string
+		err      error
+	}{
+		{"self", "alice", "alice", "hi", ErrSelf},
+		{"empty", "alice", "bob", "", ErrEmptyBody},
+		{"long", "alice", "bob", strings.Repeat("a", MaxBodyLen+1), ErrLongBody},
+	}
+	for _, item := range cases {
+		if _, err := repo.Send(item.from, item.to, item.body); err != item.err {
+			t.Errorf("%s: got %v, expected %v", item.name, err, item.err)
+		}
+	}
+	if _, err := repo.Send("alice", "bob", strings.Repeat("a", MaxBodyLen)); err != nil {
+		t.Errorf("body of the maximal length: unexpected error: %v", err)
+	}
+}
+
+func TestBlockWorksBothWays(t *testing.T) {
+	repo := NewMemoryRepo()
+	if err := repo.Block("bob", "alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := repo.Send("alice", "bob", "hi"); err != ErrBlocked {
+		t.Errorf("blocked sender got %v", err)
+	}
+	// the one who blocked can not write either, the other side could not answer
+	if _, err := repo.Send("bob", "alice", "hi"); err != ErrBlocked {
+		t.Errorf("blocking user got %v", err)
+	}
+	if !repo.IsBlocked("alice", "bob") || repo.IsBlocked("bob", "alice") {
+		t.Errorf("IsBlocked does not follow who blocked whom")
+	}
+	if err := repo.Unblock("bob", "alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := repo.Send("alice", "bob", "hi"); err != nil {
+		t.Errorf("unblocked sender got %v", err)
+	}
+	if err := repo.Block("bob", "bob"); err != ErrSelf {
+		t.Errorf("blocking yourself got %v", err)
+	}
+}
+
+func TestConversationsAndUnread(t *testing.T) {
+	repo := NewMemoryRepo()
+	repo.Send("alice", "bob", "one")
+	repo.Send("alice", "bob", "two")
+	repo.Send("bob", "alice", "three")
+	repo.Send("carol", "bob", "four")
+
+	if unread, _ := repo.UnreadCount("bob"); unread != 3 {
+		t.Errorf("bob has %d unread, expected 3", unread)
+	}
+	if marked, _ := repo.MarkRead("bob", "alice"); marked != 2 {
+		t.Errorf("marked %d, expected 2", marked)
+	}
+	if unread, _ := repo.UnreadCount("bob"); unread != 1 {
+		t.Errorf("bob has %d unread after reading alice, expected 1", unread)
+	}
+	conversations, _ := repo.GetConversations("bob")
+	if len(conversations) != 2 {
+		t.Fatalf("bob has %d conversations, expected 2", len(conversations))
+	}
+	messages, _ := repo.GetConversation("alice", "bob")
+	if len(messages) != 3 || messages[2].Body != "three" {
+		t.Errorf("got conversation %+v", messages)
+	}
+	if conversations, _ = repo.GetConversations("dave"); len(conversations) != 0 {
+		t.Errorf("a stranger sees %d conversations", len(conversations))
+	}
+}
+
+func TestPurge(t *testing.T) {
+	repo := NewMemoryRepo()
+	repo.Send("alice", "bob", "one")
+	repo.Send("bob", "alice", "two")
+	repo.Send("bob", "carol", "three")
+	repo.Block("alice", "carol")
+	repo.Block("carol", "alice")
+
+	removed, err := repo.Purge("alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed %d messages, expected 2", removed)
+	}
+	if conversations, _ := repo.GetConversations("bob"); len(conversations) != 1 || conversations[0].With != "carol" {
+		t.Errorf("bob kept conversations %+v", conversations)
+	}
+	if blocked, _ := repo.GetBlocked("alice"); len(blocked) != 0 {
+		t.Errorf("alice kept blocks %v", blocked)
+	}
+	if repo.IsBlocked("alice", "carol") {
+		t.Errorf("the block against alice survived")
+	}
+}
@@ -0,0 +1,129 @@
+package message
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"redditclone/pkg/kv"
+)
+
+// messageState is a snapshot of the repository
+type messageState struct {
+	Data    map[string][]Message
+	Blocked map[string]map[string]bool
+}
+
+func (repo *MessageMemoryRepository) Snapshot() ([]byte, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	buf := &bytes.Buffer{}
+	errEncode := gob.NewEncoder(buf).Encode(messageState{Data: repo.data, Blocked: repo.blocked})
+	return buf.Bytes(), errEncode
+}
+
+func (repo *MessageMemoryRepository) Restore(data []byte) error {
+	state := messageState{}
+	if len(data) > 0 {
+		if errDecode := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); errDecode != nil {
+			return errDecode
+		}
+	}
+	if state.Data == nil {
+		state.Data = make(map[string][]Message)
+	}
+	if state.Blocked == nil {
+		state.Blocked = make(map[string]map[string]bool)
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.data = state.Data
+	repo.blocked = state.Blocked
+	return nil
+}
+
+// SharedRepository serves the messages every instance delivers through the store
+type SharedRepository struct {
+	local  *MessageMemoryRepository
+	shared *kv.Shared
+}
+
+func NewSharedRepo(store kv.Store) *SharedRepository {
+	local := NewMemoryRepo()
+	return &SharedRepository{
+		local:  local,
+		shared: kv.NewShared(store, "messages", local),
+	}
+}
+
+// ================================ GET ===============================
+func (repo *SharedRepository) GetConversations(login string) ([]Conversation, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetConversations(login)
+}
+
+func (repo *SharedRepository) GetConversation(login, with string) ([]Message, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetConversation(login, with)
+}
+
+func (repo *SharedRepository) UnreadCount(login string) (int, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return 0, errSync
+	}
+	return repo.local.UnreadCount(login)
+}
+
+// IsBlocked answers from memory when the store fails, Send checks blocks again under the lock
+func (repo *SharedRepository) IsBlocked(login, by string) bool {
+	repo.shared.Sync()
+	return repo.local.IsBlocked(login, by)
+}
+
+func (repo *SharedRepository) GetBlocked(login string) ([]string, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetBlocked(login)
+}
+
+// =============================== POST ===============================
+func (repo *SharedRepository) Send(from, to, body string) (sent Message, errWrite error) {
+	errWrite = repo.shared.Write(func() (errSend error) {
+		sent, errSend = repo.local.Send(from, to, body)
+		return errSend
+	})
+	return sent, errWrite
+}
+
+func (repo *SharedRepository) MarkRead(login, with string) (marked int, errWrite error) {
+	errWrite = repo.shared.Write(func() (errMark error) {
+		marked, errMark = repo.local.MarkRead(login, with)
+		return errMark
+	})
+	return marked, errWrite
+}
+
+func (repo *SharedRepository) Block(login, blocked string) error {
+	return repo.shared.Write(func() error {
+		return repo.local.Block(login, blocked)
+	})
+}
+
+// ============================== DELETE ==============================
+func (repo *SharedRepository) Unblock(login, blocked string) error {
+	return repo.shared.Write(func() error {
+		return repo.local.Unblock(login, blocked)
+	})
+}
+
+func (repo *SharedRepository) Purge(login string) (removed int, errWrite error) {
+	errWrite = repo.shared.Write(func() (errPurge error) {
+		removed, errPurge = repo.local.Purge(login)
+		return errPurge
+	})
+	return removed, errWrite
+}
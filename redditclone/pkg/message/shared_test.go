@@ -0,0 +1,30 @@
+package message
+
+import (
+	"testing"
+
+	"redditclone/pkg/kv"
+)
+
+func TestSharedRepoAcrossInstances(t *testing.T) {
+	store := kv.NewMemoryStore()
+	var first, second MessageRepo = NewSharedRepo(store), NewSharedRepo(store)
+	if _, err := first.Send("alice", "bob", "hi"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if unread, _ := second.UnreadCount("bob"); unread != 1 {
+		t.Errorf("bob has %d unread on the other instance, expected 1", unread)
+	}
+	if marked, _ := second.MarkRead("bob", "alice"); marked != 1 {
+		t.Errorf("marked %d, expected 1", marked)
+	}
+	if unread, _ := first.UnreadCount("bob"); unread != 0 {
+		t.Errorf("bob has %d unread after reading, expected 0", unread)
+	}
+	if err := second.Block("bob", "alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := first.Send("alice", "bob", "again"); err != ErrBlocked {
+		t.Errorf("blocked sender on the other instance got %v", err)
+	}
+}
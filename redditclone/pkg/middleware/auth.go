@@ -4,13 +4,18 @@ import (
 	"fmt"
 	"net/http"
 
+	"redditclone/pkg/apierr"
 	"redditclone/pkg/session"
+	"redditclone/pkg/token"
 )
 
-func Auth(sm *session.SessionsManager, next http.Handler) http.Handler {
+func Auth(sm session.SessRepo, tokens token.TokenRepo, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("auth middleware")
-		sess, err := sm.Check(w, r)
+		sess, err := tokenSession(tokens, r)
+		if sess == nil && err == nil {
+			sess, err = sm.Check(w, r)
+		}
 		if sess != nil && err == nil {
 			ctx := session.ContextWithSession(r.Context(), sess)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -19,3 +24,33 @@ func Auth(sm *session.SessionsManager, next http.Handler) http.Handler {
 		}
 	})
 }
+
+// Scope rejects sessions opened with an API token lacking the scope, anonymous requests are left to the handler
+func Scope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := session.SessionFromContext(r.Context())
+		if err == nil && !sess.HasScope(scope) {
+			apierr.Write(w, apierr.Forbidden("token lacks scope "+scope))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// tokenSession returns nil without error when the request carries no API token
+func tokenSession(tokens token.TokenRepo, r *http.Request) (*session.Session, error) {
+	secret, ok := session.BearerToken(r.Header.Get("Authorization"))
+	if !ok || !token.IsToken(secret) {
+		return nil, nil
+	}
+	tok, err := tokens.Check(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &session.Session{
+		ID:        tok.ID,
+		UserID:    tok.UserID,
+		UserLogin: tok.Login,
+		Scopes:    tok.Scopes,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"redditclone/pkg/kv"
+	"redditclone/pkg/session"
+	"redditclone/pkg/token"
+	"redditclone/pkg/user"
+)
+
+func TestTokenScopes(t *testing.T) {
+	tokens := token.NewMemoryRepo()
+	owner := user.User{ID: "id", Login: "alice"}
+	readTok, readSecret, _ := tokens.Create(owner, "reader", []string{token.ScopeRead})
+	_, postSecret, _ := tokens.Create(owner, "poster", []string{token.ScopeRead, token.ScopePost})
+
+	// the handler answers 401 itself when no session reaches it, like the real ones
+	write := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := session.SessionFromContext(r.Context()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler := Auth(session.NewSessionsManager(kv.NewMemoryStore()), tokens, Scope(token.ScopePost, write))
+	status := func(secret string) int {
+		r := httptest.NewRequest("POST", "/api/posts", nil)
+		r.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if got := status(readSecret); got != http.StatusForbidden {
+		t.Errorf("read token on a write route got %d, expected 403", got)
+	}
+	if got := status(postSecret); got != http.StatusCreated {
+		t.Errorf("post token got %d, expected 201", got)
+	}
+	tokens.Revoke(readTok.ID, owner.Login)
+	if got := status(readSecret); got != http.StatusUnauthorized {
+		t.Errorf("revoked token got %d, expected 401", got)
+	}
+}
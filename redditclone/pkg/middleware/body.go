@@ -0,0 +1,15 @@
+package middleware
+
+import "net/http"
+
+// DefaultMaxBody is far above any form of the api, posts and comments included
+const DefaultMaxBody = 1 << 20
+
+// BodyLimit caps request bodies, reading past the limit fails with *http.MaxBytesError.
+// Without it one request could make the server buffer and render any amount of text.
+func BodyLimit(limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
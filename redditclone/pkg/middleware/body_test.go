@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	handler := BodyLimit(8, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+		tooLarge := &http.MaxBytesError{}
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+	for body, status := range map[string]int{
+		"12345678":  http.StatusOK,
+		"123456789": http.StatusRequestEntityTooLarge,
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/posts", strings.NewReader(body)))
+		if recorder.Code != status {
+			t.Errorf("body of %d bytes: got status %d, expected %d", len(body), recorder.Code, status)
+		}
+	}
+}
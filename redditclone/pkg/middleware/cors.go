@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"redditclone/pkg/apierr"
+)
+
+type CORSConfig struct {
+	// AllowedOrigins are compared exactly, "*" allows any origin but never with credentials
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// DefaultCORSConfig lets the origins use the API with bearer tokens, cookies are not sent
+func DefaultCORSConfig(origins ...string) CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders: []string{"Authorization", "Content-Type", "If-None-Match", "If-Modified-Since", "X-CSRF-Token"},
+		ExposedHeaders: []string{"ETag", "Last-Modified"},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+// CORS answers preflight requests itself, other requests only get the headers added
+func CORS(config CORSConfig, next http.Handler) http.Handler {
+	methods := strings.Join(config.AllowedMethods, ", ")
+	headers := strings.Join(config.AllowedHeaders, ", ")
+	exposed := strings.Join(config.ExposedHeaders, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(config.AllowedOrigins) == 0 || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// the answer depends on the origin, shared caches must keep them apart
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		allowed, wildcard := config.allows(origin)
+		if !allowed {
+			if preflight {
+				apierr.Write(w, apierr.Forbidden("origin not allowed"))
+				return
+			}
+			// the browser hides the response from the page without the headers
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		if wildcard {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+			if config.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		if !preflight {
+			if exposed != "" {
+				header.Set("Access-Control-Expose-Headers", exposed)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !containsFold(config.AllowedMethods, r.Header.Get("Access-Control-Request-Method")) {
+			apierr.Write(w, apierr.Forbidden("method not allowed"))
+			return
+		}
+		header.Set("Access-Control-Allow-Methods", methods)
+		header.Set("Access-Control-Allow-Headers", headers)
+		if config.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.FormatInt(int64(config.MaxAge.Seconds()), 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allows reports whether the origin may use the API and whether it is allowed only through "*"
+func (config CORSConfig) allows(origin string) (bool, bool) {
+	wildcard := false
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == origin {
+			return true, false
+		}
+		wildcard = wildcard || allowed == "*"
+	}
+	return wildcard, wildcard
+}
+
+func containsFold(list []string, value string) bool {
+	for _, elem := range list {
+		if strings.EqualFold(elem, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	config := DefaultCORSConfig("https://client.example")
+	config.AllowCredentials = true
+	reached := 0
+	handler := CORS(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached++
+	}))
+	serve := func(method, origin, requestMethod string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/posts/", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if requestMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", requestMethod)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	recorder := serve("OPTIONS", "https://client.example", "DELETE")
+	if recorder.Code != http.StatusNoContent || reached != 0 {
+		t.Fatalf("preflight got %d and reached the handler %d times", recorder.Code, reached)
+	}
+	for name, expected := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://client.example",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST, PUT, DELETE",
+		"Access-Control-Max-Age":           "600",
+		"Vary":                             "Origin",
+	} {
+		if got := recorder.Header().Get(name); got != expected {
+			t.Errorf("preflight %s: got %q, expected %q", name, got, expected)
+		}
+	}
+	if recorder = serve("OPTIONS", "https://client.example", "PATCH"); recorder.Code != http.StatusForbidden {
+		t.Errorf("preflight of a method not allowed got %d", recorder.Code)
+	}
+	if recorder = serve("OPTIONS", "https://evil.example", "GET"); recorder.Code != http.StatusForbidden {
+		t.Errorf("preflight of an unknown origin got %d", recorder.Code)
+	}
+
+	recorder = serve("GET", "https://client.example", "")
+	if reached != 1 || recorder.Header().Get("Access-Control-Allow-Origin") != "https://client.example" {
+		t.Errorf("simple request: reached %d, headers %v", reached, recorder.Header())
+	}
+	if recorder.Header().Get("Access-Control-Expose-Headers") != "ETag, Last-Modified" {
+		t.Errorf("got exposed headers %q", recorder.Header().Get("Access-Control-Expose-Headers"))
+	}
+	recorder = serve("GET", "https://evil.example", "")
+	if reached != 2 || recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("unknown origin: reached %d, headers %v", reached, recorder.Header())
+	}
+	recorder = serve("GET", "", "")
+	if reached != 3 || recorder.Header().Get("Vary") != "" {
+		t.Errorf("same origin request: reached %d, headers %v", reached, recorder.Header())
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	config := DefaultCORSConfig("*")
+	config.AllowCredentials = true
+	handler := CORS(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest("GET", "/api/posts/", nil)
+	req.Header.Set("Origin", "https://anyone.example")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("got allowed origin %q, expected *", got)
+	}
+	if got := recorder.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("credentials are allowed for any origin: %q", got)
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"redditclone/pkg/apierr"
+)
+
+type CSRFConfig struct {
+	// CookieName holds the token, it is readable by scripts so they can copy it into HeaderName
+	CookieName string
+	HeaderName string
+	// SessionCookie authenticates requests, only requests carrying it are checked
+	SessionCookie string
+}
+
+func DefaultCSRFConfig(sessionCookie string) CSRFConfig {
+	return CSRFConfig{
+		CookieName:    "csrf_token",
+		HeaderName:    "X-CSRF-Token",
+		SessionCookie: sessionCookie,
+	}
+}
+
+// CSRF is a double submit check: another site can make the browser send cookies but can not read
+// the token to put it into the header. Bearer tokens are never sent by the browser on its own,
+// requests without the session cookie pass as they are.
+func CSRF(config CSRFConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		csrfToken := ""
+		if cookie, errCookie := r.Cookie(config.CookieName); errCookie == nil {
+			csrfToken = cookie.Value
+		}
+		if csrfToken == "" {
+			fresh, errToken := newCSRFToken()
+			if errToken != nil {
+				apierr.Write(w, apierr.Internal("error in creating csrf token", errToken))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     config.CookieName,
+				Value:    fresh,
+				Path:     "/",
+				Secure:   isHTTPS(r),
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, errSession := r.Cookie(config.SessionCookie); errSession != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sent := r.Header.Get(config.HeaderName)
+		if csrfToken == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(csrfToken)) != 1 {
+			apierr.Write(w, apierr.Forbidden("bad csrf token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newCSRFToken() (string, error) {
+	raw := make([]byte, 32)
+	_, errRand := rand.Read(raw)
+	if errRand != nil {
+		return "", errRand
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	config := DefaultCSRFConfig("session")
+	handler := CSRF(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(method string, cookies []*http.Cookie, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/posts", nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		if header != "" {
+			req.Header.Set(config.HeaderName, header)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	issued := serve("GET", nil, "").Result().Cookies()
+	if len(issued) != 1 || issued[0].Name != config.CookieName || issued[0].Value == "" || issued[0].HttpOnly {
+		t.Fatalf("got cookies %v, expected a readable csrf cookie", issued)
+	}
+	csrfCookie := issued[0]
+	if again := serve("GET", []*http.Cookie{csrfCookie}, "").Result().Cookies(); len(again) != 0 {
+		t.Errorf("token is issued again: %v", again)
+	}
+
+	sessionCookie := &http.Cookie{Name: "session", Value: "sess"}
+	cases := []struct {
+		name    string
+		cookies []*http.Cookie
+		header  string
+		status  int
+	}{
+		{"bearer request", nil, "", http.StatusOK},
+		{"no header", []*http.Cookie{sessionCookie, csrfCookie}, "", http.StatusForbidden},
+		{"wrong header", []*http.Cookie{sessionCookie, csrfCookie}, "forged", http.StatusForbidden},
+		{"no csrf cookie", []*http.Cookie{sessionCookie}, csrfCookie.Value, http.StatusForbidden},
+		{"matching", []*http.Cookie{sessionCookie, csrfCookie}, csrfCookie.Value, http.StatusOK},
+	}
+	for _, tc := range cases {
+		if recorder := serve("POST", tc.cookies, tc.header); recorder.Code != tc.status {
+			t.Errorf("%s: got %d, expected %d", tc.name, recorder.Code, tc.status)
+		}
+	}
+}
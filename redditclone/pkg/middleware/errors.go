@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+)
+
+// Errors is the only place where errors of handlers become responses
+func Errors(logger *zap.SugaredLogger, next apierr.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		errHandler := next(w, r)
+		if errHandler == nil {
+			return
+		}
+		if apierr.From(errHandler).Status >= http.StatusInternalServerError {
+			logger.Errorw("Error in handler", "url", r.URL.Path, "err", errHandler)
+		}
+		errWrite := apierr.Write(w, errHandler)
+		if errWrite != nil {
+			logger.Infow("Error in write resp", errWrite)
+		}
+	})
+}
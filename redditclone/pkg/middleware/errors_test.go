@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"redditclone/pkg/apierr"
+)
+
+func TestErrorsEnvelope(t *testing.T) {
+	cases := []struct {
+		name    string
+		err     error
+		status  int
+		message string
+		fields  int
+	}{
+		{"not found", apierr.NotFound("post not found"), http.StatusNotFound, "post not found", 0},
+		{"validation", apierr.Validation(apierr.Field{Location: "body", Param: "title", Msg: "is required"}),
+			http.StatusUnprocessableEntity, "validation failed", 1},
+		{"wrapped", fmt.Errorf("in handler: %w", apierr.Forbidden("admins only")), http.StatusForbidden, "admins only", 0},
+		{"untyped", errors.New("disk is on fire"), http.StatusInternalServerError, "internal server error", 0},
+	}
+	for _, tc := range cases {
+		handler := Errors(zap.NewNop().Sugar(), func(w http.ResponseWriter, r *http.Request) error {
+			return tc.err
+		})
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+		checkEnvelope(t, tc.name, recorder, tc.status, tc.message)
+		var body apierr.Envelope
+		json.Unmarshal(recorder.Body.Bytes(), &body)
+		if len(body.Errors) != tc.fields {
+			t.Errorf("%s: got %d fields, expected %d", tc.name, len(body.Errors), tc.fields)
+		}
+	}
+}
+
+func TestPanicEnvelope(t *testing.T) {
+	handler := Panic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	checkEnvelope(t, "panic", recorder, http.StatusInternalServerError, "internal server error")
+}
+
+func checkEnvelope(t *testing.T, name string, recorder *httptest.ResponseRecorder, status int, message string) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Errorf("%s: got status %d, expected %d", name, recorder.Code, status)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("%s: got content type %q", name, contentType)
+	}
+	var body apierr.Envelope
+	if errUnmarsh := json.Unmarshal(recorder.Body.Bytes(), &body); errUnmarsh != nil {
+		t.Fatalf("%s: body is not one json object: %q", name, recorder.Body.String())
+	}
+	if body.Status != status || body.Message != message {
+		t.Errorf("%s: got %+v, expected %d %q", name, body, status, message)
+	}
+}
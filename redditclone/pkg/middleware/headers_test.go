@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	page := []byte("<html><script>boot()</script><script src=\"/static/js/main.js\"></script></html>")
+	config := DefaultSecurityConfig(page)
+	// sha256 of "boot()"
+	if !strings.Contains(config.ContentSecurityPolicy, "'sha256-MeZS89WlF0u+o0hCvHTBt4q1WHU+U+sJKgbdRUc36mY='") {
+		t.Errorf("inline script is not allowed by hash: %s", config.ContentSecurityPolicy)
+	}
+	handler := SecurityHeaders(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	for name, expected := range map[string]string{
+		"Content-Security-Policy": config.ContentSecurityPolicy,
+		"X-Frame-Options":         "DENY",
+		"X-Content-Type-Options":  "nosniff",
+		"Referrer-Policy":         "strict-origin-when-cross-origin",
+	} {
+		if got := recorder.Header().Get(name); got != expected {
+			t.Errorf("%s: got %q, expected %q", name, got, expected)
+		}
+	}
+	if hsts := recorder.Header().Get("Strict-Transport-Security"); hsts != "" {
+		t.Errorf("hsts is sent over plain http: %q", hsts)
+	}
+
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	handler.ServeHTTP(recorder, req)
+	if hsts := recorder.Header().Get("Strict-Transport-Security"); hsts != "max-age=15552000; includeSubDomains" {
+		t.Errorf("got hsts %q over https", hsts)
+	}
+}
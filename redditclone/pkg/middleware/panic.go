@@ -3,6 +3,8 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+
+	"redditclone/pkg/apierr"
 )
 
 func Panic(next http.Handler) http.Handler {
@@ -11,7 +13,7 @@ func Panic(next http.Handler) http.Handler {
 		defer func() {
 			if err := recover(); err != nil {
 				fmt.Println("recovered", err)
-				http.Error(w, "Internal server error", 500)
+				apierr.Write(w, apierr.Internal("internal server error", fmt.Errorf("panic: %v", err)))
 			}
 		}()
 		next.ServeHTTP(w, r)
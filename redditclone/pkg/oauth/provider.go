@@ -0,0 +1,184 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoCode    = errors.New("no authorization code")
+	ErrNoToken   = errors.New("provider returned no access token")
+	ErrNoSubject = errors.New("provider returned no subject")
+)
+
+// Provider is a generic OAuth2 authorization code flow with an OIDC style userinfo endpoint
+type Provider struct {
+	Name         string   `json:"name"`
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	AuthURL      string   `json:"authUrl"`
+	TokenURL     string   `json:"tokenUrl"`
+	UserInfoURL  string   `json:"userInfoUrl"`
+	RedirectURL  string   `json:"redirectUrl"`
+	Scopes       []string `json:"scopes"`
+	// LoginClaim names the userinfo claim used as the local login, preferred_username by default
+	LoginClaim string `json:"loginClaim"`
+
+	Client *http.Client `json:"-"`
+}
+
+type Identity struct {
+	Provider string
+	Subject  string
+	Login    string
+}
+
+func LoadProviders(path string) (map[string]*Provider, error) {
+	data, errRead := os.ReadFile(path)
+	if errRead != nil {
+		return nil, errRead
+	}
+	list := make([]*Provider, 0)
+	errUnmarsh := json.Unmarshal(data, &list)
+	if errUnmarsh != nil {
+		return nil, errUnmarsh
+	}
+	providers := make(map[string]*Provider, len(list))
+	for _, provider := range list {
+		if provider.Name == "" {
+			return nil, fmt.Errorf("provider without name")
+		}
+		providers[provider.Name] = provider
+	}
+	return providers, nil
+}
+
+func (p *Provider) AuthCodeURL(state string) string {
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.ClientID},
+		"redirect_uri":  {p.RedirectURL},
+		"scope":         {strings.Join(p.scopes(), " ")},
+		"state":         {state},
+	}
+	separator := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.AuthURL + separator + params.Encode()
+}
+
+// Exchange trades the authorization code for an access token
+func (p *Provider) Exchange(ctx context.Context, code string) (string, error) {
+	if code == "" {
+		return "", ErrNoCode
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	}
+	req, errReq := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if errReq != nil {
+		return "", errReq
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	payload := struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}{}
+	errDo := p.do(req, &payload)
+	if errDo != nil {
+		return "", errDo
+	}
+	if payload.Error != "" {
+		return "", fmt.Errorf("token endpoint: %s", payload.Error)
+	}
+	if payload.AccessToken == "" {
+		return "", ErrNoToken
+	}
+	return payload.AccessToken, nil
+}
+
+func (p *Provider) UserInfo(ctx context.Context, accessToken string) (Identity, error) {
+	req, errReq := http.NewRequestWithContext(ctx, http.MethodGet, p.UserInfoURL, nil)
+	if errReq != nil {
+		return Identity{}, errReq
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	claims := make(map[string]interface{})
+	errDo := p.do(req, &claims)
+	if errDo != nil {
+		return Identity{}, errDo
+	}
+	subject := claimString(claims["sub"])
+	if subject == "" {
+		return Identity{}, ErrNoSubject
+	}
+	loginClaim := p.LoginClaim
+	if loginClaim == "" {
+		loginClaim = "preferred_username"
+	}
+	login := claimString(claims[loginClaim])
+	if login == "" {
+		login = subject
+	}
+	return Identity{
+		Provider: p.Name,
+		Subject:  subject,
+		Login:    login,
+	}, nil
+}
+
+func (p *Provider) do(req *http.Request, dst interface{}) error {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, errDo := client.Do(req)
+	if errDo != nil {
+		return errDo
+	}
+	defer resp.Body.Close()
+	body, errRead := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if errRead != nil {
+		return errRead
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %d", req.URL.Path, resp.StatusCode)
+	}
+	return json.Unmarshal(body, dst)
+}
+
+func (p *Provider) scopes() []string {
+	if len(p.Scopes) == 0 {
+		return []string{"openid", "profile"}
+	}
+	return p.Scopes
+}
+
+// claimString accepts numeric subjects, some providers send ids as numbers
+func claimString(claim interface{}) string {
+	switch value := claim.(type) {
+	case string:
+		return value
+	case float64:
+		return fmt.Sprintf("%.0f", value)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,168 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+const (
+	mockClientID     = "client"
+	mockClientSecret = "secret"
+	mockCode         = "code123"
+	mockAccessToken  = "access123"
+	mockRedirectURL  = "http://localhost:8020/api/oauth/mock/callback"
+)
+
+// newMockIdP serves a minimal authorization server: /authorize redirects straight back with a code
+func newMockIdP() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("client_id") != mockClientID || query.Get("response_type") != "code" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		redirect := query.Get("redirect_uri") + "?" + url.Values{
+			"code":  {mockCode},
+			"state": {query.Get("state")},
+		}.Encode()
+		http.Redirect(w, r, redirect, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("client_secret") != mockClientSecret || r.PostForm.Get("redirect_uri") != mockRedirectURL {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.PostForm.Get("code") != mockCode {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": mockAccessToken,
+			"token_type":   "Bearer",
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+mockAccessToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":                42,
+			"preferred_username": "alice",
+		})
+	})
+	return httptest.NewServer(mux)
+}
+
+func newMockProvider(idp *httptest.Server) *Provider {
+	return &Provider{
+		Name:         "mock",
+		ClientID:     mockClientID,
+		ClientSecret: mockClientSecret,
+		AuthURL:      idp.URL + "/authorize",
+		TokenURL:     idp.URL + "/token",
+		UserInfoURL:  idp.URL + "/userinfo",
+		RedirectURL:  mockRedirectURL,
+		Client:       idp.Client(),
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := newMockIdP()
+	defer idp.Close()
+	provider := newMockProvider(idp)
+	states := NewStateStore(kv.NewMemoryStore(), time.Minute)
+
+	state, err := states.New(provider.Name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(provider.AuthCodeURL(state))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !states.Consume(provider.Name, callback.Query().Get("state")) {
+		t.Fatalf("state was not accepted")
+	}
+	if states.Consume(provider.Name, state) {
+		t.Errorf("state was accepted twice")
+	}
+	accessToken, err := provider.Exchange(context.Background(), callback.Query().Get("code"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	identity, err := provider.UserInfo(context.Background(), accessToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := Identity{Provider: "mock", Subject: "42", Login: "alice"}
+	if identity != expected {
+		t.Errorf("got %+v, expected %+v", identity, expected)
+	}
+}
+
+func TestExchangeErrors(t *testing.T) {
+	idp := newMockIdP()
+	defer idp.Close()
+	provider := newMockProvider(idp)
+
+	if _, err := provider.Exchange(context.Background(), ""); err != ErrNoCode {
+		t.Errorf("expected ErrNoCode, got %v", err)
+	}
+	if _, err := provider.Exchange(context.Background(), "wrong"); err == nil {
+		t.Errorf("expected error for invalid code")
+	}
+	provider.ClientSecret = "wrong"
+	if _, err := provider.Exchange(context.Background(), mockCode); err == nil {
+		t.Errorf("expected error for bad client secret")
+	}
+	if _, err := provider.UserInfo(context.Background(), "wrong"); err == nil {
+		t.Errorf("expected error for bad access token")
+	}
+}
+
+func TestStateStore(t *testing.T) {
+	states := NewStateStore(kv.NewMemoryStore(), time.Minute)
+	state, err := states.New("mock")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if states.Consume("other", state) {
+		t.Errorf("state of another provider was accepted")
+	}
+	if states.Consume("mock", state) {
+		t.Errorf("state was accepted after a failed attempt")
+	}
+
+	expired := NewStateStore(kv.NewMemoryStore(), -time.Second)
+	state, err = expired.New("mock")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expired.Consume("mock", state) {
+		t.Errorf("expired state was accepted")
+	}
+}
@@ -0,0 +1,53 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+const statePrefix = "oauth:state:"
+
+// StateStore remembers issued state values so every callback is used once and only within TTL.
+// The callback may reach another instance than the login, so states live in the shared store.
+type StateStore struct {
+	TTL   time.Duration
+	store kv.Store
+}
+
+func NewStateStore(store kv.Store, ttl time.Duration) *StateStore {
+	return &StateStore{
+		TTL:   ttl,
+		store: store,
+	}
+}
+
+func (s *StateStore) New(provider string) (string, error) {
+	raw := make([]byte, 16)
+	_, errRand := rand.Read(raw)
+	if errRand != nil {
+		return "", errRand
+	}
+	state := hex.EncodeToString(raw)
+	// the store drops the key after TTL, the deadline in the value guards stores that lag behind
+	expires := time.Now().Add(s.TTL).UnixNano()
+	errSet := s.store.Set(statePrefix+state, provider+" "+strconv.FormatInt(expires, 10), s.TTL)
+	if errSet != nil {
+		return "", errSet
+	}
+	return state, nil
+}
+
+func (s *StateStore) Consume(provider string, state string) bool {
+	value, errGet := s.store.GetDel(statePrefix + state)
+	if errGet != nil {
+		return false
+	}
+	issuedFor, deadline, _ := strings.Cut(value, " ")
+	expires, errParse := strconv.ParseInt(deadline, 10, 64)
+	return errParse == nil && issuedFor == provider && time.Now().UnixNano() < expires
+}
@@ -0,0 +1,88 @@
+package post
+
+import (
+	"sort"
+
+	"redditclone/pkg/comment"
+)
+
+// Inconsistency describes a post whose stored comment count does not match CommentRepo,
+// or comments left behind by a post that no longer exists (Orphaned)
+type Inconsistency struct {
+	PostID       string `json:"postId"`
+	CommentCount int    `json:"commentCount"`
+	Comments     int    `json:"comments"`
+	Orphaned     bool   `json:"orphaned"`
+	Fixed        bool   `json:"fixed"`
+}
+
+// CheckComments compares posts against CommentRepo, which is the source of truth for comments.
+// With fix set counts are overwritten and orphaned comments are deleted.
+func CheckComments(posts PostRepo, comments comment.CommentRepo, fix bool) ([]Inconsistency, error) {
+	allPosts, errPosts := posts.GetAllPosts()
+	if errPosts != nil {
+		return nil, errPosts
+	}
+	existing := make(map[string]bool, len(allPosts))
+	found := make([]Inconsistency, 0)
+	for _, item := range allPosts {
+		existing[item.ID] = true
+		postComments, errComments := comments.GetAll(item.ID)
+		if errComments != nil {
+			return nil, errComments
+		}
+		if item.CommentCount == len(postComments) {
+			continue
+		}
+		problem := Inconsistency{
+			PostID:       item.ID,
+			CommentCount: item.CommentCount,
+			Comments:     len(postComments),
+		}
+		if fix {
+			_, errFix := posts.Update(item.ID, item.Version, func(post *Post) error {
+				post.CommentCount = len(postComments)
+				return nil
+			})
+			// a concurrent change is left for the next run
+			if errFix != nil && errFix != ErrConflict && errFix != ErrNoPost {
+				return nil, errFix
+			}
+			problem.Fixed = errFix == nil
+		}
+		found = append(found, problem)
+	}
+
+	postIDs, errIDs := comments.GetPostIDs()
+	if errIDs != nil {
+		return nil, errIDs
+	}
+	sort.Strings(postIDs)
+	for _, postID := range postIDs {
+		if existing[postID] {
+			continue
+		}
+		orphans, errComments := comments.GetAll(postID)
+		if errComments != nil {
+			return nil, errComments
+		}
+		if len(orphans) == 0 {
+			continue
+		}
+		// the post may have been created after the listing above
+		if _, errGet := posts.Get(postID); errGet == nil {
+			continue
+		}
+		problem := Inconsistency{
+			PostID:   postID,
+			Comments: len(orphans),
+			Orphaned: true,
+		}
+		if fix {
+			comments.DeleteAll(postID)
+			problem.Fixed = true
+		}
+		found = append(found, problem)
+	}
+	return found, nil
+}
@@ -0,0 +1,56 @@
+package post
+
+import (
+	"testing"
+
+	"redditclone/pkg/comment"
+	"redditclone/pkg/user"
+)
+
+func TestCheckComments(t *testing.T) {
+	posts := NewMemoryRepo()
+	comments := comment.NewMemoryRepo()
+	author := &user.User{ID: "author", Login: "author"}
+
+	synced := newTestPost(t, posts)
+	drifted := newTestPost(t, posts)
+	for _, postID := range []string{synced.ID, drifted.ID, drifted.ID, "deleted"} {
+		if _, err := comments.Create("text", author, postID, false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := posts.AddCommentCount(synced.ID, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := posts.AddCommentCount(drifted.ID, 5); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	found, err := CheckComments(posts, comments, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Inconsistency{
+		{PostID: drifted.ID, CommentCount: 5, Comments: 2},
+		{PostID: "deleted", Comments: 1, Orphaned: true},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("got %+v, expected %+v", found, expected)
+	}
+	for i := range expected {
+		if found[i] != expected[i] {
+			t.Errorf("got %+v, expected %+v", found[i], expected[i])
+		}
+	}
+
+	if _, err = CheckComments(posts, comments, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	found, err = CheckComments(posts, comments, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(found) != 0 {
+		t.Errorf("inconsistencies left after fix: %+v", found)
+	}
+}
@@ -0,0 +1,71 @@
+package post
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	MaxTags   = 5
+	MaxTagLen = 32
+)
+
+var ErrBadTag = errors.New("bad tag")
+
+type ListFilter struct {
+	Flair    string
+	Tag      string
+	ShowNSFW bool
+	// Viewer still sees own shadow hidden and scheduled posts
+	Viewer string
+}
+
+func (f ListFilter) Apply(posts []Post) []Post {
+	suitablePosts := make([]Post, 0, len(posts))
+	for _, post := range posts {
+		if !post.ShownTo(f.Viewer) {
+			continue
+		}
+		if post.NSFW && !f.ShowNSFW {
+			continue
+		}
+		if f.Flair != "" && post.Flair != f.Flair {
+			continue
+		}
+		if f.Tag != "" && !post.HasTag(f.Tag) {
+			continue
+		}
+		suitablePosts = append(suitablePosts, post)
+	}
+	return suitablePosts
+}
+
+func (p Post) HasTag(tag string) bool {
+	tag = strings.ToLower(tag)
+	for _, item := range p.Tags {
+		if item == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeTags lowercases, trims and dedups tags keeping the original order
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > MaxTagLen || strings.ContainsAny(tag, " \t\n") {
+			return nil, ErrBadTag
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > MaxTags {
+		return nil, ErrBadTag
+	}
+	return normalized, nil
+}
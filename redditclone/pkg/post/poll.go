@@ -0,0 +1,156 @@
+package post
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	TypePoll         = "poll"
+	MinPollOptions   = 2
+	MaxPollOptions   = 10
+	MaxPollOptionLen = 200
+)
+
+var (
+	ErrNotPoll       = errors.New("post is not a poll")
+	ErrPollClosed    = errors.New("poll is closed")
+	ErrAlreadyVoted  = errors.New("already voted in this poll")
+	ErrBadPollOption = errors.New("no such poll option")
+	ErrBadPoll       = errors.New("poll needs 2 to 10 distinct options")
+)
+
+type PollOption struct {
+	Text  string `json:"text"`
+	votes int
+}
+
+// Poll carries no counts in JSON, results are shown through PollResults only
+type Poll struct {
+	Options  []PollOption `json:"options"`
+	ClosesAt string       `json:"closesAt,omitempty"`
+	Closed   bool         `json:"closed"`
+	// ballots maps user ids to the chosen option
+	ballots map[string]int
+}
+
+type PollOptionResult struct {
+	Text  string `json:"text"`
+	Votes *int   `json:"votes,omitempty"`
+}
+
+type PollResults struct {
+	Closed  bool               `json:"closed"`
+	Voted   bool               `json:"voted"`
+	Choice  *int               `json:"choice,omitempty"`
+	Total   *int               `json:"total,omitempty"`
+	Options []PollOptionResult `json:"options"`
+}
+
+// NewPoll validates the options given by the author, the closing time must be in the future
+func NewPoll(options []string, closesAt string, now time.Time) (*Poll, error) {
+	if len(options) < MinPollOptions || len(options) > MaxPollOptions {
+		return nil, ErrBadPoll
+	}
+	poll := &Poll{
+		Options: make([]PollOption, 0, len(options)),
+		ballots: make(map[string]int),
+	}
+	seen := make(map[string]bool, len(options))
+	for _, text := range options {
+		text = strings.TrimSpace(text)
+		key := strings.ToLower(text)
+		if text == "" || len(text) > MaxPollOptionLen || seen[key] {
+			return nil, ErrBadPoll
+		}
+		seen[key] = true
+		poll.Options = append(poll.Options, PollOption{Text: text})
+	}
+	if closesAt != "" {
+		parsed, errParse := time.Parse(time.RFC3339, closesAt)
+		if errParse != nil || !parsed.After(now) {
+			return nil, ErrPollClosed
+		}
+		poll.ClosesAt = parsed.UTC().Format(time.RFC3339)
+	}
+	return poll, nil
+}
+
+// IsClosed does not wait for the scheduler to mark the poll closed
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.Closed || due(p.ClosesAt, now)
+}
+
+// CastPollVote records the single vote of the user, votes cant be changed
+func CastPollVote(post *Post, userID string, option int, now time.Time) error {
+	poll := post.Poll
+	switch {
+	case poll == nil:
+		return ErrNotPoll
+	case !post.CanVote() || poll.IsClosed(now):
+		return ErrPollClosed
+	case option < 0 || option >= len(poll.Options):
+		return ErrBadPollOption
+	}
+	if _, voted := poll.ballots[userID]; voted {
+		return ErrAlreadyVoted
+	}
+	if poll.ballots == nil {
+		poll.ballots = make(map[string]int)
+	}
+	poll.ballots[userID] = option
+	poll.Options[option].votes++
+	return nil
+}
+
+// Results shows the counts to users who voted and to everybody once the poll is closed
+func (p *Poll) Results(userID string, now time.Time) PollResults {
+	choice, voted := p.ballots[userID]
+	results := PollResults{
+		Closed:  p.IsClosed(now),
+		Voted:   voted,
+		Options: make([]PollOptionResult, 0, len(p.Options)),
+	}
+	visible := voted || results.Closed
+	if voted {
+		results.Choice = &choice
+	}
+	total := 0
+	for _, option := range p.Options {
+		item := PollOptionResult{Text: option.Text}
+		if visible {
+			votes := option.votes
+			item.Votes = &votes
+		}
+		total += option.votes
+		results.Options = append(results.Options, item)
+	}
+	if visible {
+		results.Total = &total
+	}
+	return results
+}
+
+func (p *Poll) removeBallot(userID string) bool {
+	option, voted := p.ballots[userID]
+	if !voted {
+		return false
+	}
+	delete(p.ballots, userID)
+	p.Options[option].votes--
+	return true
+}
+
+func (p *Poll) clone() *Poll {
+	if p == nil {
+		return nil
+	}
+	copied := *p
+	copied.Options = append(make([]PollOption, 0, len(p.Options)), p.Options...)
+	copied.ballots = make(map[string]int, len(p.ballots))
+	for userID, option := range p.ballots {
+		copied.ballots[userID] = option
+	}
+	return &copied
+}
@@ -0,0 +1,133 @@
+package post
+
+import (
+	"testing"
+	"time"
+
+	"redditclone/pkg/clock"
+	"redditclone/pkg/user"
+)
+
+func newTestPoll(t *testing.T, repo *PostMemoryRepository, now time.Time, closesAt string) Post {
+	t.Helper()
+	poll, err := NewPoll([]string{"yes", "no", "maybe"}, closesAt, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created, err := repo.Create(Post{
+		Author:   user.User{ID: "author", Login: "author"},
+		Category: "news",
+		Title:    "question",
+		Type:     TypePoll,
+		Poll:     poll,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return created
+}
+
+func TestNewPollValidation(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		options  []string
+		closesAt string
+		err      error
+	}{
+		{[]string{"one"}, "", ErrBadPoll},
+		{[]string{"one", " One "}, "", ErrBadPoll},
+		{[]string{"one", ""}, "", ErrBadPoll},
+		{[]string{"one", "two"}, now.Add(-time.Minute).Format(time.RFC3339), ErrPollClosed},
+		{[]string{"one", "two"}, "tomorrow", ErrPollClosed},
+		{[]string{"one", "two"}, now.Add(time.Hour).Format(time.RFC3339), nil},
+	}
+	for _, item := range cases {
+		if _, err := NewPoll(item.options, item.closesAt, now); err != item.err {
+			t.Errorf("NewPoll(%q, %q) = %v, expected %v", item.options, item.closesAt, err, item.err)
+		}
+	}
+}
+
+func TestPollVoting(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := NewMemoryRepo()
+	poll := newTestPoll(t, repo, now, "")
+	vote := func(userID string, option int) error {
+		_, err := repo.Update(poll.ID, AnyVersion, func(item *Post) error {
+			return CastPollVote(item, userID, option, now)
+		})
+		return err
+	}
+
+	results := poll.Poll.Results("voter", now)
+	if results.Voted || results.Total != nil || results.Options[0].Votes != nil {
+		t.Errorf("results are shown before voting: %+v", results)
+	}
+	if err := vote("voter", 3); err != ErrBadPollOption {
+		t.Errorf("expected ErrBadPollOption, got %v", err)
+	}
+	if err := vote("voter", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := vote("voter", 0); err != ErrAlreadyVoted {
+		t.Errorf("expected ErrAlreadyVoted, got %v", err)
+	}
+	if err := vote("other", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stored, _ := repo.Get(poll.ID)
+	results = stored.Poll.Results("voter", now)
+	if !results.Voted || *results.Choice != 1 || *results.Total != 2 || *results.Options[1].Votes != 2 {
+		t.Errorf("unexpected results: %+v", results)
+	}
+	if hidden := stored.Poll.Results("lurker", now); hidden.Total != nil {
+		t.Errorf("results are shown to a user who did not vote")
+	}
+
+	if _, err := repo.RemoveVotes("other"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stored, _ = repo.Get(poll.ID)
+	if results = stored.Poll.Results("voter", now); *results.Total != 1 {
+		t.Errorf("ballot was not removed, total %d", *results.Total)
+	}
+
+	if _, err := repo.Update(poll.ID, AnyVersion, func(item *Post) error {
+		return CastPollVote(&Post{}, "voter", 0, now)
+	}); err != ErrNotPoll {
+		t.Errorf("expected ErrNotPoll, got %v", err)
+	}
+}
+
+func TestPollClosing(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	repo := NewMemoryRepo()
+	poll := newTestPoll(t, repo, start, start.Add(time.Hour).Format(time.RFC3339))
+	if pending, _ := repo.GetScheduled(); len(pending) != 1 {
+		t.Fatalf("poll with a closing time is not scheduled")
+	}
+
+	clk.Advance(time.Hour)
+	if _, _, err := NewScheduler(repo, clk).Tick(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stored, _ := repo.Get(poll.ID)
+	if !stored.Poll.Closed {
+		t.Errorf("poll was not closed")
+	}
+	results := stored.Poll.Results("lurker", clk.Now())
+	if !results.Closed || results.Total == nil || *results.Total != 0 {
+		t.Errorf("results of a closed poll are hidden: %+v", results)
+	}
+	_, err := repo.Update(poll.ID, AnyVersion, func(item *Post) error {
+		return CastPollVote(item, "late", 0, clk.Now())
+	})
+	if err != ErrPollClosed {
+		t.Errorf("expected ErrPollClosed, got %v", err)
+	}
+	if pending, _ := repo.GetScheduled(); len(pending) != 0 {
+		t.Errorf("closed poll is still scheduled")
+	}
+}
@@ -1,40 +1,157 @@
 package post
 
 import (
+	"crypto/sha1"
+	"fmt"
+	"time"
+
 	"redditclone/pkg/comment"
 	"redditclone/pkg/user"
 )
 
 type Votes struct {
-	User string `json:"user"`
-	Vote int    `json:"vote"`
+	User    string `json:"user"`
+	Vote    int    `json:"vote"`
+	Created string `json:"created,omitempty"`
 }
 
 type Post struct {
+	Archived         bool               `json:"archived"`
 	Author           user.User          `json:"author"`
 	Category         string             `json:"category"`
 	Comments         []*comment.Comment `json:"comments"`
+	CommentCount     int                `json:"commentCount"`
 	Created          string             `json:"created"`
+	CrosspostParent  string             `json:"crosspostParent,omitempty"`
+	ExpiresAt        string             `json:"expiresAt,omitempty"`
+	Flair            string             `json:"flair,omitempty"`
+	Hidden           bool               `json:"-"`
 	ID               string             `json:"id"`
+	Locked           bool               `json:"locked"`
+	NSFW             bool               `json:"nsfw"`
+	Pinned           bool               `json:"pinned"`
+	Poll             *Poll              `json:"poll,omitempty"`
+	PublishAt        string             `json:"publishAt,omitempty"`
+	Scheduled        bool               `json:"scheduled,omitempty"`
 	Score            int                `json:"score"`
+	Spoiler          bool               `json:"spoiler"`
+	Tags             []string           `json:"tags"`
 	Text             string             `json:"text,omitempty"`
+	TextHTML         string             `json:"textHtml,omitempty"`
 	URL              string             `json:"url,omitempty"`
 	Title            string             `json:"title"`
+	TotalViews       int                `json:"-"`
 	Type             string             `json:"type"`
 	UpvotePercentage int                `json:"upvotePercentage"`
+	Version          uint64             `json:"-"`
 	Views            int                `json:"views"`
 	Votes            []*Votes           `json:"votes"`
+
+	// seq keeps listings in creation order
+	seq uint64
 }
 
 type PostRepo interface {
 	Get(postID string) (Post, error)
-	GetPost(postID string) (Post, error)
 	GetCategory(category string) ([]Post, error)
 	GetAllPosts() ([]Post, error)
 	GetUserPosts(userLogin string) ([]Post, error)
+	// GetByAuthors groups the posts of several users by login in one call
+	GetByAuthors(userLogins []string) (map[string][]Post, error)
+	GetByURL(rawURL string) ([]Post, error)
 	UpdateVote(vote int, postID string, author *user.User) (Post, error)
 	Create(post Post) (Post, error)
-	AddComment(currpost Post, currComment *comment.Comment) (Post, error)
+	Update(postID string, version uint64, fn func(post *Post) error) (Post, error)
+	AddCommentCount(postID string, delta int) (Post, error)
+	// Anonymize hands the posts of the user over to the deleted placeholder, text bodies are wiped
+	Anonymize(userLogin string) (int, error)
+	RemoveVotes(userID string) (int, error)
 	Delete(postID string) (bool, error)
-	DeleteComment(delCommentID int, postID string) (Post, error)
+	// GetScheduled lists posts waiting to be published or archived
+	GetScheduled() ([]Post, error)
+	// AddViews counts views apart from the content, it does not change the revision.
+	// Views shown to everyone are the unique ones, the total is for the author.
+	AddViews(postID string, unique, total int) error
+	// Revision grows with every change of the stored posts, modified is the time of the last change
+	Revision() (revision uint64, modified time.Time)
+}
+
+// ETag changes whenever the score or any of the votes of the post change
+func (p Post) ETag() string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%s:%d", p.ID, p.Score)
+	for _, vote := range p.Votes {
+		fmt.Fprintf(hash, ";%s=%d", vote.User, vote.Vote)
+	}
+	return fmt.Sprintf(`"%x"`, hash.Sum(nil))
+}
+
+// VotesSince counts votes cast or changed after the given moment, a spike means possible brigading
+func (p Post) VotesSince(since time.Time) int {
+	count := 0
+	for _, vote := range p.Votes {
+		created, errParse := time.Parse(time.RFC3339, vote.Created)
+		if errParse == nil && !created.Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+// WithComments fills in the comments the post does not store itself
+func (p Post) WithComments(comments []*comment.Comment) Post {
+	p.Comments = comments
+	p.CommentCount = len(comments)
+	return p
+}
+
+// ShownTo hides shadow hidden and not yet published posts from everybody but the author
+func (p Post) ShownTo(login string) bool {
+	return (!p.Hidden && !p.Scheduled) || p.Author.Login == login
+}
+
+// pendingTransition tells whether the scheduler still has work to do on the post
+func (p Post) pendingTransition() bool {
+	return p.Scheduled || (p.ExpiresAt != "" && !p.Archived) || (p.Poll != nil && p.Poll.ClosesAt != "" && !p.Poll.Closed)
+}
+
+// VisibleTo drops shadow hidden comments of everybody but the viewer
+func (p Post) VisibleTo(login string) Post {
+	visible := make([]*comment.Comment, 0, len(p.Comments))
+	for _, item := range p.Comments {
+		if !item.Hidden || item.Author.Login == login {
+			visible = append(visible, item)
+		}
+	}
+	p.CommentCount -= len(p.Comments) - len(visible)
+	p.Comments = visible
+	return p
+}
+
+// votedBy tells whether the user has a vote on the post or a ballot in its poll
+func (p Post) votedBy(userID string) bool {
+	for _, vote := range p.Votes {
+		if vote.User == userID {
+			return true
+		}
+	}
+	if p.Poll != nil {
+		_, voted := p.Poll.ballots[userID]
+		return voted
+	}
+	return false
+}
+
+// clone copies everything a repository update may modify
+func (p Post) clone() Post {
+	p.Comments = make([]*comment.Comment, 0)
+	p.Tags = append(make([]string, 0, len(p.Tags)), p.Tags...)
+	votes := make([]*Votes, 0, len(p.Votes))
+	for _, vote := range p.Votes {
+		voteCopy := *vote
+		votes = append(votes, &voteCopy)
+	}
+	p.Votes = votes
+	p.Poll = p.Poll.clone()
+	return p
 }
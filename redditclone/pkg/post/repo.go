@@ -3,99 +3,229 @@ package post
 import (
 	"errors"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
-	"redditclone/pkg/comment"
+	"redditclone/pkg/markdown"
 	"redditclone/pkg/user"
 )
 
+// AnyVersion makes Update skip the version check
+const AnyVersion uint64 = 0
+
 var (
-	ErrNoPost    = errors.New("no post found")
-	ErrNoDel     = errors.New("there is no post being deleted")
-	ErrNoDelComm = errors.New("there is no comment being deleted")
+	ErrBadVote  = errors.New("vote must be -1, 0 or 1")
+	ErrNoPost   = errors.New("no post found")
+	ErrNoDel    = errors.New("there is no post being deleted")
+	ErrConflict = errors.New("post was changed concurrently")
+	ErrArchived = errors.New("post is archived")
+
+	// errNotRendered sends Update out of the lock to render the new text
+	errNotRendered = errors.New("post text is not rendered")
 )
 
 type PostMemoryRepository struct {
-	data  []Post
-	mutex sync.Mutex
+	data map[string]Post
+	// order holds ids in creation order, deleted ids stay there until the next compaction
+	order      []string
+	deleted    int
+	byCategory map[string]map[string]struct{}
+	byAuthor   map[string]map[string]struct{}
+	byURL      map[string]map[string]struct{}
+	scheduled  map[string]struct{}
+	lastSeq    uint64
+	revision   uint64
+	modified   time.Time
+	mutex      sync.RWMutex
 }
 
 func NewMemoryRepo() *PostMemoryRepository {
 	return &PostMemoryRepository{
-		data:  make([]Post, 0, 10),
-		mutex: sync.Mutex{},
+		data:       make(map[string]Post),
+		order:      make([]string, 0, 10),
+		byCategory: make(map[string]map[string]struct{}),
+		byAuthor:   make(map[string]map[string]struct{}),
+		byURL:      make(map[string]map[string]struct{}),
+		scheduled:  make(map[string]struct{}),
+		mutex:      sync.RWMutex{},
 	}
 }
 
 // ================================ GET ===============================
 func (repo *PostMemoryRepository) Get(postID string) (Post, error) {
-	repo.mutex.Lock()
-	defer repo.mutex.Unlock()
-	for _, post := range repo.data {
-		if post.ID == postID {
-			return post, nil
-		}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	post, ok := repo.data[postID]
+	if !ok {
+		return Post{}, ErrNoPost
 	}
-	return Post{}, ErrNoPost
+	return post.clone(), nil
 }
 
-func (repo *PostMemoryRepository) GetPost(postID string) (Post, error) {
-	repo.mutex.Lock()
-	defer repo.mutex.Unlock()
-	for idx, post := range repo.data {
-		if post.ID == postID {
-			post.Views += 1
-			repo.data[idx] = post
-			return post, nil
-		}
-	}
-	return Post{}, ErrNoPost
+func (repo *PostMemoryRepository) Revision() (uint64, time.Time) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	return repo.revision, repo.modified
 }
 
 func (repo *PostMemoryRepository) GetCategory(category string) ([]Post, error) {
-	suitablePosts := make([]Post, 0, 10)
-	repo.mutex.Lock()
-	defer repo.mutex.Unlock()
-	for _, post := range repo.data {
-		if post.Category == category {
-			suitablePosts = append(suitablePosts, post)
-		}
-	}
-	return suitablePosts, nil
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	return repo.collect(repo.byCategory[category]), nil
 }
 
 func (repo *PostMemoryRepository) GetAllPosts() ([]Post, error) {
-	return repo.data, nil
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	posts := make([]Post, 0, len(repo.data))
+	for _, postID := range repo.order {
+		if post, ok := repo.data[postID]; ok {
+			posts = append(posts, post.clone())
+		}
+	}
+	return posts, nil
 }
 
 func (repo *PostMemoryRepository) GetUserPosts(userLogin string) ([]Post, error) {
-	suitablePosts := make([]Post, 0, 10)
-	repo.mutex.Lock()
-	defer repo.mutex.Unlock()
-	for _, post := range repo.data {
-		if post.Author.Login == userLogin {
-			suitablePosts = append(suitablePosts, post)
-		}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	return repo.collect(repo.byAuthor[userLogin]), nil
+}
+
+func (repo *PostMemoryRepository) GetByAuthors(userLogins []string) (map[string][]Post, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	posts := make(map[string][]Post, len(userLogins))
+	for _, login := range userLogins {
+		posts[login] = repo.collect(repo.byAuthor[login])
 	}
-	return suitablePosts, nil
+	return posts, nil
+}
+
+func (repo *PostMemoryRepository) GetScheduled() ([]Post, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	return repo.collect(repo.scheduled), nil
+}
+
+func (repo *PostMemoryRepository) GetByURL(rawURL string) ([]Post, error) {
+	link := NormalizeURL(rawURL)
+	if link == "" {
+		return make([]Post, 0), nil
+	}
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	return repo.collect(repo.byURL[link]), nil
 }
 
 // =============================== POST ===============================
 func (repo *PostMemoryRepository) Create(post Post) (Post, error) {
-	repo.mutex.Lock()
-	defer repo.mutex.Unlock()
-	post.Created = time.Now().Format(time.RFC3339)
+	return repo.insert(prepare(post)), nil
+}
+
+// prepare fills the fields the repository owns, the text is rendered before any lock is taken
+func prepare(post Post) Post {
+	post.Created = FormatTime(time.Now())
 	post.UpvotePercentage = 100
 	post.Views = 0
+	post.TotalViews = 0
 	post.Score = 0
-	post.Comments = make([]*comment.Comment, 0, 10)
+	post.Comments = nil
+	post.CommentCount = 0
 	post.Votes = make([]*Votes, 0, 10)
+	// new posts start unpinned and unlocked, only moderators move them there
+	post.Pinned = false
+	post.Locked = false
+	if post.Tags == nil {
+		post.Tags = make([]string, 0)
+	}
 	post.ID = uuid.New().String()
-	repo.data = append(repo.data, post)
-	return post, nil
+	post.Version = 1
+	post.TextHTML = markdown.Render(post.Text)
+	return post
+}
+
+func (repo *PostMemoryRepository) insert(post Post) Post {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.lastSeq++
+	post.seq = repo.lastSeq
+	repo.data[post.ID] = post
+	repo.order = append(repo.order, post.ID)
+	addToIndex(repo.byCategory, post.Category, post.ID)
+	addToIndex(repo.byAuthor, post.Author.Login, post.ID)
+	addToIndex(repo.byURL, NormalizeURL(post.URL), post.ID)
+	repo.indexSchedule(post)
+	repo.touch()
+	return post.clone()
+}
+
+// Update applies fn to a copy of the post and stores the result if the post still has
+// the given version. fn runs under the repository lock and must not call the repository.
+// Pinning fails with ErrTooManyPins once the category has MaxPinned pinned posts.
+// A changed text is rendered with the lock released, fn is then applied once more.
+func (repo *PostMemoryRepository) Update(postID string, version uint64, fn func(post *Post) error) (Post, error) {
+	html := rendered{}
+	for {
+		post, errUpdate := repo.update(postID, version, fn, html)
+		if errUpdate != errNotRendered {
+			return post, errUpdate
+		}
+		html = rendered{src: post.Text, html: markdown.Render(post.Text)}
+	}
+}
+
+// rendered is the html of the source, update only stores text it was given the html of
+type rendered struct {
+	src  string
+	html string
+}
+
+func (repo *PostMemoryRepository) update(postID string, version uint64, fn func(post *Post) error, html rendered) (Post, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	stored, ok := repo.data[postID]
+	if !ok {
+		return Post{}, ErrNoPost
+	}
+	if version != AnyVersion && stored.Version != version {
+		return Post{}, ErrConflict
+	}
+	post := stored.clone()
+	errFn := fn(&post)
+	if errFn != nil {
+		return Post{}, errFn
+	}
+	// the count is taken under the same lock as the write, two moderators can not both take the last place
+	if post.Pinned && !stored.Pinned && repo.pinnedIn(stored.Category) >= MaxPinned {
+		return Post{}, ErrTooManyPins
+	}
+	// indexed fields are fixed at creation
+	post.ID = stored.ID
+	post.Category = stored.Category
+	post.Author = stored.Author
+	post.URL = stored.URL
+	post.Version = stored.Version + 1
+	post.seq = stored.seq
+	if stored.Scheduled && !post.Scheduled {
+		// a published post is the newest one, listings in creation order must agree with Created
+		repo.moveToEnd(&post)
+	}
+	// html follows the source, it is rendered again only when the text changes
+	post.TextHTML = stored.TextHTML
+	if post.Text != stored.Text {
+		if html.src != post.Text {
+			return post, errNotRendered
+		}
+		post.TextHTML = html.html
+	}
+	repo.data[postID] = post
+	repo.indexSchedule(post)
+	repo.touch()
+	return post.clone(), nil
 }
 
 func (repo *PostMemoryRepository) UpdateVote(
@@ -103,15 +233,206 @@ func (repo *PostMemoryRepository) UpdateVote(
 	postID string,
 	author *user.User,
 ) (Post, error) {
-	post, errGet := repo.Get(postID)
-	if errGet != nil {
-		return Post{}, errGet
+	return repo.Update(postID, AnyVersion, func(post *Post) error {
+		if !post.CanVote() {
+			return ErrArchived
+		}
+		return ApplyVote(post, vote, author.ID)
+	})
+}
+
+func (repo *PostMemoryRepository) AddCommentCount(postID string, delta int) (Post, error) {
+	return repo.Update(postID, AnyVersion, func(post *Post) error {
+		post.CommentCount += delta
+		return nil
+	})
+}
+
+func (repo *PostMemoryRepository) Anonymize(userLogin string) (int, error) {
+	placeholder := markdown.Render(user.DeletedLogin)
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	ids := repo.byAuthor[userLogin]
+	for postID := range ids {
+		post := repo.data[postID].clone()
+		post.Author = user.Deleted()
+		if post.Text != "" {
+			post.Text = user.DeletedLogin
+			post.TextHTML = placeholder
+		}
+		post.Version++
+		repo.data[postID] = post
 	}
+	// the placeholder is not indexed, nobody may act as the author again
+	delete(repo.byAuthor, userLogin)
+	if len(ids) > 0 {
+		repo.touch()
+	}
+	return len(ids), nil
+}
+
+func (repo *PostMemoryRepository) RemoveVotes(userID string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	removed := 0
+	for postID, stored := range repo.data {
+		if !stored.votedBy(userID) {
+			continue
+		}
+		post := stored.clone()
+		errVote := ApplyVote(&post, 0, userID)
+		if errVote != nil {
+			return removed, errVote
+		}
+		if post.Poll != nil {
+			post.Poll.removeBallot(userID)
+		}
+		post.Version++
+		repo.data[postID] = post
+		removed++
+	}
+	if removed > 0 {
+		repo.touch()
+	}
+	return removed, nil
+}
+
+func (repo *PostMemoryRepository) AddViews(postID string, unique, total int) error {
 	repo.mutex.Lock()
 	defer repo.mutex.Unlock()
+	post, ok := repo.data[postID]
+	if !ok {
+		return ErrNoPost
+	}
+	// views are a plain counter and do not bump the version or the revision
+	post.Views += unique
+	post.TotalViews += total
+	repo.data[postID] = post
+	return nil
+}
+
+// ============================== DELETE ==============================
+func (repo *PostMemoryRepository) Delete(postID string) (bool, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	post, ok := repo.data[postID]
+	if !ok {
+		return false, ErrNoDel
+	}
+	delete(repo.data, postID)
+	repo.deleted++
+	if repo.deleted > len(repo.order)/2 {
+		repo.compact()
+	}
+	removeFromIndex(repo.byCategory, post.Category, postID)
+	removeFromIndex(repo.byAuthor, post.Author.Login, postID)
+	removeFromIndex(repo.byURL, NormalizeURL(post.URL), postID)
+	delete(repo.scheduled, postID)
+	repo.touch()
+	return true, nil
+}
+
+// ============================== HELP FUNC ==============================
+// collect must be called with the mutex held, posts come in creation order
+func (repo *PostMemoryRepository) collect(ids map[string]struct{}) []Post {
+	type entry struct {
+		seq uint64
+		id  string
+	}
+	entries := make([]entry, 0, len(ids))
+	for id := range ids {
+		entries = append(entries, entry{seq: repo.data[id].seq, id: id})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+	posts := make([]Post, 0, len(entries))
+	for _, item := range entries {
+		posts = append(posts, repo.data[item.id].clone())
+	}
+	return posts
+}
+
+// touch must be called with the mutex held after every change
+func (repo *PostMemoryRepository) touch() {
+	repo.revision++
+	repo.modified = time.Now()
+}
+
+// indexSchedule must be called with the mutex held
+func (repo *PostMemoryRepository) indexSchedule(post Post) {
+	if post.pendingTransition() {
+		repo.scheduled[post.ID] = struct{}{}
+	} else {
+		delete(repo.scheduled, post.ID)
+	}
+}
+
+// pinnedIn must be called with the mutex held
+func (repo *PostMemoryRepository) pinnedIn(category string) int {
+	pinned := 0
+	for id := range repo.byCategory[category] {
+		if repo.data[id].Pinned {
+			pinned++
+		}
+	}
+	return pinned
+}
+
+// moveToEnd must be called with the mutex held, it gives the post the next seq and the last place in order
+func (repo *PostMemoryRepository) moveToEnd(post *Post) {
+	repo.lastSeq++
+	post.seq = repo.lastSeq
+	for idx, postID := range repo.order {
+		if postID == post.ID {
+			repo.order = append(repo.order[:idx], repo.order[idx+1:]...)
+			break
+		}
+	}
+	repo.order = append(repo.order, post.ID)
+}
+
+// compact must be called with the mutex held
+func (repo *PostMemoryRepository) compact() {
+	order := make([]string, 0, len(repo.data))
+	for _, postID := range repo.order {
+		if _, ok := repo.data[postID]; ok {
+			order = append(order, postID)
+		}
+	}
+	repo.order = order
+	repo.deleted = 0
+}
+
+// FormatTime is the one form of stored timestamps: UTC strings sort in time order
+func FormatTime(at time.Time) string {
+	return at.UTC().Format(time.RFC3339)
+}
+
+func addToIndex(index map[string]map[string]struct{}, key string, postID string) {
+	if key == "" {
+		return
+	}
+	if _, ok := index[key]; !ok {
+		index[key] = make(map[string]struct{})
+	}
+	index[key][postID] = struct{}{}
+}
+
+func removeFromIndex(index map[string]map[string]struct{}, key string, postID string) {
+	delete(index[key], postID)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// ApplyVote sets the vote of the user and recalculates the score, vote 0 removes the vote
+func ApplyVote(post *Post, vote int, userID string) error {
+	if vote < -1 || vote > 1 {
+		return ErrBadVote
+	}
 	newVote := &Votes{
-		User: author.ID,
-		Vote: vote,
+		User:    userID,
+		Vote:    vote,
+		Created: FormatTime(time.Now()),
 	}
 	delIDx := -1
 	isNewVote := true
@@ -119,9 +440,12 @@ func (repo *PostMemoryRepository) UpdateVote(
 		if item.User == newVote.User {
 			if vote == 0 {
 				delIDx = idx
-			} else {
+			} else if item.Vote != vote {
 				post.Votes[idx] = newVote
 				isNewVote = false
+			} else {
+				// repeating the same vote keeps its original time
+				isNewVote = false
 			}
 			break
 		}
@@ -129,7 +453,7 @@ func (repo *PostMemoryRepository) UpdateVote(
 
 	if delIDx != -1 {
 		post.Votes = append(post.Votes[:delIDx], post.Votes[delIDx+1:]...)
-	} else if isNewVote {
+	} else if isNewVote && vote != 0 {
 		post.Votes = append(post.Votes, newVote)
 	}
 
@@ -150,50 +474,5 @@ func (repo *PostMemoryRepository) UpdateVote(
 	} else {
 		post.UpvotePercentage = int(math.Abs(float64(upvotes) / float64(numbVotes) * 100))
 	}
-	// UPD repo
-	for idx, item := range repo.data {
-		if item.ID == postID {
-			repo.data[idx] = post
-		}
-	}
-	return post, nil
-}
-
-func (repo *PostMemoryRepository) AddComment(currpost Post, currComment *comment.Comment) (Post, error) {
-	repo.mutex.Lock()
-	defer repo.mutex.Unlock()
-	for idx, post := range repo.data {
-		if post.ID == currpost.ID {
-			currpost.Comments = append(currpost.Comments, currComment)
-			repo.data[idx] = currpost
-			return currpost, nil
-		}
-	}
-	return Post{}, ErrNoDelComm
-}
-
-// ============================== DELETE ==============================
-func (repo *PostMemoryRepository) Delete(postID string) (bool, error) {
-	repo.mutex.Lock()
-	defer repo.mutex.Unlock()
-	for i, post := range repo.data {
-		if post.ID == postID {
-			repo.data = append(repo.data[:i], repo.data[i+1:]...)
-			return true, nil
-		}
-	}
-	return false, ErrNoDel
-}
-
-func (repo *PostMemoryRepository) DeleteComment(delCommentID int, postID string) (Post, error) {
-	repo.mutex.Lock()
-	defer repo.mutex.Unlock()
-	for idx, post := range repo.data {
-		if post.ID == postID {
-			post.Comments = append(post.Comments[:delCommentID], post.Comments[delCommentID+1:]...)
-			repo.data[idx] = post
-			return post, nil
-		}
-	}
-	return Post{}, ErrNoDelComm
+	return nil
 }
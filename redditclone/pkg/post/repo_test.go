@@ -0,0 +1,431 @@
+package post
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"redditclone/pkg/user"
+)
+
+func newTestPost(t *testing.T, repo *PostMemoryRepository) Post {
+	created, err := repo.Create(Post{
+		Author:   user.User{ID: "author", Login: "author"},
+		Category: "music",
+		Title:    "title",
+		Type:     "text",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return created
+}
+
+func TestConcurrentVotesAndComments(t *testing.T) {
+	repo := NewMemoryRepo()
+	created := newTestPost(t, repo)
+
+	const workers = 200
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			voter := &user.User{ID: fmt.Sprintf("user%d", i)}
+			if _, err := repo.UpdateVote(1, created.ID, voter); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := repo.AddCommentCount(created.ID, 1); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	result, err := repo.Get(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Score != workers || len(result.Votes) != workers {
+		t.Errorf("lost votes: score %d, votes %d, expected %d", result.Score, len(result.Votes), workers)
+	}
+	if result.CommentCount != workers {
+		t.Errorf("lost comments: got %d, expected %d", result.CommentCount, workers)
+	}
+	if result.Version != created.Version+2*workers {
+		t.Errorf("bad version: got %d, expected %d", result.Version, created.Version+2*workers)
+	}
+}
+
+func TestConcurrentVoteChanges(t *testing.T) {
+	repo := NewMemoryRepo()
+	created := newTestPost(t, repo)
+
+	const workers = 50
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			voter := &user.User{ID: fmt.Sprintf("user%d", i)}
+			// even users end with a downvote, odd ones with no vote at all
+			for _, vote := range []int{1, -1, 1, 0, -1} {
+				if _, err := repo.UpdateVote(vote, created.ID, voter); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+			if i%2 == 1 {
+				if _, err := repo.UpdateVote(0, created.ID, voter); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	result, err := repo.Get(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Score != -workers/2 || len(result.Votes) != workers/2 {
+		t.Errorf("bad votes: score %d, votes %d, expected %d", result.Score, len(result.Votes), workers/2)
+	}
+}
+
+func TestUpdateConflict(t *testing.T) {
+	repo := NewMemoryRepo()
+	created := newTestPost(t, repo)
+
+	updated, err := repo.Update(created.ID, created.Version, func(post *Post) error {
+		post.Title = "first"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = repo.Update(created.ID, created.Version, func(post *Post) error {
+		post.Title = "second"
+		return nil
+	})
+	if err != ErrConflict {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+	result, err := repo.Get(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Title != "first" || result.Version != updated.Version {
+		t.Errorf("stale update was applied: %q, version %d", result.Title, result.Version)
+	}
+	if _, err = repo.Update("missing", AnyVersion, func(post *Post) error { return nil }); err != ErrNoPost {
+		t.Errorf("expected ErrNoPost, got %v", err)
+	}
+}
+
+func TestConcurrentCompareAndSwap(t *testing.T) {
+	repo := NewMemoryRepo()
+	created := newTestPost(t, repo)
+
+	const (
+		workers    = 20
+		increments = 50
+	)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for done := 0; done < increments; {
+				current, err := repo.Get(created.ID)
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				_, err = repo.Update(created.ID, current.Version, func(post *Post) error {
+					post.Score = current.Score + 1
+					return nil
+				})
+				switch err {
+				case nil:
+					done++
+				case ErrConflict:
+				default:
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result, err := repo.Get(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Score != workers*increments {
+		t.Errorf("lost updates: got %d, expected %d", result.Score, workers*increments)
+	}
+}
+
+func TestReturnedPostIsCopy(t *testing.T) {
+	repo := NewMemoryRepo()
+	created := newTestPost(t, repo)
+	voted, err := repo.UpdateVote(1, created.ID, &user.User{ID: "voter"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	voted.Votes[0].Vote = -1
+	voted.Votes = append(voted.Votes, &Votes{User: "ghost", Vote: 1})
+
+	result, err := repo.Get(created.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Votes) != 1 || result.Votes[0].Vote != 1 {
+		t.Errorf("repository state was changed through returned post: %+v", result.Votes)
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	repo := NewMemoryRepo()
+	ids := make([]string, 0, 6)
+	for i := 0; i < 6; i++ {
+		login := fmt.Sprintf("user%d", i%2)
+		created, err := repo.Create(Post{
+			Author:   user.User{ID: login, Login: login},
+			Category: fmt.Sprintf("category%d", i%3),
+			URL:      fmt.Sprintf("https://www.example.com/%d/?utm_source=feed", i%2),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+	if _, err := repo.Delete(ids[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	check := func(name string, posts []Post, expected ...string) {
+		if len(posts) != len(expected) {
+			t.Errorf("%s: got %d posts, expected %d", name, len(posts), len(expected))
+			return
+		}
+		for i, item := range posts {
+			if item.ID != expected[i] {
+				t.Errorf("%s: post %d is %s, expected %s", name, i, item.ID, expected[i])
+			}
+		}
+	}
+	all, _ := repo.GetAllPosts()
+	check("all", all, ids[1:]...)
+	category, _ := repo.GetCategory("category0")
+	check("category", category, ids[3])
+	userPosts, _ := repo.GetUserPosts("user1")
+	check("user", userPosts, ids[1], ids[3], ids[5])
+	sameURL, _ := repo.GetByURL("http://example.com/0")
+	check("url", sameURL, ids[2], ids[4])
+
+	if _, err := repo.Get(ids[0]); err != ErrNoPost {
+		t.Errorf("expected ErrNoPost, got %v", err)
+	}
+	if _, err := repo.Delete(ids[0]); err != ErrNoDel {
+		t.Errorf("expected ErrNoDel, got %v", err)
+	}
+}
+
+func TestAnonymizeAndRemoveVotes(t *testing.T) {
+	repo := NewMemoryRepo()
+	created, err := repo.Create(Post{
+		Author:   user.User{ID: "gone", Login: "gone"},
+		Category: "music",
+		Title:    "title",
+		Text:     "personal text",
+		Type:     "text",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other := newTestPost(t, repo)
+	for _, voter := range []string{"gone", "stays"} {
+		if _, err = repo.UpdateVote(1, other.ID, &user.User{ID: voter}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	anonymized, err := repo.Anonymize("gone")
+	if err != nil || anonymized != 1 {
+		t.Fatalf("anonymized %d posts, err %v", anonymized, err)
+	}
+	result, _ := repo.Get(created.ID)
+	if result.Author.Login != user.DeletedLogin || result.Author.ID != "" || result.Text != user.DeletedLogin {
+		t.Errorf("post was not anonymized: %+v", result)
+	}
+	if result.Title != created.Title {
+		t.Errorf("thread title was lost: %q", result.Title)
+	}
+	if posts, _ := repo.GetUserPosts("gone"); len(posts) != 0 {
+		t.Errorf("anonymized post is still listed for its author")
+	}
+
+	removed, err := repo.RemoveVotes("gone")
+	if err != nil || removed != 1 {
+		t.Fatalf("removed %d votes, err %v", removed, err)
+	}
+	result, _ = repo.Get(other.ID)
+	if result.Score != 1 || len(result.Votes) != 1 || result.Votes[0].User != "stays" {
+		t.Errorf("bad votes after removal: score %d, votes %+v", result.Score, result.Votes)
+	}
+}
+
+const (
+	benchPosts      = 100000
+	benchCategories = 10
+	benchAuthors    = 1000
+)
+
+var (
+	benchRepo     *PostMemoryRepository
+	benchIDs      []string
+	benchRepoOnce sync.Once
+)
+
+func benchmarkRepo(b *testing.B) (*PostMemoryRepository, []string) {
+	benchRepoOnce.Do(func() {
+		benchRepo = NewMemoryRepo()
+		benchIDs = make([]string, 0, benchPosts)
+		for i := 0; i < benchPosts; i++ {
+			login := fmt.Sprintf("user%d", i%benchAuthors)
+			created, err := benchRepo.Create(Post{
+				Author:   user.User{ID: login, Login: login},
+				Category: fmt.Sprintf("category%d", i%benchCategories),
+				Title:    "title",
+				Type:     "link",
+				URL:      fmt.Sprintf("https://example.com/%d", i),
+			})
+			if err != nil {
+				b.Fatalf("unexpected error: %v", err)
+			}
+			benchIDs = append(benchIDs, created.ID)
+		}
+	})
+	b.ResetTimer()
+	return benchRepo, benchIDs
+}
+
+func BenchmarkGet(b *testing.B) {
+	repo, ids := benchmarkRepo(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.Get(ids[i%len(ids)]); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func BenchmarkGetParallel(b *testing.B) {
+	repo, ids := benchmarkRepo(b)
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := repo.Get(ids[i%len(ids)]); err != nil {
+				b.Errorf("unexpected error: %v", err)
+				return
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkGetByURL(b *testing.B) {
+	repo, _ := benchmarkRepo(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.GetByURL(fmt.Sprintf("http://www.example.com/%d", i%benchPosts)); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func BenchmarkGetUserPosts(b *testing.B) {
+	repo, _ := benchmarkRepo(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.GetUserPosts(fmt.Sprintf("user%d", i%benchAuthors)); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func BenchmarkGetCategory(b *testing.B) {
+	repo, _ := benchmarkRepo(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.GetCategory(fmt.Sprintf("category%d", i%benchCategories)); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func BenchmarkGetAllPosts(b *testing.B) {
+	repo, _ := benchmarkRepo(b)
+	for i := 0; i < b.N; i++ {
+		if _, err := repo.GetAllPosts(); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func BenchmarkUpdateVoteParallel(b *testing.B) {
+	repo, ids := benchmarkRepo(b)
+	b.RunParallel(func(pb *testing.PB) {
+		voter := &user.User{ID: "voter"}
+		i := 0
+		for pb.Next() {
+			if _, err := repo.UpdateVote(1, ids[i%len(ids)], voter); err != nil {
+				b.Errorf("unexpected error: %v", err)
+				return
+			}
+			i++
+		}
+	})
+}
+
+func TestGetByAuthors(t *testing.T) {
+	repo := NewMemoryRepo()
+	first := newTestPost(t, repo)
+	second := newTestPost(t, repo)
+	byAuthor, err := repo.GetByAuthors([]string{"author", "nobody"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	posts := byAuthor["author"]
+	if len(posts) != 2 || posts[0].ID != first.ID || posts[1].ID != second.ID {
+		t.Errorf("got %v, expected both posts in creation order", posts)
+	}
+	if nobody, ok := byAuthor["nobody"]; !ok || len(nobody) != 0 {
+		t.Errorf("got %v for a user without posts", nobody)
+	}
+}
+
+func TestUpdateRendersNewText(t *testing.T) {
+	repo := NewMemoryRepo()
+	created := newTestPost(t, repo)
+	calls := 0
+	updated, err := repo.Update(created.ID, AnyVersion, func(post *Post) error {
+		calls++
+		post.Text = "**edited**"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.TextHTML != "<p><strong>edited</strong></p>\n" {
+		t.Errorf("got html %q", updated.TextHTML)
+	}
+	// the text is rendered with the lock released, fn runs again on the post stored by then
+	if calls != 2 || updated.Version != created.Version+1 {
+		t.Errorf("fn ran %d times, version %d", calls, updated.Version)
+	}
+	if updated, _ = repo.Update(created.ID, AnyVersion, func(post *Post) error { return nil }); updated.TextHTML == "" {
+		t.Errorf("html lost on update keeping the text")
+	}
+}
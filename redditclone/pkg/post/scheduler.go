@@ -0,0 +1,90 @@
+package post
+
+import (
+	"context"
+	"time"
+
+	"redditclone/pkg/clock"
+)
+
+// Scheduler publishes scheduled posts and archives expired ones
+type Scheduler struct {
+	Posts PostRepo
+	Clock clock.Clock
+}
+
+func NewScheduler(posts PostRepo, clk clock.Clock) *Scheduler {
+	return &Scheduler{
+		Posts: posts,
+		Clock: clk,
+	}
+}
+
+// Tick applies every transition that is due and closes polls. A post changed concurrently is left for the next tick.
+func (s *Scheduler) Tick() (published int, archived int, err error) {
+	now := s.Clock.Now()
+	posts, errGet := s.Posts.GetScheduled()
+	if errGet != nil {
+		return 0, 0, errGet
+	}
+	for _, item := range posts {
+		publish := item.Scheduled && due(item.PublishAt, now)
+		archive := !item.Archived && due(item.ExpiresAt, now)
+		closePoll := item.Poll != nil && !item.Poll.Closed && due(item.Poll.ClosesAt, now)
+		if !publish && !archive && !closePoll {
+			continue
+		}
+		_, errUpdate := s.Posts.Update(item.ID, item.Version, func(post *Post) error {
+			if publish {
+				post.Scheduled = false
+				// the post shows up as new once published
+				publishAt, _ := time.Parse(time.RFC3339, post.PublishAt)
+				post.Created = FormatTime(publishAt)
+			}
+			if archive {
+				post.Archived = true
+				post.Pinned = false
+			}
+			if closePoll {
+				post.Poll.Closed = true
+			}
+			return nil
+		})
+		switch errUpdate {
+		case nil:
+		case ErrConflict, ErrNoPost:
+			continue
+		default:
+			return published, archived, errUpdate
+		}
+		if publish {
+			published++
+		}
+		if archive {
+			archived++
+		}
+	}
+	return published, archived, nil
+}
+
+// Run ticks every interval until the context is done
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration, onErr func(error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.Clock.After(interval):
+		}
+		if _, _, errTick := s.Tick(); errTick != nil && onErr != nil {
+			onErr(errTick)
+		}
+	}
+}
+
+func due(moment string, now time.Time) bool {
+	if moment == "" {
+		return false
+	}
+	parsed, errParse := time.Parse(time.RFC3339, moment)
+	return errParse == nil && !parsed.After(now)
+}
@@ -0,0 +1,140 @@
+package post
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"redditclone/pkg/clock"
+	"redditclone/pkg/user"
+)
+
+func TestSchedulerTransitions(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	repo := NewMemoryRepo()
+	scheduled, err := repo.Create(Post{
+		Author:    user.User{ID: "author", Login: "author"},
+		Category:  "news",
+		Title:     "announcement",
+		Type:      "text",
+		PublishAt: start.Add(time.Hour).Format(time.RFC3339),
+		ExpiresAt: start.Add(3 * time.Hour).Format(time.RFC3339),
+		Scheduled: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plain := newTestPost(t, repo)
+	scheduler := NewScheduler(repo, clk)
+
+	if visible := (ListFilter{Viewer: "other"}).Apply([]Post{scheduled}); len(visible) != 0 {
+		t.Errorf("scheduled post is listed before publishing")
+	}
+	if published, archived, _ := scheduler.Tick(); published != 0 || archived != 0 {
+		t.Errorf("early tick changed posts: %d published, %d archived", published, archived)
+	}
+
+	clk.Advance(time.Hour)
+	if published, archived, _ := scheduler.Tick(); published != 1 || archived != 0 {
+		t.Errorf("got %d published, %d archived, expected 1 and 0", published, archived)
+	}
+	result, _ := repo.Get(scheduled.ID)
+	if result.Scheduled || result.Created != result.PublishAt || !result.ShownTo("other") {
+		t.Errorf("post was not published: %+v", result)
+	}
+
+	clk.Advance(2 * time.Hour)
+	if published, archived, _ := scheduler.Tick(); published != 0 || archived != 1 {
+		t.Errorf("got %d published, %d archived, expected 0 and 1", published, archived)
+	}
+	result, _ = repo.Get(scheduled.ID)
+	if !result.Archived {
+		t.Errorf("post was not archived")
+	}
+	if _, err = repo.UpdateVote(1, scheduled.ID, &user.User{ID: "voter"}); err != ErrArchived {
+		t.Errorf("expected ErrArchived, got %v", err)
+	}
+	if pending, _ := repo.GetScheduled(); len(pending) != 0 {
+		t.Errorf("finished post is still scheduled")
+	}
+	if result, _ = repo.Get(plain.ID); result.Archived || result.Version != plain.Version {
+		t.Errorf("unscheduled post was changed")
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	repo := NewMemoryRepo()
+	created, err := repo.Create(Post{
+		Author:    user.User{ID: "author", Login: "author"},
+		Category:  "news",
+		Title:     "expiring",
+		Type:      "text",
+		ExpiresAt: start.Add(time.Minute).Format(time.RFC3339),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewScheduler(repo, clk).Run(ctx, time.Minute, func(err error) { t.Errorf("unexpected error: %v", err) })
+		close(done)
+	}()
+
+	// wait for the loop to park on the clock, then let one interval pass
+	for clk.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Minute)
+	for clk.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if result, _ := repo.Get(created.ID); !result.Archived {
+		t.Errorf("post was not archived by the running scheduler")
+	}
+}
+
+func TestPublishedPostIsNewest(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	clk := clock.NewFake(start)
+	repo := NewMemoryRepo()
+	scheduled, err := repo.Create(Post{
+		Author:    user.User{ID: "author", Login: "author"},
+		Category:  "music",
+		Title:     "later",
+		Type:      "text",
+		PublishAt: start.Add(time.Hour).UTC().Format(time.RFC3339),
+		Scheduled: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plain := newTestPost(t, repo)
+	if plain.Created != FormatTime(start) && plain.Created != FormatTime(start.Add(time.Second)) {
+		t.Errorf("post created at %q, expected UTC time", plain.Created)
+	}
+
+	clk.Advance(time.Hour)
+	if published, _, _ := NewScheduler(repo, clk).Tick(); published != 1 {
+		t.Fatalf("got %d published, expected 1", published)
+	}
+	for name, list := range map[string]func() ([]Post, error){
+		"all":      repo.GetAllPosts,
+		"category": func() ([]Post, error) { return repo.GetCategory("music") },
+	} {
+		posts, _ := list()
+		if len(posts) != 2 || posts[1].ID != scheduled.ID {
+			t.Errorf("%s: the published post is not the last one", name)
+			continue
+		}
+		if posts[0].Created > posts[1].Created {
+			t.Errorf("%s: creation order and Created disagree: %q before %q", name, posts[0].Created, posts[1].Created)
+		}
+	}
+}
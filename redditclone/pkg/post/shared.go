@@ -0,0 +1,247 @@
+package post
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"redditclone/pkg/kv"
+	"redditclone/pkg/markdown"
+	"redditclone/pkg/user"
+	"redditclone/pkg/views"
+)
+
+// postState is a snapshot of the repository, gob skips the unexported seq and poll ballots
+type postState struct {
+	Posts    []Post
+	Seqs     []uint64
+	Ballots  []map[string]int
+	LastSeq  uint64
+	Revision uint64
+	Modified time.Time
+}
+
+// Snapshot saves the posts in creation order, indexes are rebuilt on Restore
+func (repo *PostMemoryRepository) Snapshot() ([]byte, error) {
+	repo.mutex.RLock()
+	state := postState{LastSeq: repo.lastSeq, Revision: repo.revision, Modified: repo.modified}
+	for _, postID := range repo.order {
+		post, ok := repo.data[postID]
+		if !ok {
+			continue
+		}
+		state.Posts = append(state.Posts, post)
+		state.Seqs = append(state.Seqs, post.seq)
+		var ballots map[string]int
+		if post.Poll != nil {
+			ballots = post.Poll.ballots
+		}
+		state.Ballots = append(state.Ballots, ballots)
+	}
+	buf := &bytes.Buffer{}
+	errEncode := gob.NewEncoder(buf).Encode(state)
+	repo.mutex.RUnlock()
+	return buf.Bytes(), errEncode
+}
+
+func (repo *PostMemoryRepository) Restore(data []byte) error {
+	state := postState{}
+	if len(data) > 0 {
+		if errDecode := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); errDecode != nil {
+			return errDecode
+		}
+	}
+	restored := NewMemoryRepo()
+	for idx, post := range state.Posts {
+		post.seq = state.Seqs[idx]
+		// gob decodes empty slices as nil, the api shows them as empty lists
+		if post.Tags == nil {
+			post.Tags = make([]string, 0)
+		}
+		if post.Votes == nil {
+			post.Votes = make([]*Votes, 0)
+		}
+		if post.Poll != nil {
+			post.Poll.ballots = make(map[string]int, len(state.Ballots[idx]))
+			for userID, option := range state.Ballots[idx] {
+				post.Poll.ballots[userID] = option
+				post.Poll.Options[option].votes++
+			}
+		}
+		restored.data[post.ID] = post
+		restored.order = append(restored.order, post.ID)
+		addToIndex(restored.byCategory, post.Category, post.ID)
+		addToIndex(restored.byAuthor, post.Author.Login, post.ID)
+		addToIndex(restored.byURL, NormalizeURL(post.URL), post.ID)
+		restored.indexSchedule(post)
+	}
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.data = restored.data
+	repo.order = restored.order
+	repo.deleted = 0
+	repo.byCategory = restored.byCategory
+	repo.byAuthor = restored.byAuthor
+	repo.byURL = restored.byURL
+	repo.scheduled = restored.scheduled
+	repo.lastSeq = state.LastSeq
+	repo.revision = state.Revision
+	repo.modified = state.Modified
+	return nil
+}
+
+// SharedRepository serves the posts every instance writes through the store.
+// The revision is part of the saved state, so response caches of all instances agree.
+type SharedRepository struct {
+	local  *PostMemoryRepository
+	shared *kv.Shared
+}
+
+func NewSharedRepo(store kv.Store) *SharedRepository {
+	local := NewMemoryRepo()
+	return &SharedRepository{
+		local:  local,
+		shared: kv.NewShared(store, "posts", local),
+	}
+}
+
+// ================================ GET ===============================
+func (repo *SharedRepository) Get(postID string) (Post, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return Post{}, errSync
+	}
+	return repo.local.Get(postID)
+}
+
+func (repo *SharedRepository) GetCategory(category string) ([]Post, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetCategory(category)
+}
+
+func (repo *SharedRepository) GetAllPosts() ([]Post, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetAllPosts()
+}
+
+func (repo *SharedRepository) GetUserPosts(userLogin string) ([]Post, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetUserPosts(userLogin)
+}
+
+func (repo *SharedRepository) GetByAuthors(userLogins []string) (map[string][]Post, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetByAuthors(userLogins)
+}
+
+func (repo *SharedRepository) GetByURL(rawURL string) ([]Post, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetByURL(rawURL)
+}
+
+func (repo *SharedRepository) GetScheduled() ([]Post, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetScheduled()
+}
+
+// Revision of an unreachable store is the last one seen, the cache may serve it a little longer
+func (repo *SharedRepository) Revision() (uint64, time.Time) {
+	repo.shared.Sync()
+	return repo.local.Revision()
+}
+
+// =============================== POST ===============================
+func (repo *SharedRepository) Create(post Post) (Post, error) {
+	prepared := prepare(post)
+	created := Post{}
+	errWrite := repo.shared.Write(func() error {
+		created = repo.local.insert(prepared)
+		return nil
+	})
+	return created, errWrite
+}
+
+// Update renders a changed text outside the lock of the store, like the memory repository does
+func (repo *SharedRepository) Update(postID string, version uint64, fn func(post *Post) error) (Post, error) {
+	html := rendered{}
+	for {
+		updated := Post{}
+		errWrite := repo.shared.Write(func() (errUpdate error) {
+			updated, errUpdate = repo.local.update(postID, version, fn, html)
+			return errUpdate
+		})
+		if errWrite != errNotRendered {
+			return updated, errWrite
+		}
+		html = rendered{src: updated.Text, html: markdown.Render(updated.Text)}
+	}
+}
+
+func (repo *SharedRepository) UpdateVote(vote int, postID string, author *user.User) (updated Post, errWrite error) {
+	errWrite = repo.shared.Write(func() (errVote error) {
+		updated, errVote = repo.local.UpdateVote(vote, postID, author)
+		return errVote
+	})
+	return updated, errWrite
+}
+
+func (repo *SharedRepository) AddCommentCount(postID string, delta int) (updated Post, errWrite error) {
+	errWrite = repo.shared.Write(func() (errAdd error) {
+		updated, errAdd = repo.local.AddCommentCount(postID, delta)
+		return errAdd
+	})
+	return updated, errWrite
+}
+
+func (repo *SharedRepository) Anonymize(userLogin string) (anonymized int, errWrite error) {
+	errWrite = repo.shared.Write(func() (errAnonymize error) {
+		anonymized, errAnonymize = repo.local.Anonymize(userLogin)
+		return errAnonymize
+	})
+	return anonymized, errWrite
+}
+
+func (repo *SharedRepository) RemoveVotes(userID string) (removed int, errWrite error) {
+	errWrite = repo.shared.Write(func() (errRemove error) {
+		removed, errRemove = repo.local.RemoveVotes(userID)
+		return errRemove
+	})
+	return removed, errWrite
+}
+
+func (repo *SharedRepository) AddViews(postID string, unique, total int) error {
+	return repo.shared.Write(func() error {
+		return repo.local.AddViews(postID, unique, total)
+	})
+}
+
+// AddViewsBatch saves the views of a whole flush at once, views of deleted posts are dropped
+func (repo *SharedRepository) AddViewsBatch(counts map[string]*views.Counts) error {
+	return repo.shared.Write(func() error {
+		for postID, postCounts := range counts {
+			repo.local.AddViews(postID, postCounts.Unique, postCounts.Total)
+		}
+		return nil
+	})
+}
+
+// ============================== DELETE ==============================
+func (repo *SharedRepository) Delete(postID string) (deleted bool, errWrite error) {
+	errWrite = repo.shared.Write(func() (errDelete error) {
+		deleted, errDelete = repo.local.Delete(postID)
+		return errDelete
+	})
+	return deleted, errWrite
+}
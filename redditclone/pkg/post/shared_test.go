@@ -0,0 +1,101 @@
+package post
+
+import (
+	"testing"
+	"time"
+
+	"redditclone/pkg/kv"
+	"redditclone/pkg/user"
+	"redditclone/pkg/views"
+)
+
+func TestSharedRepoAcrossInstances(t *testing.T) {
+	store := kv.NewMemoryStore()
+	var first, second PostRepo = NewSharedRepo(store), NewSharedRepo(store)
+	now := time.Now()
+
+	poll, err := NewPoll([]string{"yes", "no"}, "", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	asked, err := first.Create(Post{
+		Author:   user.User{ID: "author", Login: "author"},
+		Category: "news",
+		Title:    "question",
+		Type:     TypePoll,
+		Poll:     poll,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	linked, err := second.Create(Post{
+		Author:   user.User{ID: "author", Login: "author"},
+		Category: "news",
+		Title:    "link",
+		Type:     "link",
+		URL:      "https://example.com/a",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err = second.Update(asked.ID, AnyVersion, func(post *Post) error {
+		return CastPollVote(post, "voter", 1, now)
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = first.UpdateVote(1, linked.ID, &user.User{ID: "voter", Login: "voter"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, repo := range map[string]PostRepo{"first": first, "second": second} {
+		posts, _ := repo.GetCategory("news")
+		if len(posts) != 2 || posts[0].ID != asked.ID || posts[1].ID != linked.ID {
+			t.Errorf("%s: got posts %+v", name, posts)
+			continue
+		}
+		results := posts[0].Poll.Results("voter", now)
+		if !results.Voted || *results.Choice != 1 || *results.Total != 1 {
+			t.Errorf("%s: poll ballots were lost: %+v", name, results)
+		}
+		if posts[1].Score != 1 || len(posts[0].Tags) != 0 || posts[0].Tags == nil {
+			t.Errorf("%s: got score %d and tags %#v", name, posts[1].Score, posts[0].Tags)
+		}
+		if byURL, _ := repo.GetByURL("https://example.com/a"); len(byURL) != 1 {
+			t.Errorf("%s: url index was not rebuilt", name)
+		}
+	}
+	// the response cache of every instance keys on the same revision
+	if firstRevision, _ := first.Revision(); firstRevision != 4 {
+		t.Errorf("got revision %d, expected 4", firstRevision)
+	}
+	firstRevision, firstModified := first.Revision()
+	secondRevision, secondModified := second.Revision()
+	if firstRevision != secondRevision || !firstModified.Equal(secondModified) {
+		t.Errorf("instances disagree on the revision: %d and %d", firstRevision, secondRevision)
+	}
+
+	counter := views.NewCounter(second, time.Hour)
+	counter.Record(asked.ID, "viewer")
+	counter.Record("deleted", "viewer")
+	if err = counter.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if viewed, _ := first.Get(asked.ID); viewed.Views != 1 {
+		t.Errorf("got %d views, expected 1", viewed.Views)
+	}
+
+	if _, err = first.Delete(asked.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = second.Get(asked.ID); err != ErrNoPost {
+		t.Errorf("deleted post got %v", err)
+	}
+	created, err := second.Create(Post{Author: user.User{ID: "author", Login: "author"}, Category: "news", Title: "new", Type: "text"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if posts, _ := first.GetAllPosts(); len(posts) != 2 || posts[1].ID != created.ID {
+		t.Errorf("the newest post is not the last one: %+v", posts)
+	}
+}
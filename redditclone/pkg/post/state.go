@@ -0,0 +1,80 @@
+package post
+
+import "errors"
+
+// Transitions moderators apply to posts
+const (
+	ActionLock      = "lock"
+	ActionUnlock    = "unlock"
+	ActionPin       = "pin"
+	ActionUnpin     = "unpin"
+	ActionArchive   = "archive"
+	ActionUnarchive = "unarchive"
+)
+
+// MaxPinned is the number of posts a category can pin at once
+const MaxPinned = 2
+
+var (
+	ErrLocked      = errors.New("post is locked")
+	ErrBadAction   = errors.New("unknown post state action")
+	ErrPinArchived = errors.New("archived posts cant be pinned")
+	ErrTooManyPins = errors.New("too many pinned posts in the category")
+	ErrScheduled   = errors.New("scheduled posts cant change state before publishing")
+)
+
+// CanComment is false for locked and archived posts
+func (p Post) CanComment() bool {
+	return !p.Locked && !p.Archived
+}
+
+// CanVote is false for archived posts, voting on locked threads is still allowed
+func (p Post) CanVote() bool {
+	return !p.Archived
+}
+
+// ApplyAction moves the post to a new state. Archiving unpins the post, unarchiving
+// drops the expiry so the scheduler does not archive the post again.
+func ApplyAction(post *Post, action string) error {
+	if post.Scheduled {
+		return ErrScheduled
+	}
+	switch action {
+	case ActionLock:
+		post.Locked = true
+	case ActionUnlock:
+		post.Locked = false
+	case ActionPin:
+		if post.Archived {
+			return ErrPinArchived
+		}
+		post.Pinned = true
+	case ActionUnpin:
+		post.Pinned = false
+	case ActionArchive:
+		post.Archived = true
+		post.Pinned = false
+	case ActionUnarchive:
+		post.Archived = false
+		post.ExpiresAt = ""
+	default:
+		return ErrBadAction
+	}
+	return nil
+}
+
+// PinnedFirst moves pinned posts to the front keeping the order within both groups
+func PinnedFirst(posts []Post) []Post {
+	sorted := make([]Post, 0, len(posts))
+	for _, item := range posts {
+		if item.Pinned {
+			sorted = append(sorted, item)
+		}
+	}
+	for _, item := range posts {
+		if !item.Pinned {
+			sorted = append(sorted, item)
+		}
+	}
+	return sorted
+}
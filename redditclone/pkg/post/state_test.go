@@ -0,0 +1,107 @@
+package post
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestApplyAction(t *testing.T) {
+	item := Post{ExpiresAt: "2024-01-01T00:00:00Z"}
+	steps := []struct {
+		action string
+		err    error
+		check  func(Post) bool
+	}{
+		{ActionLock, nil, func(p Post) bool { return p.Locked && !p.CanComment() && p.CanVote() }},
+		{ActionPin, nil, func(p Post) bool { return p.Pinned }},
+		{ActionArchive, nil, func(p Post) bool { return p.Archived && !p.Pinned && !p.CanVote() }},
+		{ActionPin, ErrPinArchived, func(p Post) bool { return !p.Pinned }},
+		{ActionUnarchive, nil, func(p Post) bool { return !p.Archived && p.ExpiresAt == "" }},
+		{ActionUnlock, nil, func(p Post) bool { return p.CanComment() }},
+		{"explode", ErrBadAction, func(p Post) bool { return true }},
+	}
+	for _, step := range steps {
+		if err := ApplyAction(&item, step.action); err != step.err {
+			t.Fatalf("%s: expected %v, got %v", step.action, step.err, err)
+		}
+		if !step.check(item) {
+			t.Errorf("%s: bad state %+v", step.action, item)
+		}
+	}
+
+	scheduled := Post{Scheduled: true}
+	if err := ApplyAction(&scheduled, ActionPin); err != ErrScheduled {
+		t.Errorf("expected ErrScheduled, got %v", err)
+	}
+}
+
+func TestPinnedFirst(t *testing.T) {
+	posts := []Post{{ID: "a"}, {ID: "b", Pinned: true}, {ID: "c"}, {ID: "d", Pinned: true}}
+	sorted := PinnedFirst(posts)
+	order := ""
+	for _, item := range sorted {
+		order += item.ID
+	}
+	if order != "bdac" {
+		t.Errorf("got order %s, expected bdac", order)
+	}
+}
+
+func TestCreateStartsUnpinnedAndUnlocked(t *testing.T) {
+	created, err := NewMemoryRepo().Create(Post{Title: "announcement", Pinned: true, Locked: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created.Pinned || created.Locked {
+		t.Errorf("new post skipped the moderators: %+v", created)
+	}
+}
+
+func TestConcurrentPinsKeepLimit(t *testing.T) {
+	repo := NewMemoryRepo()
+	const posts = 20
+	ids := make([]string, posts)
+	for i := range ids {
+		ids[i] = newTestPost(t, repo).ID
+	}
+	pinned := int32(0)
+	wg := &sync.WaitGroup{}
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			_, err := repo.Update(id, AnyVersion, func(post *Post) error {
+				return ApplyAction(post, ActionPin)
+			})
+			switch err {
+			case nil:
+				atomic.AddInt32(&pinned, 1)
+			case ErrTooManyPins:
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(id)
+	}
+	wg.Wait()
+	if pinned != MaxPinned {
+		t.Errorf("%d pins succeeded, expected %d", pinned, MaxPinned)
+	}
+	inCategory, _ := repo.GetCategory("music")
+	stored := 0
+	for _, item := range inCategory {
+		if item.Pinned {
+			stored++
+		}
+	}
+	if stored != MaxPinned {
+		t.Errorf("category has %d pinned posts, expected %d", stored, MaxPinned)
+	}
+	// pinning a pinned post again does not take another place
+	first := PinnedFirst(inCategory)[0]
+	if _, err := repo.Update(first.ID, AnyVersion, func(post *Post) error {
+		return ApplyAction(post, ActionPin)
+	}); err != nil {
+		t.Errorf("pinning a pinned post got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package post
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// trackingParams are dropped from the query so that shared links from different sources match
+var trackingParams = map[string]bool{
+	"utm_source":   true,
+	"utm_medium":   true,
+	"utm_campaign": true,
+	"utm_term":     true,
+	"utm_content":  true,
+	"fbclid":       true,
+	"gclid":        true,
+}
+
+// NormalizeURL brings a link to the form used for duplicate detection.
+// Links that cannot be parsed are only trimmed and lowercased.
+func NormalizeURL(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	link, errParse := url.Parse(rawURL)
+	if errParse != nil || link.Host == "" {
+		return strings.ToLower(rawURL)
+	}
+
+	host := strings.ToLower(link.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	port := link.Port()
+	if port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	query := link.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if !trackingParams[strings.ToLower(key)] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+
+	// http and https versions of the same page are the same discussion
+	normalized := host + strings.TrimRight(link.EscapedPath(), "/")
+	if len(params) > 0 {
+		normalized += "?" + strings.Join(params, "&")
+	}
+	return normalized
+}
@@ -1,52 +1,88 @@
 package session
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"net/http"
+	"redditclone/pkg/kv"
 	"redditclone/pkg/user"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 )
 
-type SessionsManager struct{}
+const (
+	// challengeTTL bounds the time between the password and the second factor
+	challengeTTL = 5 * time.Minute
+	// a challenge is dropped after challengeAttempts codes, the password has to be entered again
+	challengeAttempts = 3
+	tokenTTL          = 20 * time.Minute
+	// open challenges are kept under challengePrefix until used, dropped or expired
+	challengePrefix = "session:challenge:"
+	// revocations are kept in the store under revokedPrefix and announced on revokedChannel
+	revokedPrefix  = "session:revoked:"
+	revokedChannel = "session:revoked"
+)
 
-func NewSessionsManager() *SessionsManager {
-	return &SessionsManager{}
+// SessionsManager keeps revocations in the store shared by all instances
+type SessionsManager struct {
+	Store kv.Store
+	// revoked caches the moment in unix milliseconds after which tokens of the user are valid again,
+	// 0 means never revoked.
+	// The cache is used only while Listen hears the revocations made by other instances.
+	revoked   map[string]int64
+	listening bool
+	mutex     sync.RWMutex
 }
 
-func (sm *SessionsManager) Check(w http.ResponseWriter, r *http.Request) (*Session, error) {
+func NewSessionsManager(store kv.Store) *SessionsManager {
+	return &SessionsManager{
+		Store:   store,
+		revoked: make(map[string]int64),
+		mutex:   sync.RWMutex{},
+	}
+}
 
-	hashSecretGetter := func(token *jwt.Token) (interface{}, error) {
-		method, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok || method.Alg() != "HS256" {
-			return nil, fmt.Errorf("bad sign method")
-		}
-		return ExampleTokenSecret, nil
+func hashSecretGetter(token *jwt.Token) (interface{}, error) {
+	method, ok := token.Method.(*jwt.SigningMethodHMAC)
+	if !ok || method.Alg() != "HS256" {
+		return nil, fmt.Errorf("bad sign method")
 	}
+	return ExampleTokenSecret, nil
+}
 
-	inToken := r.Header.Get("authorization")
-	if inToken == "" {
-		return nil, ErrNoAuth
+func (sm *SessionsManager) Check(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	inToken, errToken := requestToken(r)
+	if errToken != nil {
+		return nil, errToken
 	}
-	inToken = strings.Split(inToken, " ")[1]
 	token, errJwt := jwt.Parse(inToken, hashSecretGetter)
 	if errJwt != nil {
 		return nil, errJwt
 	}
 	payload, ok := token.Claims.(jwt.MapClaims)
 
-	if ok {
-		sessClaims := payload["user"].(map[string]interface{})
-
-		sess := &Session{}
-		sess.UserID = sessClaims["id"].(string)
-		sess.UserLogin = sessClaims["username"].(string)
-
-		return sess, nil
+	if !ok {
+		return nil, ErrNoAuth
+	}
+	// challenge tokens carry no "user" claim and must not open a session
+	sessClaims, ok := payload["user"].(map[string]interface{})
+	if !ok {
+		return nil, ErrNoAuth
+	}
+	sess := &Session{}
+	sess.UserID, _ = sessClaims["id"].(string)
+	sess.UserLogin, _ = sessClaims["username"].(string)
+	if sess.UserID == "" || sess.UserLogin == "" || sm.isRevoked(sess.UserID, payload) {
+		return nil, ErrNoAuth
 	}
-	return nil, ErrNoAuth
+
+	return sess, nil
 }
 
 func (sm *SessionsManager) Create(curUser user.User) (*Session, error) {
@@ -60,10 +96,230 @@ func (sm *SessionsManager) CreateToken(sess *Session) (string, error) {
 			"username": sess.UserLogin,
 			"id":       sess.UserID,
 		},
-		"iat": time.Now().Unix(),
-		"exp": time.Now().Unix() + 1200,
+		"iat": numericDate(time.Now()),
+		"exp": time.Now().Add(tokenTTL).Unix(),
 	})
 	tokenString, err := token.SignedString(ExampleTokenSecret)
 
 	return tokenString, err
 }
+
+func (sm *SessionsManager) CreateCookie(w http.ResponseWriter, sess *Session) error {
+	tokenString, errToken := sm.CreateToken(sess)
+	if errToken != nil {
+		return errToken
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    tokenString,
+		Path:     "/",
+		MaxAge:   int(tokenTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// DestroyCookie only makes the browser forget the token, DestroyAll revokes it
+func (sm *SessionsManager) DestroyCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (sm *SessionsManager) CreateChallenge(curUser user.User) (string, error) {
+	challengeID := uuid.New().String()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"challenge": map[string]interface{}{
+			"username": curUser.Login,
+			"id":       curUser.ID,
+		},
+		"jti": challengeID,
+		"iat": numericDate(time.Now()),
+		"exp": time.Now().Add(challengeTTL).Unix(),
+	})
+	errSet := sm.Store.Set(challengePrefix+challengeID, "0", challengeTTL)
+	if errSet != nil {
+		return "", errSet
+	}
+	return token.SignedString(ExampleTokenSecret)
+}
+
+// CheckChallenge counts an attempt of the challenge, the challenge is dropped once it had
+// challengeAttempts of them. Store failures are returned as they are.
+func (sm *SessionsManager) CheckChallenge(challenge string) (user.User, error) {
+	curUser, challengeID, errParse := sm.parseChallenge(challenge)
+	if errParse != nil {
+		return user.User{}, errParse
+	}
+	key := challengePrefix + challengeID
+	_, errGet := sm.Store.Get(key)
+	switch errGet {
+	case nil:
+	case kv.ErrNoKey:
+		return user.User{}, ErrBadChallenge
+	default:
+		return user.User{}, errGet
+	}
+	attempts, errIncr := sm.Store.Incr(key+":attempts", challengeTTL)
+	if errIncr != nil {
+		return user.User{}, errIncr
+	}
+	if attempts > challengeAttempts {
+		sm.Store.Del(key)
+		return user.User{}, ErrBadChallenge
+	}
+	return curUser, nil
+}
+
+// ConsumeChallenge ends the challenge once its code is accepted, only one caller succeeds
+func (sm *SessionsManager) ConsumeChallenge(challenge string) error {
+	_, challengeID, errParse := sm.parseChallenge(challenge)
+	if errParse != nil {
+		return errParse
+	}
+	_, errGetDel := sm.Store.GetDel(challengePrefix + challengeID)
+	switch errGetDel {
+	case nil:
+		return nil
+	case kv.ErrNoKey:
+		return ErrBadChallenge
+	default:
+		return errGetDel
+	}
+}
+
+// DestroyAll ends every session of the user issued so far, on all instances
+func (sm *SessionsManager) DestroyAll(userID string) error {
+	revokedAt := time.Now().UnixMilli()
+	value := strconv.FormatInt(revokedAt, 10)
+	// older tokens are expired once tokenTTL passes, the mark is not needed after that
+	errSet := sm.Store.Set(revokedPrefix+userID, value, tokenTTL)
+	if errSet != nil {
+		return errSet
+	}
+	sm.cache(userID, revokedAt, true)
+	return sm.Store.Publish(revokedChannel, userID+" "+value)
+}
+
+// Listen keeps the cache in sync with revocations of other instances until ctx is done
+// or the subscription breaks, then the store is asked on every check until the next Listen
+func (sm *SessionsManager) Listen(ctx context.Context) error {
+	messages, errSubscribe := sm.Store.Subscribe(ctx, revokedChannel)
+	if errSubscribe != nil {
+		return errSubscribe
+	}
+	sm.setListening(true)
+	defer sm.setListening(false)
+	for message := range messages {
+		userID, value, _ := strings.Cut(message, " ")
+		revokedAt, errParse := strconv.ParseInt(value, 10, 64)
+		if errParse != nil {
+			continue
+		}
+		sm.cache(userID, revokedAt, true)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return ErrNotListening
+}
+
+// parseChallenge checks the signature and the claims, the store is not asked
+func (sm *SessionsManager) parseChallenge(challenge string) (user.User, string, error) {
+	token, errJwt := jwt.Parse(challenge, hashSecretGetter)
+	if errJwt != nil {
+		return user.User{}, "", ErrBadChallenge
+	}
+	payload, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return user.User{}, "", ErrBadChallenge
+	}
+	claims, ok := payload["challenge"].(map[string]interface{})
+	if !ok {
+		return user.User{}, "", ErrBadChallenge
+	}
+	challengeID, _ := payload["jti"].(string)
+	curUser := user.User{}
+	curUser.ID, _ = claims["id"].(string)
+	curUser.Login, _ = claims["username"].(string)
+	if challengeID == "" || curUser.ID == "" || curUser.Login == "" || sm.isRevoked(curUser.ID, payload) {
+		return user.User{}, "", ErrBadChallenge
+	}
+	return curUser, challengeID, nil
+}
+
+// requestToken prefers the authorization header, the cookie is read only without it
+func requestToken(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		inToken, ok := BearerToken(header)
+		if !ok {
+			return "", ErrBadHeader
+		}
+		return inToken, nil
+	}
+	cookie, errCookie := r.Cookie(CookieName)
+	if errCookie != nil || cookie.Value == "" {
+		return "", ErrNoAuth
+	}
+	return cookie.Value, nil
+}
+
+// isRevoked fails closed, tokens are refused while the store is unreachable
+func (sm *SessionsManager) isRevoked(userID string, payload jwt.MapClaims) bool {
+	sm.mutex.RLock()
+	revokedAt, ok := sm.revoked[userID]
+	sm.mutex.RUnlock()
+	if !ok {
+		value, errGet := sm.Store.Get(revokedPrefix + userID)
+		switch errGet {
+		case nil:
+			parsed, errParse := strconv.ParseInt(value, 10, 64)
+			if errParse != nil {
+				return true
+			}
+			revokedAt = parsed
+		case kv.ErrNoKey:
+			revokedAt = 0
+		default:
+			return true
+		}
+		sm.cache(userID, revokedAt, false)
+	}
+	issuedAt, _ := payload["iat"].(float64)
+	return revokedAt != 0 && int64(math.Round(issuedAt*1000)) <= revokedAt
+}
+
+// numericDate keeps the milliseconds in "iat", a login right after "log out everywhere"
+// must not fall into the second of the revocation. JWT allows fractional dates.
+func numericDate(at time.Time) float64 {
+	return float64(at.UnixMilli()) / 1000
+}
+
+// cache remembers the revocation while listening. Announced revocations replace older ones,
+// values read from the store never replace anything, an announcement may have come meanwhile.
+func (sm *SessionsManager) cache(userID string, revokedAt int64, announced bool) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	if !sm.listening {
+		return
+	}
+	cached, ok := sm.revoked[userID]
+	if !ok || announced && revokedAt > cached {
+		sm.revoked[userID] = revokedAt
+	}
+}
+
+func (sm *SessionsManager) setListening(listening bool) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.listening = listening
+	// revocations missed before the subscription started are only in the store
+	sm.revoked = make(map[string]int64)
+}
@@ -0,0 +1,178 @@
+package session
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"redditclone/pkg/kv"
+	"redditclone/pkg/kv/kvtest"
+	"redditclone/pkg/user"
+)
+
+func TestRevocationIsShared(t *testing.T) {
+	server, err := kvtest.NewServer()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer server.Close()
+	first := NewSessionsManager(kv.NewRedisStore(server.Addr, 2))
+	second := NewSessionsManager(kv.NewRedisStore(server.Addr, 2))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go second.Listen(ctx)
+
+	curUser := user.User{ID: "id", Login: "login"}
+	sess, _ := first.Create(curUser)
+	tokenString, err := first.CreateToken(sess)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	check := func(sm *SessionsManager) error {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+tokenString)
+		_, errCheck := sm.Check(httptest.NewRecorder(), r)
+		return errCheck
+	}
+	// the second check is served from the cache once the listener is up
+	deadline := time.Now().Add(time.Second)
+	for !second.isListening() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err = check(second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = first.DestroyAll(curUser.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = check(first); err != ErrNoAuth {
+		t.Errorf("expected ErrNoAuth on the revoking instance, got %v", err)
+	}
+	for check(second) == nil && time.Now().Before(deadline.Add(time.Second)) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err = check(second); err != ErrNoAuth {
+		t.Errorf("expected ErrNoAuth on the other instance, got %v", err)
+	}
+}
+
+func (sm *SessionsManager) isListening() bool {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.listening
+}
+
+func TestCheckParsesHeader(t *testing.T) {
+	sm := NewSessionsManager(kv.NewMemoryStore())
+	sess, _ := sm.Create(user.User{ID: "id", Login: "login"})
+	tokenString, err := sm.CreateToken(sess)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cases := []struct {
+		header string
+		err    error
+	}{
+		{"", ErrNoAuth},
+		{"Bearer", ErrBadHeader},
+		{"Bearer ", ErrBadHeader},
+		{tokenString, ErrBadHeader},
+		{"Basic " + tokenString, ErrBadHeader},
+		{"Bearer " + tokenString + " extra", ErrBadHeader},
+		{"Bearer " + tokenString, nil},
+		{"bearer  " + tokenString, nil},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tc.header != "" {
+			r.Header.Set("Authorization", tc.header)
+		}
+		got, errCheck := sm.Check(httptest.NewRecorder(), r)
+		if errCheck != tc.err {
+			t.Errorf("header %q: got %v, expected %v", tc.header, errCheck, tc.err)
+		}
+		if tc.err == nil && (got == nil || got.UserLogin != "login") {
+			t.Errorf("header %q: got session %+v", tc.header, got)
+		}
+	}
+}
+
+func TestCookieMode(t *testing.T) {
+	sm := NewSessionsManager(kv.NewMemoryStore())
+	sess, _ := sm.Create(user.User{ID: "id", Login: "login"})
+	recorder := httptest.NewRecorder()
+	if err := sm.CreateCookie(recorder, sess); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CookieName || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("got cookies %+v, expected one HttpOnly secure session cookie", cookies)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	if got, err := sm.Check(httptest.NewRecorder(), r); err != nil || got.UserID != "id" {
+		t.Errorf("cookie session: got %+v, %v", got, err)
+	}
+	// a header, even a broken one, takes precedence over the cookie
+	r.Header.Set("Authorization", "Bearer")
+	if _, err := sm.Check(httptest.NewRecorder(), r); err != ErrBadHeader {
+		t.Errorf("expected ErrBadHeader, got %v", err)
+	}
+
+	recorder = httptest.NewRecorder()
+	sm.DestroyCookie(recorder)
+	if cleared := recorder.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+		t.Errorf("cookie is not cleared: %+v", cleared)
+	}
+}
+
+func TestChallengeAttempts(t *testing.T) {
+	sm := NewSessionsManager(kv.NewMemoryStore())
+	curUser := user.User{ID: "id", Login: "login"}
+	challenge, err := sm.CreateChallenge(curUser)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := 0; i < challengeAttempts; i++ {
+		if _, err = sm.CheckChallenge(challenge); err != nil {
+			t.Fatalf("attempt %d: unexpected error: %v", i, err)
+		}
+	}
+	if _, err = sm.CheckChallenge(challenge); err != ErrBadChallenge {
+		t.Errorf("attempt over the limit: expected ErrBadChallenge, got %v", err)
+	}
+
+	challenge, _ = sm.CreateChallenge(curUser)
+	if err = sm.ConsumeChallenge(challenge); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = sm.ConsumeChallenge(challenge); err != ErrBadChallenge {
+		t.Errorf("challenge used twice: expected ErrBadChallenge, got %v", err)
+	}
+	if _, err = sm.CheckChallenge(challenge); err != ErrBadChallenge {
+		t.Errorf("used challenge: expected ErrBadChallenge, got %v", err)
+	}
+}
+
+func TestLoginAfterRevocation(t *testing.T) {
+	sm := NewSessionsManager(kv.NewMemoryStore())
+	curUser := user.User{ID: "id", Login: "login"}
+	if err := sm.DestroyAll(curUser.ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a new login within the same second as the revocation keeps working
+	time.Sleep(2 * time.Millisecond)
+	sess, _ := sm.Create(curUser)
+	tokenString, err := sm.CreateToken(sess)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+tokenString)
+	if _, err = sm.Check(httptest.NewRecorder(), r); err != nil {
+		t.Errorf("token issued after the revocation was refused: %v", err)
+	}
+}
@@ -7,18 +7,39 @@ import (
 	"fmt"
 	"net/http"
 	"redditclone/pkg/user"
+	"strings"
 )
 
+// CookieName holds the token of browser clients that chose the cookie mode
+const CookieName = "session"
+
 type Session struct {
 	ID        string
 	UserID    string
 	UserLogin string
+	// Scopes limit sessions opened with an API token, nil means full access
+	Scopes []string
+}
+
+func (s *Session) HasScope(scope string) bool {
+	if s.Scopes == nil {
+		return true
+	}
+	for _, item := range s.Scopes {
+		if item == scope {
+			return true
+		}
+	}
+	return false
 }
 
 type sessKey string
 
 var (
 	ErrNoAuth                  = errors.New("no session found")
+	ErrBadHeader               = errors.New("malformed authorization header")
+	ErrBadChallenge            = errors.New("bad or expired login challenge")
+	ErrNotListening            = errors.New("revocation subscription ended")
 	SessionKey         sessKey = "sessionKey"
 	ExampleTokenSecret         = []byte("супер секретный ключ")
 )
@@ -36,6 +57,16 @@ func NewSession(currUser user.User) *Session {
 	}
 }
 
+// BearerToken parses "Bearer <token>", the scheme is case-insensitive
+func BearerToken(header string) (string, bool) {
+	scheme, value, found := strings.Cut(strings.TrimSpace(header), " ")
+	value = strings.TrimSpace(value)
+	if !found || !strings.EqualFold(scheme, "Bearer") || value == "" || strings.ContainsAny(value, " \t") {
+		return "", false
+	}
+	return value, true
+}
+
 func SessionFromContext(ctx context.Context) (*Session, error) {
 	sess, ok := ctx.Value(SessionKey).(*Session)
 	if !ok || sess == nil {
@@ -52,4 +83,14 @@ type SessRepo interface {
 	Create(user user.User) (*Session, error)
 	Check(w http.ResponseWriter, r *http.Request) (*Session, error)
 	CreateToken(sess *Session) (string, error)
+	// CreateCookie sets the token as an HttpOnly cookie instead of handing it to scripts,
+	// Check accepts it when the request has no authorization header
+	CreateCookie(w http.ResponseWriter, sess *Session) error
+	DestroyCookie(w http.ResponseWriter)
+	// CreateChallenge issues a short-lived token proving the password step of a two-factor login.
+	// CheckChallenge allows a few codes per challenge, ConsumeChallenge makes it single-use.
+	CreateChallenge(user user.User) (string, error)
+	CheckChallenge(challenge string) (user.User, error)
+	ConsumeChallenge(challenge string) error
+	DestroyAll(userID string) error
 }
@@ -0,0 +1,118 @@
+package spam
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	errUnmarsh := json.Unmarshal(data, &raw)
+	if errUnmarsh != nil {
+		return errUnmarsh
+	}
+	parsed, errParse := time.ParseDuration(raw)
+	if errParse != nil {
+		return errParse
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// RulesConfig turns on every rule whose settings are non-zero. Verdict applies to
+// the account age, karma and duplicate rules, blocked domains and the rate limit always reject.
+type RulesConfig struct {
+	MinAccountAge   Duration `json:"minAccountAge"`
+	MinKarma        *int     `json:"minKarma"`
+	BlockedDomains  []string `json:"blockedDomains"`
+	DuplicateWindow Duration `json:"duplicateWindow"`
+	RateLimit       int      `json:"rateLimit"`
+	RatePer         Duration `json:"ratePer"`
+	Verdict         string   `json:"verdict"`
+}
+
+type Config struct {
+	Default    RulesConfig            `json:"default"`
+	Categories map[string]RulesConfig `json:"categories"`
+}
+
+// DefaultConfig only stops authors repeating themselves and flooding, the account
+// age and karma gates hide content of honest newcomers too, so they are opt-in
+func DefaultConfig() Config {
+	return Config{
+		Default: RulesConfig{
+			DuplicateWindow: Duration(time.Hour),
+			RateLimit:       10,
+			RatePer:         Duration(10 * time.Minute),
+			Verdict:         ShadowHide.String(),
+		},
+	}
+}
+
+func LoadConfig(path string) (Config, error) {
+	data, errRead := os.ReadFile(path)
+	if errRead != nil {
+		return Config{}, errRead
+	}
+	config := Config{}
+	errUnmarsh := json.Unmarshal(data, &config)
+	if errUnmarsh != nil {
+		return Config{}, errUnmarsh
+	}
+	return config, nil
+}
+
+// Pipeline keeps the state of the rate and duplicate rules in the store
+func (c Config) Pipeline(store kv.Store) (*Pipeline, error) {
+	defaults, errRules := c.Default.Rules(store)
+	if errRules != nil {
+		return nil, fmt.Errorf("default rules: %w", errRules)
+	}
+	pipeline := NewPipeline(defaults...)
+	for category, rulesConfig := range c.Categories {
+		rules, errRules := rulesConfig.Rules(store)
+		if errRules != nil {
+			return nil, fmt.Errorf("rules of %q: %w", category, errRules)
+		}
+		pipeline.SetCategoryRules(category, rules...)
+	}
+	return pipeline, nil
+}
+
+func (c RulesConfig) Rules(store kv.Store) ([]Rule, error) {
+	verdict := ShadowHide
+	switch c.Verdict {
+	case "", ShadowHide.String():
+	case Reject.String():
+		verdict = Reject
+	default:
+		return nil, fmt.Errorf("unknown verdict %q", c.Verdict)
+	}
+
+	rules := make([]Rule, 0, 5)
+	if c.MinAccountAge > 0 {
+		rules = append(rules, &AccountAgeRule{MinAge: time.Duration(c.MinAccountAge), Verdict: verdict})
+	}
+	if c.MinKarma != nil {
+		rules = append(rules, &KarmaRule{MinKarma: *c.MinKarma, Verdict: verdict})
+	}
+	if len(c.BlockedDomains) > 0 {
+		rules = append(rules, NewDomainBlocklistRule(c.BlockedDomains...))
+	}
+	if c.DuplicateWindow > 0 {
+		rules = append(rules, NewDuplicateTextRule(store, time.Duration(c.DuplicateWindow), verdict))
+	}
+	if c.RateLimit > 0 {
+		if c.RatePer <= 0 {
+			return nil, fmt.Errorf("rateLimit needs ratePer")
+		}
+		rules = append(rules, NewRateLimitRule(store, c.RateLimit, time.Duration(c.RatePer), Reject))
+	}
+	return rules, nil
+}
@@ -0,0 +1,161 @@
+package spam
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+// ============================== ACCOUNT ==============================
+type AccountAgeRule struct {
+	MinAge  time.Duration
+	Verdict Verdict
+}
+
+func (rule *AccountAgeRule) Name() string { return "account_age" }
+
+func (rule *AccountAgeRule) Check(content Content) Result {
+	if content.AccountAge < rule.MinAge {
+		return Result{
+			Verdict: rule.Verdict,
+			Reason:  fmt.Sprintf("account must be at least %s old", rule.MinAge),
+		}
+	}
+	return Result{Verdict: Allow}
+}
+
+type KarmaRule struct {
+	MinKarma int
+	Verdict  Verdict
+}
+
+func (rule *KarmaRule) Name() string { return "karma" }
+
+func (rule *KarmaRule) Check(content Content) Result {
+	if content.Karma < rule.MinKarma {
+		return Result{
+			Verdict: rule.Verdict,
+			Reason:  fmt.Sprintf("at least %d karma required", rule.MinKarma),
+		}
+	}
+	return Result{Verdict: Allow}
+}
+
+// ============================== CONTENT ==============================
+// DomainBlocklistRule rejects links to the listed domains and all their subdomains
+type DomainBlocklistRule struct {
+	domains map[string]bool
+}
+
+func NewDomainBlocklistRule(domains ...string) *DomainBlocklistRule {
+	rule := &DomainBlocklistRule{
+		domains: make(map[string]bool, len(domains)),
+	}
+	for _, domain := range domains {
+		rule.domains[strings.ToLower(strings.TrimPrefix(domain, "www."))] = true
+	}
+	return rule
+}
+
+func (rule *DomainBlocklistRule) Name() string { return "domain_blocklist" }
+
+func (rule *DomainBlocklistRule) Check(content Content) Result {
+	if content.URL == "" {
+		return Result{Verdict: Allow}
+	}
+	rawURL := content.URL
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	link, errParse := url.Parse(rawURL)
+	if errParse != nil {
+		return Result{Verdict: Reject, Reason: "bad url"}
+	}
+	host := strings.ToLower(link.Hostname())
+	for host != "" {
+		if rule.domains[host] {
+			return Result{Verdict: Reject, Reason: "domain is blocked"}
+		}
+		dot := strings.Index(host, ".")
+		if dot < 0 {
+			break
+		}
+		host = host[dot+1:]
+	}
+	return Result{Verdict: Allow}
+}
+
+// DuplicateTextRule flags texts the same author already submitted to the same category within
+// the window. Short replies like "thanks" are common enough to be posted by many people, and
+// crossposts carry the text of their original into other categories.
+type DuplicateTextRule struct {
+	Window  time.Duration
+	Verdict Verdict
+
+	store kv.Store
+}
+
+func NewDuplicateTextRule(store kv.Store, window time.Duration, verdict Verdict) *DuplicateTextRule {
+	return &DuplicateTextRule{
+		Window:  window,
+		Verdict: verdict,
+		store:   store,
+	}
+}
+
+func (rule *DuplicateTextRule) Name() string { return "duplicate_text" }
+
+// Check lets content through when the store fails, spam rules must not take the site down
+func (rule *DuplicateTextRule) Check(content Content) Result {
+	text := normalizeText(content.Text)
+	if text == "" {
+		return Result{Verdict: Allow}
+	}
+	key := fmt.Sprintf("spam:duplicate:%x", sha1.Sum([]byte(content.Kind+"\x00"+content.Author+"\x00"+content.Category+"\x00"+text)))
+	_, errGet := rule.store.Get(key)
+	// every submission restarts the window
+	rule.store.Set(key, "1", rule.Window)
+	if errGet == nil {
+		return Result{Verdict: rule.Verdict, Reason: "the same text was submitted by the author recently"}
+	}
+	return Result{Verdict: Allow}
+}
+
+// =============================== RATE ================================
+// RateLimitRule allows at most Limit submissions of one kind per author within each
+// fixed window of Per, rejected attempts count too
+type RateLimitRule struct {
+	Limit   int
+	Per     time.Duration
+	Verdict Verdict
+
+	store kv.Store
+}
+
+func NewRateLimitRule(store kv.Store, limit int, per time.Duration, verdict Verdict) *RateLimitRule {
+	return &RateLimitRule{
+		Limit:   limit,
+		Per:     per,
+		Verdict: verdict,
+		store:   store,
+	}
+}
+
+func (rule *RateLimitRule) Name() string { return "rate_limit" }
+
+func (rule *RateLimitRule) Check(content Content) Result {
+	window := time.Now().UnixNano() / int64(rule.Per)
+	key := fmt.Sprintf("spam:rate:%s:%s:%d", content.Kind, content.Author, window)
+	count, errIncr := rule.store.Incr(key, rule.Per)
+	if errIncr != nil || count <= int64(rule.Limit) {
+		return Result{Verdict: Allow}
+	}
+	return Result{
+		Verdict: rule.Verdict,
+		Reason:  fmt.Sprintf("no more than %d per %s", rule.Limit, rule.Per),
+	}
+}
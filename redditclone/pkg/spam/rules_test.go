@@ -0,0 +1,43 @@
+package spam
+
+import (
+	"testing"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+func TestDuplicateTextPerAuthor(t *testing.T) {
+	rule := NewDuplicateTextRule(kv.NewMemoryStore(), time.Hour, ShadowHide)
+	first := Content{Kind: KindComment, Author: "alice", Category: "music", Text: "Thanks!"}
+	if result := rule.Check(first); result.Verdict != Allow {
+		t.Fatalf("first comment got %s", result.Verdict)
+	}
+	other := Content{Kind: KindComment, Author: "bob", Category: "music", Text: "thanks!"}
+	if result := rule.Check(other); result.Verdict != Allow {
+		t.Errorf("the same text of another author got %s", result.Verdict)
+	}
+	post := Content{Kind: KindPost, Author: "alice", Category: "music", Text: "thanks!"}
+	if result := rule.Check(post); result.Verdict != Allow {
+		t.Errorf("the same text of another kind got %s", result.Verdict)
+	}
+	elsewhere := Content{Kind: KindComment, Author: "alice", Category: "news", Text: "thanks!"}
+	if result := rule.Check(elsewhere); result.Verdict != Allow {
+		t.Errorf("the same text in another category got %s", result.Verdict)
+	}
+	repeated := Content{Kind: KindComment, Author: "alice", Category: "music", Text: "  THANKS!  "}
+	if result := rule.Check(repeated); result.Verdict != ShadowHide {
+		t.Errorf("repeated comment got %s", result.Verdict)
+	}
+}
+
+func TestDefaultConfigAllowsNewAccounts(t *testing.T) {
+	pipeline, err := DefaultConfig().Pipeline(kv.NewMemoryStore())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result := pipeline.Check(Content{Kind: KindPost, Author: "newcomer", Text: "hello"})
+	if result.Verdict != Allow {
+		t.Errorf("brand-new account got %s by %s", result.Verdict, result.Rule)
+	}
+}
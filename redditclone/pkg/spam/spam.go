@@ -0,0 +1,99 @@
+package spam
+
+import (
+	"strings"
+	"time"
+)
+
+type Verdict int
+
+const (
+	Allow Verdict = iota
+	ShadowHide
+	Reject
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case ShadowHide:
+		return "shadow_hide"
+	case Reject:
+		return "reject"
+	default:
+		return "allow"
+	}
+}
+
+const (
+	KindPost    = "post"
+	KindComment = "comment"
+)
+
+// Content is everything the rules know about a post or a comment being submitted
+type Content struct {
+	Kind       string
+	Author     string
+	AccountAge time.Duration
+	Karma      int
+	Category   string
+	Text       string
+	URL        string
+}
+
+type Result struct {
+	Verdict Verdict
+	Rule    string
+	Reason  string
+}
+
+type Rule interface {
+	Name() string
+	Check(content Content) Result
+}
+
+// Checker is what handlers depend on, Pipeline is the only implementation
+type Checker interface {
+	Check(content Content) Result
+}
+
+// Pipeline runs the rules of the content category, or the default ones when
+// the category has no own configuration. The most severe verdict wins.
+type Pipeline struct {
+	defaults   []Rule
+	categories map[string][]Rule
+}
+
+func NewPipeline(defaults ...Rule) *Pipeline {
+	return &Pipeline{
+		defaults:   defaults,
+		categories: make(map[string][]Rule),
+	}
+}
+
+// SetCategoryRules must be called before the pipeline starts serving requests
+func (p *Pipeline) SetCategoryRules(category string, rules ...Rule) {
+	p.categories[category] = rules
+}
+
+func (p *Pipeline) Check(content Content) Result {
+	rules, ok := p.categories[content.Category]
+	if !ok {
+		rules = p.defaults
+	}
+	result := Result{Verdict: Allow}
+	for _, rule := range rules {
+		ruleResult := rule.Check(content)
+		if ruleResult.Verdict > result.Verdict {
+			result = ruleResult
+			result.Rule = rule.Name()
+		}
+		if result.Verdict == Reject {
+			break
+		}
+	}
+	return result
+}
+
+func normalizeText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
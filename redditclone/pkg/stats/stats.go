@@ -0,0 +1,253 @@
+// Package stats aggregates site activity from the repositories for the admin dashboard
+package stats
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"redditclone/pkg/comment"
+	"redditclone/pkg/post"
+	"redditclone/pkg/user"
+)
+
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+	MaxBuckets   = 1000
+	DefaultTop   = 10
+)
+
+var (
+	ErrBadInterval    = errors.New("interval must be hour, day or week")
+	ErrBadRange       = errors.New("from must be before to")
+	ErrTooManyBuckets = errors.New("too many buckets for the interval")
+)
+
+var intervals = map[string]time.Duration{
+	IntervalHour: time.Hour,
+	IntervalDay:  24 * time.Hour,
+	// the zero time is a monday, so truncated weeks start on mondays
+	IntervalWeek: 7 * 24 * time.Hour,
+}
+
+type Query struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+	// Top is the length of the category and user rankings
+	Top int
+}
+
+type Bucket struct {
+	Start   time.Time `json:"start"`
+	Signups int       `json:"signups"`
+	// Users counts accounts registered by the end of the bucket
+	Users    int `json:"users"`
+	Posts    int `json:"posts"`
+	Comments int `json:"comments"`
+	Votes    int `json:"votes"`
+}
+
+// Totals are all-time counts of what is stored now
+type Totals struct {
+	Users    int `json:"users"`
+	Posts    int `json:"posts"`
+	Comments int `json:"comments"`
+	Votes    int `json:"votes"`
+}
+
+type Ranked struct {
+	Name     string `json:"name"`
+	Posts    int    `json:"posts"`
+	Comments int    `json:"comments"`
+}
+
+type Report struct {
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Interval      string    `json:"interval"`
+	Totals        Totals    `json:"totals"`
+	Buckets       []Bucket  `json:"buckets"`
+	TopCategories []Ranked  `json:"topCategories"`
+	TopUsers      []Ranked  `json:"topUsers"`
+}
+
+// Buckets returns how many buckets the query needs, the first one starts at the truncated From
+func (q Query) Buckets() (int, error) {
+	size, ok := intervals[q.Interval]
+	if !ok {
+		return 0, ErrBadInterval
+	}
+	if !q.From.Before(q.To) {
+		return 0, ErrBadRange
+	}
+	span := q.To.Sub(q.From.UTC().Truncate(size))
+	count := int((span + size - 1) / size)
+	if count > MaxBuckets {
+		return 0, ErrTooManyBuckets
+	}
+	return count, nil
+}
+
+// Compute walks all repositories once. Deleted accounts are gone from the user repository,
+// so signups only count accounts that still exist.
+func Compute(users user.UserRepo, posts post.PostRepo, comments comment.CommentRepo, query Query) (Report, error) {
+	count, errQuery := query.Buckets()
+	if errQuery != nil {
+		return Report{}, errQuery
+	}
+	if query.Top <= 0 {
+		query.Top = DefaultTop
+	}
+	agg := newAggregator(query, count)
+
+	allUsers, errUsers := users.GetAllUsers()
+	if errUsers != nil {
+		return Report{}, errUsers
+	}
+	registered := 0
+	for _, item := range allUsers {
+		if item.Created.Before(agg.start) {
+			registered++
+		} else if bucket := agg.bucket(item.Created); bucket != nil {
+			bucket.Signups++
+		}
+	}
+	agg.report.Totals.Users = len(allUsers)
+	for idx := range agg.report.Buckets {
+		registered += agg.report.Buckets[idx].Signups
+		agg.report.Buckets[idx].Users = registered
+	}
+
+	allPosts, errPosts := posts.GetAllPosts()
+	if errPosts != nil {
+		return Report{}, errPosts
+	}
+	categories := make(map[string]string, len(allPosts))
+	for _, item := range allPosts {
+		categories[item.ID] = item.Category
+		agg.report.Totals.Posts++
+		agg.report.Totals.Votes += len(item.Votes)
+		if bucket := agg.bucketAt(item.Created); bucket != nil {
+			bucket.Posts++
+			agg.rank(agg.categories, item.Category).Posts++
+			agg.rankUser(item.Author.Login).Posts++
+		}
+		for _, vote := range item.Votes {
+			if bucket := agg.bucketAt(vote.Created); bucket != nil {
+				bucket.Votes++
+			}
+		}
+	}
+
+	postIDs, errIDs := comments.GetPostIDs()
+	if errIDs != nil {
+		return Report{}, errIDs
+	}
+	for _, postID := range postIDs {
+		postComments, errComments := comments.GetAll(postID)
+		if errComments != nil {
+			return Report{}, errComments
+		}
+		agg.report.Totals.Comments += len(postComments)
+		for _, item := range postComments {
+			bucket := agg.bucketAt(item.Created)
+			if bucket == nil {
+				continue
+			}
+			bucket.Comments++
+			agg.rankUser(item.Author.Login).Comments++
+			// comments left behind by deleted posts have no category
+			if category, ok := categories[postID]; ok {
+				agg.rank(agg.categories, category).Comments++
+			}
+		}
+	}
+
+	agg.report.TopCategories = top(agg.categories, query.Top)
+	agg.report.TopUsers = top(agg.users, query.Top)
+	return *agg.report, nil
+}
+
+// ============================== HELP FUNC ==============================
+type aggregator struct {
+	report     *Report
+	start      time.Time
+	size       time.Duration
+	categories map[string]*Ranked
+	users      map[string]*Ranked
+}
+
+func newAggregator(query Query, count int) *aggregator {
+	size := intervals[query.Interval]
+	agg := &aggregator{
+		report: &Report{
+			From:     query.From,
+			To:       query.To,
+			Interval: query.Interval,
+			Buckets:  make([]Bucket, count),
+		},
+		start:      query.From.UTC().Truncate(size),
+		size:       size,
+		categories: make(map[string]*Ranked),
+		users:      make(map[string]*Ranked),
+	}
+	for idx := range agg.report.Buckets {
+		agg.report.Buckets[idx].Start = agg.start.Add(time.Duration(idx) * size)
+	}
+	return agg
+}
+
+// bucket returns nil for times outside of the report
+func (agg *aggregator) bucket(at time.Time) *Bucket {
+	if at.Before(agg.start) || !at.Before(agg.report.To) {
+		return nil
+	}
+	return &agg.report.Buckets[int(at.Sub(agg.start)/agg.size)]
+}
+
+// bucketAt takes the RFC3339 times stored by the repositories, broken ones are skipped
+func (agg *aggregator) bucketAt(created string) *Bucket {
+	at, errParse := time.Parse(time.RFC3339, created)
+	if errParse != nil {
+		return nil
+	}
+	return agg.bucket(at)
+}
+
+func (agg *aggregator) rank(ranking map[string]*Ranked, name string) *Ranked {
+	item, ok := ranking[name]
+	if !ok {
+		item = &Ranked{Name: name}
+		ranking[name] = item
+	}
+	return item
+}
+
+// rankUser keeps the deleted placeholder out of the ranking, it is not a real user
+func (agg *aggregator) rankUser(login string) *Ranked {
+	if login == user.DeletedLogin {
+		return &Ranked{}
+	}
+	return agg.rank(agg.users, login)
+}
+
+func top(ranking map[string]*Ranked, limit int) []Ranked {
+	result := make([]Ranked, 0, len(ranking))
+	for _, item := range ranking {
+		result = append(result, *item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		left, right := result[i].Posts+result[i].Comments, result[j].Posts+result[j].Comments
+		if left != right {
+			return left > right
+		}
+		return result[i].Name < result[j].Name
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
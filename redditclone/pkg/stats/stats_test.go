@@ -0,0 +1,86 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"redditclone/pkg/comment"
+	"redditclone/pkg/post"
+	"redditclone/pkg/user"
+)
+
+func TestQueryBuckets(t *testing.T) {
+	from := time.Date(2024, 1, 3, 15, 30, 0, 0, time.UTC)
+	cases := []struct {
+		query Query
+		count int
+		err   error
+	}{
+		{Query{From: from, To: from.Add(3 * time.Hour), Interval: IntervalHour}, 4, nil},
+		{Query{From: from, To: from.Add(48 * time.Hour), Interval: IntervalDay}, 3, nil},
+		// 2024-01-03 is a wednesday, its week started on monday the 1st
+		{Query{From: from, To: from.Add(5 * 24 * time.Hour), Interval: IntervalWeek}, 2, nil},
+		{Query{From: from, To: from, Interval: IntervalDay}, 0, ErrBadRange},
+		{Query{From: from, To: from.Add(time.Hour), Interval: "month"}, 0, ErrBadInterval},
+		{Query{From: from, To: from.Add(MaxBuckets * time.Hour), Interval: IntervalHour}, 0, ErrTooManyBuckets},
+	}
+	for _, item := range cases {
+		if count, err := item.query.Buckets(); count != item.count || err != item.err {
+			t.Errorf("%+v: got %d, %v, expected %d, %v", item.query, count, err, item.count, item.err)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	users := user.NewMemoryRepo()
+	posts := post.NewMemoryRepo()
+	comments := comment.NewMemoryRepo()
+	alice, _ := users.AddUser("alice", "password")
+	bob, _ := users.AddUser("bob", "password")
+
+	news, _ := posts.Create(post.Post{Author: alice, Category: "news", Title: "one", Type: "text"})
+	posts.Create(post.Post{Author: alice, Category: "news", Title: "two", Type: "text"})
+	music, _ := posts.Create(post.Post{Author: bob, Category: "music", Title: "three", Type: "text"})
+	old := time.Now().Add(-72 * time.Hour).Format(time.RFC3339)
+	posts.Update(music.ID, post.AnyVersion, func(item *post.Post) error {
+		item.Created = old
+		return nil
+	})
+	posts.UpdateVote(1, news.ID, &bob)
+	comments.Create("first", &bob, news.ID, false)
+	comments.Create("second", &bob, music.ID, false)
+
+	now := time.Now()
+	report, err := Compute(users, posts, comments, Query{
+		From:     now.Add(-2 * time.Hour),
+		To:       now.Add(time.Hour),
+		Interval: IntervalHour,
+		Top:      1,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Totals != (Totals{Users: 2, Posts: 3, Comments: 2, Votes: 1}) {
+		t.Errorf("unexpected totals: %+v", report.Totals)
+	}
+	sum := Bucket{}
+	for _, bucket := range report.Buckets {
+		sum.Signups += bucket.Signups
+		sum.Posts += bucket.Posts
+		sum.Comments += bucket.Comments
+		sum.Votes += bucket.Votes
+	}
+	// the old post is outside of the range, comments are bucketed by their own time
+	if sum.Signups != 2 || sum.Posts != 2 || sum.Comments != 2 || sum.Votes != 1 {
+		t.Errorf("unexpected bucket sums: %+v", sum)
+	}
+	if last := report.Buckets[len(report.Buckets)-1]; last.Users != 2 {
+		t.Errorf("expected 2 registered users at the end, got %d", last.Users)
+	}
+	if len(report.TopCategories) != 1 || report.TopCategories[0] != (Ranked{Name: "news", Posts: 2, Comments: 1}) {
+		t.Errorf("unexpected top categories: %+v", report.TopCategories)
+	}
+	if len(report.TopUsers) != 1 || report.TopUsers[0] != (Ranked{Name: "alice", Posts: 2}) {
+		t.Errorf("unexpected top users: %+v", report.TopUsers)
+	}
+}
@@ -0,0 +1,149 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"redditclone/pkg/user"
+)
+
+const MaxTokensPerUser = 20
+
+var (
+	ErrNoToken   = errors.New("no token found")
+	ErrRevoked   = errors.New("token was revoked")
+	ErrBadScope  = errors.New("unknown scope")
+	ErrNoScopes  = errors.New("token needs at least one scope")
+	ErrTooMany   = errors.New("too many tokens")
+	ErrEmptyName = errors.New("token needs a name")
+)
+
+type TokenMemoryRepository struct {
+	// tokens are keyed by the hash of their secret
+	data  map[string]*Token
+	mutex sync.RWMutex
+}
+
+func NewMemoryRepo() *TokenMemoryRepository {
+	return &TokenMemoryRepository{
+		data:  make(map[string]*Token),
+		mutex: sync.RWMutex{},
+	}
+}
+
+func (repo *TokenMemoryRepository) Create(owner user.User, name string, scopes []string) (Token, string, error) {
+	if name == "" {
+		return Token{}, "", ErrEmptyName
+	}
+	if len(scopes) == 0 {
+		return Token{}, "", ErrNoScopes
+	}
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return Token{}, "", ErrBadScope
+		}
+	}
+	raw := make([]byte, 32)
+	_, errRand := rand.Read(raw)
+	if errRand != nil {
+		return Token{}, "", errRand
+	}
+	secret := Prefix + hex.EncodeToString(raw)
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	active := 0
+	for _, item := range repo.data {
+		if item.Login == owner.Login && !item.Revoked {
+			active++
+		}
+	}
+	if active >= MaxTokensPerUser {
+		return Token{}, "", ErrTooMany
+	}
+	tok := &Token{
+		ID:      uuid.New().String(),
+		Name:    name,
+		UserID:  owner.ID,
+		Login:   owner.Login,
+		Scopes:  append(make([]string, 0, len(scopes)), scopes...),
+		Created: time.Now().Format(time.RFC3339),
+	}
+	repo.data[hashSecret(secret)] = tok
+	return *tok, secret, nil
+}
+
+func (repo *TokenMemoryRepository) Check(secret string) (Token, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	tok, ok := repo.data[hashSecret(secret)]
+	if !ok {
+		return Token{}, ErrNoToken
+	}
+	if tok.Revoked {
+		return Token{}, ErrRevoked
+	}
+	tok.LastUsed = time.Now().Format(time.RFC3339)
+	return *tok, nil
+}
+
+func (repo *TokenMemoryRepository) GetUserTokens(login string) ([]Token, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	tokens := make([]Token, 0)
+	for _, tok := range repo.data {
+		if tok.Login == login {
+			tokens = append(tokens, *tok)
+		}
+	}
+	return tokens, nil
+}
+
+func (repo *TokenMemoryRepository) Revoke(tokenID string, login string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	for _, tok := range repo.data {
+		if tok.ID == tokenID && tok.Login == login {
+			tok.Revoked = true
+			return nil
+		}
+	}
+	return ErrNoToken
+}
+
+func (repo *TokenMemoryRepository) RevokeAll(login string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	revoked := 0
+	for _, tok := range repo.data {
+		if tok.Login == login && !tok.Revoked {
+			tok.Revoked = true
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func (repo *TokenMemoryRepository) DeleteAll(login string) (int, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	deleted := 0
+	for hashed, tok := range repo.data {
+		if tok.Login == login {
+			delete(repo.data, hashed)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,70 @@
+package token
+
+import (
+	"fmt"
+	"testing"
+
+	"redditclone/pkg/user"
+)
+
+func TestCreateValidates(t *testing.T) {
+	repo := NewMemoryRepo()
+	owner := user.User{ID: "id", Login: "alice"}
+	cases := []struct {
+		name      string
+		tokenName string
+		scopes    []string
+		err       error
+	}{
+		{"no name", "", []string{ScopeRead}, ErrEmptyName},
+		{"no scopes", "bot", nil, ErrNoScopes},
+		{"unknown scope", "bot", []string{ScopeRead, "admin"}, ErrBadScope},
+	}
+	for _, item := range cases {
+		if _, _, err := repo.Create(owner, item.tokenName, item.scopes); err != item.err {
+			t.Errorf("%s: got %v, expected %v", item.name, err, item.err)
+		}
+	}
+	for i := 0; i < MaxTokensPerUser; i++ {
+		if _, _, err := repo.Create(owner, fmt.Sprintf("bot%d", i), []string{ScopeRead}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, _, err := repo.Create(owner, "one more", []string{ScopeRead}); err != ErrTooMany {
+		t.Errorf("token over the limit got %v", err)
+	}
+}
+
+func TestRevokedTokenStopsWorking(t *testing.T) {
+	repo := NewMemoryRepo()
+	owner := user.User{ID: "id", Login: "alice"}
+	tok, secret, err := repo.Create(owner, "bot", []string{ScopeRead})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !IsToken(secret) {
+		t.Errorf("secret %q lacks the prefix", secret)
+	}
+	checked, err := repo.Check(secret)
+	if err != nil || checked.Login != "alice" || checked.LastUsed == "" {
+		t.Errorf("got %+v %v, expected the token of alice marked as used", checked, err)
+	}
+	if _, err = repo.Check(secret + "0"); err != ErrNoToken {
+		t.Errorf("wrong secret got %v", err)
+	}
+	if err = repo.Revoke(tok.ID, "bob"); err != ErrNoToken {
+		t.Errorf("revoking a token of somebody else got %v", err)
+	}
+	if err = repo.Revoke(tok.ID, "alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = repo.Check(secret); err != ErrRevoked {
+		t.Errorf("revoked token got %v", err)
+	}
+	if deleted, _ := repo.DeleteAll("alice"); deleted != 1 {
+		t.Errorf("deleted %d tokens, expected the revoked one too", deleted)
+	}
+	if _, err = repo.Check(secret); err != ErrNoToken {
+		t.Errorf("deleted token got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package token
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sync"
+	"time"
+
+	"redditclone/pkg/kv"
+	"redditclone/pkg/user"
+)
+
+// lastUsedEvery limits how often a check saves the last use of a token, the time is a hint for the owner
+const lastUsedEvery = time.Minute
+
+// tokenState is a snapshot of the repository, tokens are keyed by the hash of their secret
+type tokenState struct {
+	Data map[string]*Token
+}
+
+func (repo *TokenMemoryRepository) Snapshot() ([]byte, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+	buf := &bytes.Buffer{}
+	errEncode := gob.NewEncoder(buf).Encode(tokenState{Data: repo.data})
+	return buf.Bytes(), errEncode
+}
+
+func (repo *TokenMemoryRepository) Restore(data []byte) error {
+	state := tokenState{}
+	if len(data) > 0 {
+		if errDecode := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); errDecode != nil {
+			return errDecode
+		}
+	}
+	if state.Data == nil {
+		state.Data = make(map[string]*Token)
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.data = state.Data
+	return nil
+}
+
+// SharedRepository serves the tokens every instance issues through the store.
+// A revoked token stops working on all instances with the next check.
+type SharedRepository struct {
+	local  *TokenMemoryRepository
+	shared *kv.Shared
+	// saved holds when the last use of each token was saved by this instance
+	saved map[string]time.Time
+	mutex sync.Mutex
+}
+
+func NewSharedRepo(store kv.Store) *SharedRepository {
+	local := NewMemoryRepo()
+	return &SharedRepository{
+		local:  local,
+		shared: kv.NewShared(store, "tokens", local),
+		saved:  make(map[string]time.Time),
+		mutex:  sync.Mutex{},
+	}
+}
+
+// ================================ GET ===============================
+// Check marks the use in memory, it reaches the store at most once per lastUsedEvery
+func (repo *SharedRepository) Check(secret string) (Token, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return Token{}, errSync
+	}
+	tok, errCheck := repo.local.Check(secret)
+	if errCheck != nil {
+		return tok, errCheck
+	}
+	now := time.Now()
+	repo.mutex.Lock()
+	due := now.Sub(repo.saved[tok.ID]) >= lastUsedEvery
+	if due {
+		repo.saved[tok.ID] = now
+	}
+	repo.mutex.Unlock()
+	if !due {
+		return tok, nil
+	}
+	errWrite := repo.shared.Write(func() (errSave error) {
+		tok, errSave = repo.local.Check(secret)
+		return errSave
+	})
+	return tok, errWrite
+}
+
+func (repo *SharedRepository) GetUserTokens(login string) ([]Token, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetUserTokens(login)
+}
+
+// =============================== POST ===============================
+func (repo *SharedRepository) Create(owner user.User, name string, scopes []string) (created Token, secret string, errWrite error) {
+	errWrite = repo.shared.Write(func() (errCreate error) {
+		created, secret, errCreate = repo.local.Create(owner, name, scopes)
+		return errCreate
+	})
+	return created, secret, errWrite
+}
+
+// ============================== DELETE ==============================
+func (repo *SharedRepository) Revoke(tokenID string, login string) error {
+	return repo.shared.Write(func() error {
+		return repo.local.Revoke(tokenID, login)
+	})
+}
+
+func (repo *SharedRepository) RevokeAll(login string) (revoked int, errWrite error) {
+	errWrite = repo.shared.Write(func() (errRevoke error) {
+		revoked, errRevoke = repo.local.RevokeAll(login)
+		return errRevoke
+	})
+	return revoked, errWrite
+}
+
+func (repo *SharedRepository) DeleteAll(login string) (deleted int, errWrite error) {
+	errWrite = repo.shared.Write(func() (errDelete error) {
+		deleted, errDelete = repo.local.DeleteAll(login)
+		return errDelete
+	})
+	return deleted, errWrite
+}
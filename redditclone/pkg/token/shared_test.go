@@ -0,0 +1,34 @@
+package token
+
+import (
+	"testing"
+
+	"redditclone/pkg/kv"
+	"redditclone/pkg/user"
+)
+
+func TestSharedRevocationReachesAllInstances(t *testing.T) {
+	store := kv.NewMemoryStore()
+	var first, second TokenRepo = NewSharedRepo(store), NewSharedRepo(store)
+	owner := user.User{ID: "id", Login: "alice"}
+	created, secret, err := first.Create(owner, "bot", []string{ScopeRead})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checked, err := second.Check(secret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checked.ID != created.ID || checked.Login != "alice" || len(checked.Scopes) != 1 {
+		t.Errorf("got token %+v", checked)
+	}
+	if tokens, _ := first.GetUserTokens("alice"); len(tokens) != 1 || tokens[0].LastUsed == "" {
+		t.Errorf("the use on the other instance was not saved: %+v", tokens)
+	}
+	if err = first.Revoke(created.ID, "alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = second.Check(secret); err != ErrRevoked {
+		t.Errorf("revoked token got %v", err)
+	}
+}
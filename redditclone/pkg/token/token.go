@@ -0,0 +1,57 @@
+package token
+
+import (
+	"strings"
+
+	"redditclone/pkg/user"
+)
+
+// Prefix tells API tokens apart from session JWTs in the authorization header
+const Prefix = "rc_"
+
+const (
+	ScopeRead    = "read"
+	ScopePost    = "post"
+	ScopeComment = "comment"
+	ScopeVote    = "vote"
+	ScopeMessage = "message"
+	// ScopeManage covers moderation and admin endpoints, the profile is changed by the owner only
+	ScopeManage = "manage"
+)
+
+var AllScopes = []string{ScopeRead, ScopePost, ScopeComment, ScopeVote, ScopeMessage, ScopeManage}
+
+type Token struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	UserID   string   `json:"-"`
+	Login    string   `json:"-"`
+	Scopes   []string `json:"scopes"`
+	Created  string   `json:"created"`
+	LastUsed string   `json:"lastUsed,omitempty"`
+	Revoked  bool     `json:"revoked"`
+}
+
+// TokenRepo keeps only hashes, the secret is returned once by Create
+type TokenRepo interface {
+	Create(owner user.User, name string, scopes []string) (Token, string, error)
+	Check(secret string) (Token, error)
+	GetUserTokens(login string) ([]Token, error)
+	Revoke(tokenID string, login string) error
+	RevokeAll(login string) (int, error)
+	// DeleteAll forgets the tokens of the user, revoked ones too
+	DeleteAll(login string) (int, error)
+}
+
+func IsToken(secret string) bool {
+	return strings.HasPrefix(secret, Prefix)
+}
+
+func ValidScope(scope string) bool {
+	for _, item := range AllScopes {
+		if item == scope {
+			return true
+		}
+	}
+	return false
+}
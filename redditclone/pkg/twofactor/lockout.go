@@ -0,0 +1,51 @@
+package twofactor
+
+import (
+	"errors"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+// failuresPrefix keys the attempts of an account in the store shared by all instances
+const failuresPrefix = "2fa:attempts:"
+
+var ErrLocked = errors.New("too many bad two-factor codes, try again later")
+
+// Lockout limits guessing: once an account has MaxAttempts codes checked without success
+// within Window, every code is refused until the window ends, the right one too
+type Lockout struct {
+	TwoFactorRepo
+	MaxAttempts int
+	Window      time.Duration
+
+	store kv.Store
+}
+
+func NewLockout(repo TwoFactorRepo, store kv.Store, maxAttempts int, window time.Duration) *Lockout {
+	return &Lockout{
+		TwoFactorRepo: repo,
+		MaxAttempts:   maxAttempts,
+		Window:        window,
+		store:         store,
+	}
+}
+
+// Verify counts the attempt before checking the code, so parallel guesses can not slip
+// past the limit. A store failure refuses the code.
+func (l *Lockout) Verify(login, code string) error {
+	key := failuresPrefix + login
+	attempts, errIncr := l.store.Incr(key, l.Window)
+	if errIncr != nil {
+		return errIncr
+	}
+	if attempts > int64(l.MaxAttempts) {
+		return ErrLocked
+	}
+	errVerify := l.TwoFactorRepo.Verify(login, code)
+	if errVerify == nil {
+		// the owner got in, earlier typos must not lock them out later
+		l.store.Del(key)
+	}
+	return errVerify
+}
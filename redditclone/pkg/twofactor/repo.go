@@ -0,0 +1,139 @@
+package twofactor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const RecoveryCodes = 10
+
+var (
+	ErrNotEnrolled = errors.New("two-factor authentication is not set up")
+	ErrEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrBadCode     = errors.New("bad two-factor code")
+)
+
+type account struct {
+	secret  string
+	enabled bool
+	// lastStep blocks reusing a code within its validity window
+	lastStep int64
+	recovery map[string]bool
+}
+
+type TwoFactorMemoryRepository struct {
+	data  map[string]*account
+	mutex sync.Mutex
+}
+
+func NewMemoryRepo() *TwoFactorMemoryRepository {
+	return &TwoFactorMemoryRepository{
+		data:  make(map[string]*account),
+		mutex: sync.Mutex{},
+	}
+}
+
+func (repo *TwoFactorMemoryRepository) Enroll(login string) (string, error) {
+	secret, errSecret := GenerateSecret()
+	if errSecret != nil {
+		return "", errSecret
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if acc, ok := repo.data[login]; ok && acc.enabled {
+		return "", ErrEnabled
+	}
+	repo.data[login] = &account{secret: secret}
+	return secret, nil
+}
+
+func (repo *TwoFactorMemoryRepository) Enable(login, code string) ([]string, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	acc, ok := repo.data[login]
+	if !ok {
+		return nil, ErrNotEnrolled
+	}
+	if acc.enabled {
+		return nil, ErrEnabled
+	}
+	usedStep, valid := Validate(acc.secret, code, time.Now())
+	if !valid {
+		return nil, ErrBadCode
+	}
+	codes := make([]string, 0, RecoveryCodes)
+	acc.recovery = make(map[string]bool, RecoveryCodes)
+	for i := 0; i < RecoveryCodes; i++ {
+		raw := make([]byte, 5)
+		_, errRand := rand.Read(raw)
+		if errRand != nil {
+			return nil, errRand
+		}
+		recoveryCode := hex.EncodeToString(raw)
+		codes = append(codes, recoveryCode)
+		acc.recovery[hashCode(recoveryCode)] = true
+	}
+	acc.enabled = true
+	acc.lastStep = usedStep
+	return codes, nil
+}
+
+func (repo *TwoFactorMemoryRepository) Verify(login, code string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	acc, ok := repo.data[login]
+	if !ok || !acc.enabled {
+		return ErrNotEnrolled
+	}
+	usedStep, valid := Validate(acc.secret, code, time.Now())
+	if valid && usedStep > acc.lastStep {
+		acc.lastStep = usedStep
+		return nil
+	}
+	hashed := hashCode(strings.ToLower(strings.TrimSpace(code)))
+	if acc.recovery[hashed] {
+		delete(acc.recovery, hashed)
+		return nil
+	}
+	return ErrBadCode
+}
+
+func (repo *TwoFactorMemoryRepository) Disable(login string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.data[login]; !ok {
+		return ErrNotEnrolled
+	}
+	delete(repo.data, login)
+	return nil
+}
+
+func (repo *TwoFactorMemoryRepository) GetStatus(login string) (Status, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	acc, ok := repo.data[login]
+	if !ok || !acc.enabled {
+		return Status{}, nil
+	}
+	return Status{
+		Enabled:       true,
+		RecoveryCodes: len(acc.recovery),
+	}, nil
+}
+
+func (repo *TwoFactorMemoryRepository) IsEnabled(login string) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	acc, ok := repo.data[login]
+	return ok && acc.enabled
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
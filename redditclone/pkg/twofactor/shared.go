@@ -0,0 +1,113 @@
+package twofactor
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"redditclone/pkg/kv"
+)
+
+// accountState carries the fields of account, gob skips unexported ones
+type accountState struct {
+	Secret   string
+	Enabled  bool
+	LastStep int64
+	Recovery map[string]bool
+}
+
+func (repo *TwoFactorMemoryRepository) Snapshot() ([]byte, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	state := make(map[string]accountState, len(repo.data))
+	for login, acc := range repo.data {
+		state[login] = accountState{
+			Secret:   acc.secret,
+			Enabled:  acc.enabled,
+			LastStep: acc.lastStep,
+			Recovery: acc.recovery,
+		}
+	}
+	buf := &bytes.Buffer{}
+	errEncode := gob.NewEncoder(buf).Encode(state)
+	return buf.Bytes(), errEncode
+}
+
+func (repo *TwoFactorMemoryRepository) Restore(data []byte) error {
+	state := make(map[string]accountState)
+	if len(data) > 0 {
+		if errDecode := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); errDecode != nil {
+			return errDecode
+		}
+	}
+	accounts := make(map[string]*account, len(state))
+	for login, acc := range state {
+		accounts[login] = &account{
+			secret:   acc.Secret,
+			enabled:  acc.Enabled,
+			lastStep: acc.LastStep,
+			recovery: acc.Recovery,
+		}
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.data = accounts
+	return nil
+}
+
+// SharedRepository keeps two-factor accounts in the store. Verify is a write:
+// a code or a recovery code used on one instance is spent on all of them.
+type SharedRepository struct {
+	local  *TwoFactorMemoryRepository
+	shared *kv.Shared
+}
+
+func NewSharedRepo(store kv.Store) *SharedRepository {
+	local := NewMemoryRepo()
+	return &SharedRepository{
+		local:  local,
+		shared: kv.NewShared(store, "twofactor", local),
+	}
+}
+
+func (repo *SharedRepository) Enroll(login string) (secret string, errWrite error) {
+	errWrite = repo.shared.Write(func() (errEnroll error) {
+		secret, errEnroll = repo.local.Enroll(login)
+		return errEnroll
+	})
+	return secret, errWrite
+}
+
+func (repo *SharedRepository) Enable(login, code string) (codes []string, errWrite error) {
+	errWrite = repo.shared.Write(func() (errEnable error) {
+		codes, errEnable = repo.local.Enable(login, code)
+		return errEnable
+	})
+	return codes, errWrite
+}
+
+func (repo *SharedRepository) Verify(login, code string) error {
+	return repo.shared.Write(func() error {
+		return repo.local.Verify(login, code)
+	})
+}
+
+func (repo *SharedRepository) Disable(login string) error {
+	return repo.shared.Write(func() error {
+		return repo.local.Disable(login)
+	})
+}
+
+func (repo *SharedRepository) GetStatus(login string) (Status, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return Status{}, errSync
+	}
+	return repo.local.GetStatus(login)
+}
+
+// IsEnabled asks for a code when the store fails, a login without it could skip the second factor
+func (repo *SharedRepository) IsEnabled(login string) bool {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return true
+	}
+	return repo.local.IsEnabled(login)
+}
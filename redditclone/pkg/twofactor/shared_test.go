@@ -0,0 +1,38 @@
+package twofactor
+
+import (
+	"testing"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+func TestSharedCodesAreSpentEverywhere(t *testing.T) {
+	store := kv.NewMemoryStore()
+	var first, second TwoFactorRepo = NewSharedRepo(store), NewSharedRepo(store)
+	secret, err := first.Enroll("alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	code, _ := Code(secret, time.Now())
+	recovery, err := second.Enable("alice", code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !first.IsEnabled("alice") {
+		t.Fatalf("enabled on one instance only")
+	}
+	// the code that enabled the account can not log in through the other instance
+	if err = first.Verify("alice", code); err != ErrBadCode {
+		t.Errorf("replayed code on the other instance got %v", err)
+	}
+	if err = first.Verify("alice", recovery[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = second.Verify("alice", recovery[0]); err != ErrBadCode {
+		t.Errorf("recovery code used twice got %v", err)
+	}
+	if status, _ := second.GetStatus("alice"); status.RecoveryCodes != RecoveryCodes-1 {
+		t.Errorf("got status %+v", status)
+	}
+}
@@ -0,0 +1,102 @@
+package twofactor
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+// rfc6238Secret is the SHA1 key from the RFC 6238 test vectors
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238(t *testing.T) {
+	// the RFC lists 8 digit codes, the last 6 digits are the 6 digit code
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := Code(rfc6238Secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != expected {
+			t.Errorf("at %d: got %s, expected %s", unix, code, expected)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	for _, shift := range []time.Duration{-Period, 0, Period} {
+		code, _ := Code(rfc6238Secret, now.Add(shift))
+		if _, ok := Validate(rfc6238Secret, code, now); !ok {
+			t.Errorf("code shifted by %s was rejected", shift)
+		}
+	}
+	code, _ := Code(rfc6238Secret, now.Add(3*Period))
+	if _, ok := Validate(rfc6238Secret, code, now); ok {
+		t.Errorf("code from the future was accepted")
+	}
+}
+
+func TestVerifyReplayAndRecovery(t *testing.T) {
+	repo := NewMemoryRepo()
+	secret, err := repo.Enroll("alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.IsEnabled("alice") {
+		t.Fatalf("enabled before confirmation")
+	}
+	code, _ := Code(secret, time.Now())
+	recovery, err := repo.Enable("alice", code)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recovery) != RecoveryCodes {
+		t.Fatalf("got %d recovery codes, expected %d", len(recovery), RecoveryCodes)
+	}
+	if err = repo.Verify("alice", code); err != ErrBadCode {
+		t.Errorf("replayed code: expected ErrBadCode, got %v", err)
+	}
+	if err = repo.Verify("alice", strings.ToUpper(recovery[0])); err != nil {
+		t.Errorf("recovery code rejected: %v", err)
+	}
+	if err = repo.Verify("alice", recovery[0]); err != ErrBadCode {
+		t.Errorf("recovery code used twice: expected ErrBadCode, got %v", err)
+	}
+	status, _ := repo.GetStatus("alice")
+	if !status.Enabled || status.RecoveryCodes != RecoveryCodes-1 {
+		t.Errorf("bad status %+v", status)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	repo := NewMemoryRepo()
+	secret, _ := repo.Enroll("alice")
+	code, _ := Code(secret, time.Now().Add(-Period))
+	if _, err := repo.Enable("alice", code); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lockout := NewLockout(repo, kv.NewMemoryStore(), 3, time.Hour)
+	for i := 0; i < 3; i++ {
+		if err := lockout.Verify("alice", "000000"); err != ErrBadCode {
+			t.Fatalf("attempt %d: expected ErrBadCode, got %v", i, err)
+		}
+	}
+	code, _ = Code(secret, time.Now())
+	if err := lockout.Verify("alice", code); err != ErrLocked {
+		t.Errorf("right code after the limit: expected ErrLocked, got %v", err)
+	}
+	if err := NewLockout(repo, kv.NewMemoryStore(), 3, time.Hour).Verify("alice", code); err != nil {
+		t.Errorf("right code within the limit was refused: %v", err)
+	}
+}
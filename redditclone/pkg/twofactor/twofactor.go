@@ -0,0 +1,17 @@
+package twofactor
+
+type Status struct {
+	Enabled       bool `json:"enabled"`
+	RecoveryCodes int  `json:"recoveryCodesLeft"`
+}
+
+type TwoFactorRepo interface {
+	// Enroll starts over with a new secret which stays inactive until Enable
+	Enroll(login string) (string, error)
+	Enable(login, code string) ([]string, error)
+	// Verify accepts a current TOTP code or an unused recovery code
+	Verify(login, code string) error
+	Disable(login string) error
+	GetStatus(login string) (Status, error)
+	IsEnabled(login string) bool
+}
@@ -4,30 +4,46 @@ import (
 	"crypto/md5"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 var (
-	ErrNoUser  = errors.New("no user found")
-	ErrBadPass = errors.New("invald password")
+	ErrNoUser   = errors.New("no user found")
+	ErrBadPass  = errors.New("invald password")
+	ErrReserved = errors.New("login is reserved")
 )
 
 type UserMemoryRepository struct {
-	data  map[string]User
-	mutex sync.Mutex
+	data     map[string]User
+	settings map[string]Settings
+	admins   map[string]bool
+	// external identities are keyed by provider and subject
+	external map[string]string
+	mutex    sync.Mutex
 }
 
-func NewMemoryRepo() *UserMemoryRepository {
-	return &UserMemoryRepository{
-		data:  make(map[string]User),
-		mutex: sync.Mutex{},
+func NewMemoryRepo(admins ...string) *UserMemoryRepository {
+	repo := &UserMemoryRepository{
+		data:     make(map[string]User),
+		settings: make(map[string]Settings),
+		admins:   make(map[string]bool, len(admins)),
+		external: make(map[string]string),
+		mutex:    sync.Mutex{},
 	}
+	for _, login := range admins {
+		repo.admins[login] = true
+	}
+	return repo
 }
 
 func (repo *UserMemoryRepository) Authorize(login, pass string) (User, error) {
+	repo.mutex.Lock()
 	user, ok := repo.data[login]
+	repo.mutex.Unlock()
 	if !ok {
 		return User{}, ErrNoUser
 	}
@@ -41,15 +57,19 @@ func (repo *UserMemoryRepository) Authorize(login, pass string) (User, error) {
 }
 
 func (repo *UserMemoryRepository) AddUser(login, pass string) (User, error) {
+	if login == DeletedLogin {
+		return User{}, ErrReserved
+	}
 	pass = HashPass(pass)
 	repo.mutex.Lock()
 	repo.data[login] = User{
 		ID:       uuid.New().String(),
 		Login:    login,
+		Created:  time.Now(),
 		password: pass,
 	}
-	repo.mutex.Unlock()
 	user, ok := repo.data[login]
+	repo.mutex.Unlock()
 	if !ok {
 		return User{}, ErrNoUser
 	}
@@ -59,6 +79,116 @@ func (repo *UserMemoryRepository) AddUser(login, pass string) (User, error) {
 	return user, nil
 }
 
+func (repo *UserMemoryRepository) GetUser(login string) (User, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	user, ok := repo.data[login]
+	if !ok {
+		return User{}, ErrNoUser
+	}
+	return user, nil
+}
+
+func (repo *UserMemoryRepository) GetUsersByID(ids []string) (map[string]User, error) {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	users := make(map[string]User, len(ids))
+	for _, user := range repo.data {
+		if wanted[user.ID] {
+			users[user.ID] = user
+		}
+	}
+	return users, nil
+}
+
+func (repo *UserMemoryRepository) GetAllUsers() ([]User, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	users := make([]User, 0, len(repo.data))
+	for _, user := range repo.data {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Created.Before(users[j].Created) })
+	return users, nil
+}
+
+// GetOrCreateExternal finds the user linked to the external identity or registers a new one
+// without a password, picking a free login based on the one the provider suggests
+func (repo *UserMemoryRepository) GetOrCreateExternal(provider, subject, login string) (User, error) {
+	key := provider + "\x00" + subject
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if linked, ok := repo.external[key]; ok {
+		user, ok := repo.data[linked]
+		if ok {
+			return user, nil
+		}
+	}
+	candidate := login
+	for i := 1; ; i++ {
+		if _, taken := repo.data[candidate]; !taken && candidate != DeletedLogin {
+			break
+		}
+		candidate = fmt.Sprintf("%s_%s%d", login, provider, i)
+	}
+	user := User{
+		ID:      uuid.New().String(),
+		Login:   candidate,
+		Created: time.Now(),
+		// no md5 hash equals this, so password login is impossible
+		password: "!",
+	}
+	repo.data[candidate] = user
+	repo.external[key] = candidate
+	return user, nil
+}
+
+func (repo *UserMemoryRepository) IsAdmin(login string) bool {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	return repo.admins[login]
+}
+
+func (repo *UserMemoryRepository) GetSettings(login string) (Settings, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.data[login]; !ok {
+		return Settings{}, ErrNoUser
+	}
+	return repo.settings[login], nil
+}
+
+func (repo *UserMemoryRepository) UpdateSettings(login string, settings Settings) (Settings, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.data[login]; !ok {
+		return Settings{}, ErrNoUser
+	}
+	repo.settings[login] = settings
+	return settings, nil
+}
+
+// DeleteUser forgets the account, its settings and linked identities, the login becomes free again
+func (repo *UserMemoryRepository) DeleteUser(login string) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if _, ok := repo.data[login]; !ok {
+		return ErrNoUser
+	}
+	delete(repo.data, login)
+	delete(repo.settings, login)
+	for key, linked := range repo.external {
+		if linked == login {
+			delete(repo.external, key)
+		}
+	}
+	return nil
+}
+
 func HashPass(data string) string {
 	data += ""
 	dataHash := fmt.Sprintf("%x", md5.Sum([]byte(data)))
@@ -0,0 +1,151 @@
+package user
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"redditclone/pkg/kv"
+)
+
+// account keeps the password hash, gob skips the unexported field of User
+type account struct {
+	User     User
+	Password string
+}
+
+// userState is a snapshot of the repository. Admins come from the configuration
+// of each instance and are not part of it.
+type userState struct {
+	Accounts []account
+	Settings map[string]Settings
+	External map[string]string
+}
+
+func (repo *UserMemoryRepository) Snapshot() ([]byte, error) {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	state := userState{
+		Accounts: make([]account, 0, len(repo.data)),
+		Settings: repo.settings,
+		External: repo.external,
+	}
+	for _, user := range repo.data {
+		state.Accounts = append(state.Accounts, account{User: user, Password: user.password})
+	}
+	buf := &bytes.Buffer{}
+	errEncode := gob.NewEncoder(buf).Encode(state)
+	return buf.Bytes(), errEncode
+}
+
+func (repo *UserMemoryRepository) Restore(data []byte) error {
+	state := userState{}
+	if len(data) > 0 {
+		if errDecode := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); errDecode != nil {
+			return errDecode
+		}
+	}
+	users := make(map[string]User, len(state.Accounts))
+	for _, item := range state.Accounts {
+		item.User.password = item.Password
+		users[item.User.Login] = item.User
+	}
+	if state.Settings == nil {
+		state.Settings = make(map[string]Settings)
+	}
+	if state.External == nil {
+		state.External = make(map[string]string)
+	}
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	repo.data = users
+	repo.settings = state.Settings
+	repo.external = state.External
+	return nil
+}
+
+// SharedRepository serves the accounts every instance registers through the store
+type SharedRepository struct {
+	local  *UserMemoryRepository
+	shared *kv.Shared
+}
+
+func NewSharedRepo(store kv.Store, admins ...string) *SharedRepository {
+	local := NewMemoryRepo(admins...)
+	return &SharedRepository{
+		local:  local,
+		shared: kv.NewShared(store, "users", local),
+	}
+}
+
+// ================================ GET ===============================
+func (repo *SharedRepository) Authorize(login, pass string) (User, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return User{}, errSync
+	}
+	return repo.local.Authorize(login, pass)
+}
+
+func (repo *SharedRepository) GetUser(login string) (User, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return User{}, errSync
+	}
+	return repo.local.GetUser(login)
+}
+
+func (repo *SharedRepository) GetUsersByID(ids []string) (map[string]User, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetUsersByID(ids)
+}
+
+func (repo *SharedRepository) GetAllUsers() ([]User, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return nil, errSync
+	}
+	return repo.local.GetAllUsers()
+}
+
+func (repo *SharedRepository) GetSettings(login string) (Settings, error) {
+	if errSync := repo.shared.Sync(); errSync != nil {
+		return Settings{}, errSync
+	}
+	return repo.local.GetSettings(login)
+}
+
+// IsAdmin needs no sync, admins are configured on every instance
+func (repo *SharedRepository) IsAdmin(login string) bool {
+	return repo.local.IsAdmin(login)
+}
+
+// =============================== POST ===============================
+func (repo *SharedRepository) AddUser(login, pass string) (added User, errWrite error) {
+	errWrite = repo.shared.Write(func() (errAdd error) {
+		added, errAdd = repo.local.AddUser(login, pass)
+		return errAdd
+	})
+	return added, errWrite
+}
+
+func (repo *SharedRepository) GetOrCreateExternal(provider, subject, login string) (linked User, errWrite error) {
+	errWrite = repo.shared.Write(func() (errLink error) {
+		linked, errLink = repo.local.GetOrCreateExternal(provider, subject, login)
+		return errLink
+	})
+	return linked, errWrite
+}
+
+func (repo *SharedRepository) UpdateSettings(login string, settings Settings) (updated Settings, errWrite error) {
+	errWrite = repo.shared.Write(func() (errUpdate error) {
+		updated, errUpdate = repo.local.UpdateSettings(login, settings)
+		return errUpdate
+	})
+	return updated, errWrite
+}
+
+// ============================== DELETE ==============================
+func (repo *SharedRepository) DeleteUser(login string) error {
+	return repo.shared.Write(func() error {
+		return repo.local.DeleteUser(login)
+	})
+}
@@ -0,0 +1,47 @@
+package user
+
+import (
+	"testing"
+
+	"redditclone/pkg/kv"
+)
+
+func TestSharedRepoAcrossInstances(t *testing.T) {
+	store := kv.NewMemoryStore()
+	var first, second UserRepo = NewSharedRepo(store, "admin"), NewSharedRepo(store, "admin")
+
+	registered, err := first.AddUser("alice", "password1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the password hash travels with the account
+	if _, err = second.Authorize("alice", "password1"); err != nil {
+		t.Errorf("login on the other instance got %v", err)
+	}
+	if _, err = second.Authorize("alice", "wrong"); err != ErrBadPass {
+		t.Errorf("wrong password got %v", err)
+	}
+	if _, err = second.UpdateSettings("alice", Settings{ShowNSFW: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if settings, _ := first.GetSettings("alice"); !settings.ShowNSFW {
+		t.Errorf("settings were lost")
+	}
+	linked, err := first.GetOrCreateExternal("github", "42", "alice")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again, _ := second.GetOrCreateExternal("github", "42", "alice"); again.ID != linked.ID || linked.ID == registered.ID {
+		t.Errorf("external identity linked to %q and %q", linked.Login, again.Login)
+	}
+	if !second.IsAdmin("admin") || second.IsAdmin("alice") {
+		t.Errorf("admins do not follow the configuration")
+	}
+
+	if err = second.DeleteUser("alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = first.GetUser("alice"); err != ErrNoUser {
+		t.Errorf("deleted user got %v", err)
+	}
+}
@@ -1,12 +1,37 @@
 package user
 
+import "time"
+
+// DeletedLogin replaces the author of content left behind by a deleted account
+const DeletedLogin = "[deleted]"
+
 type User struct {
-	ID       string `json:"id"`
-	Login    string `json:"username"`
+	ID       string    `json:"id"`
+	Login    string    `json:"username"`
+	Created  time.Time `json:"-"`
 	password string
 }
 
+type Settings struct {
+	ShowNSFW bool `json:"showNsfw"`
+}
+
 type UserRepo interface {
 	Authorize(login, pass string) (User, error)
 	AddUser(login, pass string) (User, error)
+	GetUser(login string) (User, error)
+	// GetUsersByID looks up several users at once, unknown ids are left out of the result
+	GetUsersByID(ids []string) (map[string]User, error)
+	// GetAllUsers lists registered users by registration time
+	GetAllUsers() ([]User, error)
+	GetOrCreateExternal(provider, subject, login string) (User, error)
+	IsAdmin(login string) bool
+	GetSettings(login string) (Settings, error)
+	UpdateSettings(login string, settings Settings) (Settings, error)
+	DeleteUser(login string) error
+}
+
+// Deleted is the placeholder author of anonymized content
+func Deleted() User {
+	return User{Login: DeletedLogin}
 }
@@ -0,0 +1,140 @@
+package views
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+// Sink stores the counted views, it is called from the flushing goroutine only
+type Sink interface {
+	AddViews(postID string, unique, total int) error
+}
+
+// BatchSink takes the views of all posts of a flush in one call,
+// it suits sinks that save their whole state on every change
+type BatchSink interface {
+	Sink
+	AddViewsBatch(counts map[string]*Counts) error
+}
+
+// Counts are the views of one post since the last flush
+type Counts struct {
+	Unique int
+	Total  int
+}
+
+// Counter counts every view in total, but a viewer adds a unique view at most once per window.
+// Record only touches memory, views reach the sink in batches on Flush.
+type Counter struct {
+	Window time.Duration
+	// Now is replaceable in tests
+	Now func() time.Time
+
+	sink Sink
+	seen map[string]time.Time
+	// store replaces seen when instances share viewers, the window is the ttl of its keys
+	store   kv.Store
+	pending map[string]*Counts
+	mutex   sync.Mutex
+}
+
+func NewCounter(sink Sink, window time.Duration) *Counter {
+	return &Counter{
+		Window:  window,
+		Now:     time.Now,
+		sink:    sink,
+		seen:    make(map[string]time.Time),
+		pending: make(map[string]*Counts),
+		mutex:   sync.Mutex{},
+	}
+}
+
+// NewSharedCounter remembers viewers in the store, a viewer moving between
+// instances still adds one unique view per window
+func NewSharedCounter(sink Sink, store kv.Store, window time.Duration) *Counter {
+	counter := NewCounter(sink, window)
+	counter.store = store
+	return counter
+}
+
+// Record counts a view of the post, viewer identifies a session or an address
+func (c *Counter) Record(postID, viewer string) {
+	now := c.Now()
+	key := postID + "\x00" + viewer
+	unique := false
+	if c.store != nil {
+		// an unreachable store counts the view as seen, unique views are never inflated
+		views, errIncr := c.store.Incr("views:"+key, c.Window)
+		unique = errIncr == nil && views == 1
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	postCounts, ok := c.pending[postID]
+	if !ok {
+		postCounts = &Counts{}
+		c.pending[postID] = postCounts
+	}
+	postCounts.Total++
+	if c.store == nil {
+		last, ok := c.seen[key]
+		unique = !ok || now.Sub(last) >= c.Window
+		if unique {
+			c.seen[key] = now
+		}
+	}
+	if unique {
+		postCounts.Unique++
+	}
+}
+
+// Flush hands pending views to the sink and forgets viewers whose window is over.
+// Posts the sink fails on are dropped: views of deleted posts have nowhere to go.
+func (c *Counter) Flush() error {
+	now := c.Now()
+	c.mutex.Lock()
+	pending := c.pending
+	c.pending = make(map[string]*Counts, len(pending))
+	for key, last := range c.seen {
+		if now.Sub(last) >= c.Window {
+			delete(c.seen, key)
+		}
+	}
+	c.mutex.Unlock()
+
+	if batch, ok := c.sink.(BatchSink); ok {
+		if len(pending) == 0 {
+			return nil
+		}
+		return batch.AddViewsBatch(pending)
+	}
+	var firstErr error
+	for postID, postCounts := range pending {
+		errAdd := c.sink.AddViews(postID, postCounts.Unique, postCounts.Total)
+		if errAdd != nil && firstErr == nil {
+			firstErr = errAdd
+		}
+	}
+	return firstErr
+}
+
+// Run flushes every interval until the context is done, then flushes one last time
+func (c *Counter) Run(ctx context.Context, interval time.Duration, onErr func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if errFlush := c.Flush(); errFlush != nil && onErr != nil {
+				onErr(errFlush)
+			}
+			return
+		}
+		if errFlush := c.Flush(); errFlush != nil && onErr != nil {
+			onErr(errFlush)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package views
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"redditclone/pkg/kv"
+)
+
+type sinkMock struct {
+	unique map[string]int
+	total  map[string]int
+	calls  int
+	mutex  sync.Mutex
+}
+
+func newSinkMock() *sinkMock {
+	return &sinkMock{unique: make(map[string]int), total: make(map[string]int)}
+}
+
+func (s *sinkMock) AddViews(postID string, unique, total int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calls++
+	if postID == "deleted" {
+		return errors.New("no post")
+	}
+	s.unique[postID] += unique
+	s.total[postID] += total
+	return nil
+}
+
+func TestDeduplication(t *testing.T) {
+	sink := newSinkMock()
+	counter := NewCounter(sink, time.Hour)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	counter.Now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		counter.Record("post", "ip:1.2.3.4")
+	}
+	counter.Record("post", "u:alice")
+	if sink.calls != 0 {
+		t.Fatalf("views reached the sink before flush")
+	}
+	if err := counter.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sink.unique["post"] != 2 || sink.total["post"] != 6 {
+		t.Errorf("got unique %d total %d, expected 2 and 6", sink.unique["post"], sink.total["post"])
+	}
+
+	now = now.Add(59 * time.Minute)
+	counter.Record("post", "ip:1.2.3.4")
+	now = now.Add(2 * time.Minute)
+	counter.Record("post", "u:alice")
+	counter.Record("post", "ip:1.2.3.4")
+	if err := counter.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sink.unique["post"] != 4 || sink.total["post"] != 9 {
+		t.Errorf("got unique %d total %d, expected 4 and 9", sink.unique["post"], sink.total["post"])
+	}
+}
+
+func TestFlushKeepsGoingOnErrors(t *testing.T) {
+	sink := newSinkMock()
+	counter := NewCounter(sink, time.Hour)
+	counter.Record("deleted", "u:alice")
+	counter.Record("post", "u:alice")
+	if err := counter.Flush(); err == nil {
+		t.Errorf("expected the sink error")
+	}
+	if sink.unique["post"] != 1 {
+		t.Errorf("views of other posts were lost")
+	}
+	if err := counter.Flush(); err != nil || sink.calls != 2 {
+		t.Errorf("failed views were retried: %v, %d calls", err, sink.calls)
+	}
+}
+
+func TestRunFlushesOnStop(t *testing.T) {
+	sink := newSinkMock()
+	counter := NewCounter(sink, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		counter.Run(ctx, time.Hour, nil)
+		close(done)
+	}()
+	counter.Record("post", "u:alice")
+	cancel()
+	<-done
+	if sink.total["post"] != 1 {
+		t.Errorf("pending views were lost on stop")
+	}
+}
+
+func TestSharedCounterDeduplicatesAcrossInstances(t *testing.T) {
+	store := kv.NewMemoryStore()
+	sink := newSinkMock()
+	first, second := NewSharedCounter(sink, store, time.Hour), NewSharedCounter(sink, store, time.Hour)
+	first.Record("post", "u:alice")
+	second.Record("post", "u:alice")
+	second.Record("post", "u:bob")
+	for _, counter := range []*Counter{first, second} {
+		if err := counter.Flush(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if sink.unique["post"] != 2 || sink.total["post"] != 3 {
+		t.Errorf("got unique %d total %d, expected 2 and 3", sink.unique["post"], sink.total["post"])
+	}
+}